@@ -1,6 +1,10 @@
 package participle
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
+
 	"github.com/alecthomas/participle/v2/lexer"
 )
 
@@ -9,6 +13,43 @@ type Capture interface {
 	Capture(values []string) error
 }
 
+// Maybe is a field type that records whether its capture matched, without
+// the allocation of a pointer field.
+//
+// Value is converted from the captured tokens in the same way as a field of
+// type T, so a bool Value takes the value of a literal "true" or "false"
+// capture and is otherwise set to true.
+type Maybe[T any] struct {
+	Present bool
+	Value   T
+}
+
+// Capture implements Capture.
+func (o *Maybe[T]) Capture(values []string) error {
+	o.Present = true
+	v := reflect.ValueOf(&o.Value).Elem()
+	fieldValue := []reflect.Value{reflect.ValueOf(strings.Join(values, ""))}
+	switch v.Kind() { // nolint: exhaustive
+	case reflect.String:
+		v.SetString(v.String() + fieldValue[0].String())
+		return nil
+	case reflect.Bool:
+		if value, ok := literalBool(fieldValue); ok {
+			v.SetBool(value)
+			return nil
+		}
+	}
+	fieldValue, err := conform(v.Type(), fieldValue)
+	if err != nil {
+		return err
+	}
+	if fieldValue[0].Type() != v.Type() {
+		return fmt.Errorf("value %q is not correct type %s", values, v.Type())
+	}
+	v.Set(fieldValue[0])
+	return nil
+}
+
 // The Parseable interface can be implemented by any element in the grammar to provide custom parsing.
 type Parseable interface {
 	// Parse into the receiver.
@@ -17,3 +58,46 @@ type Parseable interface {
 	// Nil should be returned if parsing was successful.
 	Parse(lex *lexer.PeekingLexer) error
 }
+
+// ParsedHook can be implemented by grammar structs to validate or compute
+// derived fields once they have been fully populated.
+type ParsedHook interface {
+	// OnParsed is called after the struct has been successfully parsed.
+	//
+	// "lex" is positioned after the tokens matched by the struct and may be
+	// freely advanced without affecting the parse. If an error is returned it
+	// fails the parse, positioned at the start of the struct unless it is
+	// already an Error.
+	OnParsed(lex *lexer.PeekingLexer) error
+}
+
+// WarningHook can be implemented by grammar structs to report non-fatal
+// diagnostics, eg. for deprecated syntax that is still accepted.
+//
+// Diagnostics are only collected when parsing with CollectDiagnostics.
+type WarningHook interface {
+	// Warnings is called after the struct has been successfully parsed, with
+	// the extent of the input that it matched.
+	Warnings(span lexer.Span) []Diagnostic
+}
+
+// Predicate can be implemented by grammar structs to only attempt to parse
+// them when some condition holds, eg. to distinguish keywords from identifiers
+// or to gate syntax on a language version.
+type Predicate interface {
+	// Predicate is called on a new value of the struct before it is parsed.
+	//
+	// If it returns false the struct does not match and other alternatives are
+	// attempted. "lex" may be freely advanced to inspect upcoming tokens without
+	// affecting the parse.
+	Predicate(lex *lexer.PeekingLexer) bool
+}
+
+// GrammarNamer can be implemented by grammar structs to describe their
+// production in error messages, eg. "query expression", rather than with EBNF.
+//
+// Alternatively, a `parser_name:"..."` tag may be added to any field of the
+// struct, such as a blank field: _ struct{} `parser_name:"query expression"`.
+type GrammarNamer interface {
+	GrammarName() string
+}
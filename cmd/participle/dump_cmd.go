@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+type dumpCmd struct {
+	Lexer *os.File `arg:"" help:"JSON representation of a Participle lexer."`
+	Input string   `arg:"" default:"-" type:"existingfile" help:"File to lex (read from stdin if omitted)."`
+}
+
+func (c *dumpCmd) Help() string {
+	return `
+Lexes the input with the given JSON representation of a lexer and prints each
+token with its position, type, value, and the state and rule that produced it.
+`
+}
+
+func (c *dumpCmd) Run() error {
+	defer c.Lexer.Close()
+	rules := lexer.Rules{}
+	err := json.NewDecoder(c.Lexer).Decode(&rules)
+	if err != nil {
+		return err
+	}
+	def, err := lexer.New(rules)
+	if err != nil {
+		return err
+	}
+	r := os.Stdin
+	if c.Input != "-" {
+		r, err = os.Open(c.Input)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+	}
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return lexer.Dump(def, string(input), os.Stdout)
+}
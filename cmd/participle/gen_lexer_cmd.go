@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bytes"
 	_ "embed" // For go:embed.
 	"encoding/json"
 	"fmt"
+	"go/format"
 	"io"
 	"os"
 	"regexp"
@@ -99,7 +101,23 @@ var (
 	}).Parse(codegenTemplateSource))
 )
 
+// Generate a lexer, formatted with go/format.
+//
+// The output only depends on the definition, so it is reproducible across runs.
 func generateLexer(w io.Writer, pkg string, def *lexer.StatefulDefinition, name, tags string) error {
+	buf := &bytes.Buffer{}
+	if err := generateUnformattedLexer(buf, pkg, def, name, tags); err != nil {
+		return err
+	}
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("generated lexer is invalid: %w", err)
+	}
+	_, err = w.Write(source)
+	return err
+}
+
+func generateUnformattedLexer(w io.Writer, pkg string, def *lexer.StatefulDefinition, name, tags string) error {
 	type ctx struct {
 		Package string
 		Name    string
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"testing"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+func TestGenerateLexerIsFormatted(t *testing.T) {
+	def, err := lexer.New(lexer.Rules{
+		"Root": {
+			{"String", `"`, lexer.Push("String")},
+			{"Ident", `[a-zA-Z_]\w*`, nil},
+			{"Number", `\d+(\.\d+)?`, nil},
+			{"Punct", `[-+*/(){}]`, nil},
+			{"whitespace", `\s+`, nil},
+		},
+		"String": {
+			{"Escaped", `\\.`, nil},
+			{"StringEnd", `"`, lexer.Pop()},
+			{"Expr", `\${`, lexer.Push("Expr")},
+			{"Char", `[^$"\\]+`, nil},
+		},
+		"Expr": {
+			lexer.Include("Root"),
+			{"ExprEnd", `}`, lexer.Pop()},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	generate := func() []byte {
+		t.Helper()
+		w := &bytes.Buffer{}
+		if err := generateLexer(w, "lexer", def, "Test", "generated"); err != nil {
+			t.Fatal(err)
+		}
+		return w.Bytes()
+	}
+	source := generate()
+	formatted, err := format.Source(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(source, formatted) {
+		t.Fatal("generated lexer is not gofmt-clean")
+	}
+	if !bytes.Equal(source, generate()) {
+		t.Fatal("generated lexer is not reproducible")
+	}
+}
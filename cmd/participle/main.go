@@ -11,6 +11,8 @@ var (
 		Gen struct {
 			Lexer genLexerCmd `cmd:"" help:"Generate a lexer."`
 		} `cmd:"" help:"Generate code to accelerate Participle."`
+
+		Dump dumpCmd `cmd:"" help:"Dump the tokens produced by a lexer."`
 	}
 )
 
@@ -1,6 +1,8 @@
 package participle
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
@@ -16,6 +18,19 @@ type contextFieldSet struct {
 	fieldValue []reflect.Value
 }
 
+// A left recursive struct at a position in the token stream.
+type leftRecursionKey struct {
+	strct  *strct
+	cursor lexer.RawCursor
+}
+
+// The largest match of a left recursive struct so far, or nil if there is none yet.
+type leftRecursionMemo struct {
+	value        *reflect.Value
+	checkpoint   lexer.Checkpoint
+	triviaCursor lexer.RawCursor
+}
+
 // Context for a single parse.
 type parseContext struct {
 	lexer.PeekingLexer
@@ -27,6 +42,31 @@ type parseContext struct {
 	caseInsensitive   map[lexer.TokenType]bool
 	apply             []*contextFieldSet
 	allowTrailing     bool
+	trivia            map[lexer.TokenType]bool
+	triviaCursor      lexer.RawCursor // Trivia before this point has been attached to a node.
+	leftRecursion     map[leftRecursionKey]*leftRecursionMemo
+	cut               bool // Set once a cut has been passed in the current branch.
+	recovering        bool
+	recoverSync       map[string]bool
+	maxErrors         int     // Stop recovering once this many errors have been recorded, if non-zero.
+	errors            []error // Errors recovered from.
+	context           context.Context
+	done              <-chan struct{} // Closed when the parse should be aborted.
+	recursion         int             // Depth of nested structs.
+	maxRecursion      int
+	aborted           *error              // Shared by all branches, set if the parse must be aborted.
+	elide             *[]string           // Overrides the parser's elided token types, if set.
+	stop              *lexer.Position     // Set to the position parsing stopped at, if not nil.
+	resume            *lexer.PeekingLexer // Set to the lexer at the error if parsing fails, if not nil.
+	trimEndPos        bool                // Set EndPos to the end of the last consumed non-elided token.
+	tieBreak          TieBreak            // Policy for choosing between errors at the same depth.
+	diagnostics       *[]Diagnostic       // Receives the warnings of the parse, if not nil.
+	warnings          []Diagnostic        // Reported by WarningHooks in the current branch.
+	ambiguityOut      *[]Ambiguity        // Receives the ambiguities of the parse, if not nil.
+	ambiguities       []Ambiguity         // Detected in the current branch.
+	stack             []RuleFrame         // The productions being parsed, outermost first.
+	recoverPanics     bool                // Convert panics to errors, positioned by the innermost production.
+	def               lexer.Definition    // Positions the ends of nodes and spans.
 }
 
 func newParseContext(lex *lexer.PeekingLexer, lookahead int, caseInsensitive map[lexer.TokenType]bool) parseContext {
@@ -52,10 +92,21 @@ func (p *parseContext) Defer(tokens []lexer.Token, strct reflect.Value, field st
 	p.apply = append(p.apply, &contextFieldSet{tokens, strct, field, fieldValue})
 }
 
+// Return the non-elided tokens consumed since "checkpoint".
+func (p *parseContext) consumedSince(checkpoint lexer.Checkpoint) []lexer.Token {
+	lex := p.PeekingLexer
+	lex.LoadCheckpoint(checkpoint)
+	tokens := make([]lexer.Token, 0, p.Cursor()-lex.Cursor())
+	for lex.Cursor() < p.Cursor() {
+		tokens = append(tokens, *lex.Next())
+	}
+	return tokens
+}
+
 // Apply deferred functions.
 func (p *parseContext) Apply() error {
 	for _, apply := range p.apply {
-		if err := setField(apply.tokens, apply.strct, apply.field, apply.fieldValue); err != nil {
+		if err := setField(p.def, apply.tokens, apply.strct, apply.field, apply.fieldValue); err != nil {
 			return err
 		}
 	}
@@ -67,6 +118,10 @@ func (p *parseContext) Apply() error {
 func (p *parseContext) Accept(branch *parseContext) {
 	p.apply = append(p.apply, branch.apply...)
 	p.PeekingLexer = branch.PeekingLexer
+	p.triviaCursor = branch.triviaCursor
+	p.errors = branch.errors
+	p.warnings = branch.warnings
+	p.ambiguities = branch.ambiguities
 	if branch.deepestErrorDepth >= p.deepestErrorDepth {
 		p.deepestErrorDepth = branch.deepestErrorDepth
 		p.deepestError = branch.deepestError
@@ -78,9 +133,113 @@ func (p *parseContext) Branch() *parseContext {
 	branch := &parseContext{}
 	*branch = *p
 	branch.apply = nil
+	branch.cut = false
 	return branch
 }
 
+// PushRule records that the production "name" is being parsed from "pos", until PopRule is called.
+func (p *parseContext) PushRule(name string, pos lexer.Position) {
+	p.stack = append(p.stack, RuleFrame{Name: name, Pos: pos})
+}
+
+// PopRule removes the innermost production pushed by PushRule.
+//
+// It must be deferred, so that panics can be converted to errors positioned
+// at the start of the innermost production.
+func (p *parseContext) PopRule() {
+	if p.recoverPanics {
+		if r := recover(); r != nil {
+			panic(recoveredPanic{panicError(r, p.stack[len(p.stack)-1].Pos, p.RuleStack())})
+		}
+	}
+	p.stack = p.stack[:len(p.stack)-1]
+}
+
+// RuleStack returns a copy of the productions being parsed, innermost first.
+func (p *parseContext) RuleStack() []RuleFrame {
+	if len(p.stack) == 0 {
+		return nil
+	}
+	out := make([]RuleFrame, len(p.stack))
+	for i, frame := range p.stack {
+		out[len(out)-1-i] = frame
+	}
+	return out
+}
+
+// Warn records warnings to be returned if the current branch is accepted.
+func (p *parseContext) Warn(warnings ...Diagnostic) {
+	// Copy on append, as sibling branches may share the backing array.
+	p.warnings = append(p.warnings[:len(p.warnings):len(p.warnings)], warnings...)
+}
+
+// Recover records err and skips tokens up to and including the next one in "sync".
+//
+// Returns false if there are no synchronisation tokens, the parse has been
+// aborted, or recording err would reach the limit set by MaxErrors().
+func (p *parseContext) Recover(err error, sync map[string]bool) bool {
+	if len(sync) == 0 || p.CheckDone() != nil {
+		return false
+	}
+	if p.maxErrors > 0 && len(p.errors)+1 >= p.maxErrors {
+		return false
+	}
+	// Copy on append, as sibling branches may share the backing array.
+	p.errors = append(p.errors[:len(p.errors):len(p.errors)], p.DeepestError(err))
+	p.deepestError, p.deepestErrorDepth = nil, 0
+	for token := p.Peek(); !token.EOF(); token = p.Peek() {
+		p.Next()
+		if sync[token.Value] {
+			break
+		}
+	}
+	return true
+}
+
+// Returns a copy of the lexer moved to the token at which err occurred.
+func (p *parseContext) lexerAt(err error) lexer.PeekingLexer {
+	if errs, ok := err.(Errors); ok {
+		err = errs[len(errs)-1]
+	}
+	lex := p.PeekingLexer
+	var perr Error
+	if errors.As(err, &perr) {
+		offset := perr.Position().Offset
+		// Rewind if the error occurred before the cursor, eg. when applying captures.
+		for {
+			checkpoint, ok := lex.CheckpointBefore(1)
+			if !ok {
+				break
+			}
+			previous := lex
+			previous.LoadCheckpoint(checkpoint)
+			if previous.Peek().Pos.Offset < offset {
+				break
+			}
+			lex = previous
+		}
+		for token := lex.Peek(); !token.EOF() && token.Pos.Offset < offset; token = lex.Peek() {
+			lex.Next()
+		}
+	}
+	return lex
+}
+
+// CheckDone returns an error if the parse has been aborted, either because
+// its context.Context is done or because the maximum recursion depth was exceeded.
+func (p *parseContext) CheckDone() error {
+	if p.aborted != nil && *p.aborted != nil {
+		return *p.aborted
+	}
+	select {
+	case <-p.done:
+		err := p.context.Err()
+		return &wrappingParseError{err: err, ParseError: *codedErrorf(CodeAborted, p.Peek().Pos, "parse aborted: %s", err.Error())}
+	default:
+		return nil
+	}
+}
+
 func (p *parseContext) MaybeUpdateError(err error) {
 	if p.PeekingLexer.Cursor() >= p.deepestErrorDepth {
 		p.deepestError = err
@@ -88,7 +247,8 @@ func (p *parseContext) MaybeUpdateError(err error) {
 	}
 }
 
-// Stop returns true if parsing should terminate after the given "branch" failed to match.
+// Stop returns true if parsing should terminate after the given "branch" failed to match,
+// either because it passed a cut or progressed beyond the lookahead.
 //
 // Additionally, track the deepest error in the branch - the deeper the error, the more useful it usually is.
 // It could already be the deepest error in the branch (only if deeper than current parent context deepest),
@@ -97,17 +257,31 @@ func (p *parseContext) Stop(err error, branch *parseContext) bool {
 	if branch.deepestErrorDepth > p.deepestErrorDepth {
 		p.deepestError = branch.deepestError
 		p.deepestErrorDepth = branch.deepestErrorDepth
-	} else if branch.PeekingLexer.Cursor() >= p.deepestErrorDepth {
+	} else if branch.PeekingLexer.Cursor() > p.deepestErrorDepth || p.deepestError == nil {
 		p.deepestError = err
 		p.deepestErrorDepth = maxInt(branch.PeekingLexer.Cursor(), branch.deepestErrorDepth)
+	} else if branch.PeekingLexer.Cursor() == p.deepestErrorDepth {
+		p.deepestError = p.breakTie(p.deepestError, err)
 	}
-	if !p.hasInfiniteLookahead() && branch.PeekingLexer.Cursor() > p.PeekingLexer.Cursor()+p.lookahead {
+	if branch.cut || (!p.hasInfiniteLookahead() && branch.PeekingLexer.Cursor() > p.PeekingLexer.Cursor()+p.lookahead) {
 		p.Accept(branch)
 		return true
 	}
 	return false
 }
 
+// Choose between errors at the same depth, "prev" from an earlier alternative and "err" from a later one.
+func (p *parseContext) breakTie(prev, err error) error {
+	switch p.tieBreak {
+	case TieBreakFirst:
+		return prev
+	case TieBreakLast:
+		return err
+	default:
+		return mergeErrors(prev, err)
+	}
+}
+
 func (p *parseContext) hasInfiniteLookahead() bool { return p.lookahead < 0 }
 
 func (p *parseContext) printTrace(n node) func() {
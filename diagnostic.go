@@ -0,0 +1,106 @@
+package participle
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// Severity of a Diagnostic.
+type Severity string
+
+// Diagnostic severities.
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Diagnostic is a JSON-serialisable description of an error, eg. for
+// reporting errors to CI systems and editors.
+type Diagnostic struct {
+	Severity Severity        `json:"severity"`
+	Code     ErrorCode       `json:"code,omitempty"`
+	Range    DiagnosticRange `json:"range"`
+	Message  string          `json:"message"`
+	// Errors wrapped by the error that are positioned elsewhere.
+	Related []DiagnosticRelated `json:"related,omitempty"`
+}
+
+// DiagnosticRelated is additional information about a Diagnostic at another location.
+type DiagnosticRelated struct {
+	Range   DiagnosticRange `json:"range"`
+	Message string          `json:"message"`
+}
+
+// DiagnosticRange is the extent of the input that a Diagnostic applies to.
+type DiagnosticRange struct {
+	Start DiagnosticPosition `json:"start"`
+	End   DiagnosticPosition `json:"end"`
+}
+
+// DiagnosticPosition is a position in the input. Line and Column are 1-based.
+type DiagnosticPosition struct {
+	Filename string `json:"filename,omitempty"`
+	Offset   int    `json:"offset"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+// NewDiagnostic creates a Diagnostic for the input in "span", eg. for a WarningHook.
+func NewDiagnostic(severity Severity, span lexer.Span, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{Severity: severity, Range: diagnosticRangeOf(span), Message: fmt.Sprintf(format, args...)}
+}
+
+// Diagnostics converts an error returned by the parser into a Diagnostic per
+// error, or nil if "err" is nil.
+//
+// Errors, as returned when parsing with Recover(), are converted to one
+// Diagnostic for each error.
+func Diagnostics(err error) []Diagnostic {
+	if err == nil {
+		return nil
+	}
+	var errs Errors
+	if !errors.As(err, &errs) {
+		errs = Errors{err}
+	}
+	out := make([]Diagnostic, 0, len(errs))
+	for _, err := range errs {
+		out = append(out, diagnosticOf(err))
+	}
+	return out
+}
+
+func diagnosticOf(err error) Diagnostic {
+	perr, ok := err.(Error)
+	if !ok {
+		return Diagnostic{Severity: SeverityError, Code: ErrorCodeOf(err), Message: err.Error()}
+	}
+	diagnostic := Diagnostic{
+		Severity: SeverityError,
+		Code:     ErrorCodeOf(err),
+		Range:    diagnosticRangeOf(ErrorRange(err)),
+		Message:  perr.Message(),
+	}
+	pos := perr.Position()
+	for inner := errors.Unwrap(err); inner != nil; inner = errors.Unwrap(inner) {
+		if ierr, ok := inner.(Error); ok && ierr.Position() != pos {
+			pos = ierr.Position()
+			diagnostic.Related = append(diagnostic.Related, DiagnosticRelated{
+				Range:   diagnosticRangeOf(ErrorRange(ierr)),
+				Message: ierr.Message(),
+			})
+		}
+	}
+	return diagnostic
+}
+
+func diagnosticRangeOf(span lexer.Span) DiagnosticRange {
+	return DiagnosticRange{Start: diagnosticPositionOf(span.Start), End: diagnosticPositionOf(span.End)}
+}
+
+func diagnosticPositionOf(pos lexer.Position) DiagnosticPosition {
+	return DiagnosticPosition{Filename: pos.Filename, Offset: pos.Offset, Line: pos.Line, Column: pos.Column}
+}
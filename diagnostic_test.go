@@ -0,0 +1,96 @@
+package participle_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+func TestDiagnostics(t *testing.T) {
+	type grammar struct {
+		Name string `@Ident ":"`
+	}
+	p := mustTestParser[grammar](t)
+
+	_, err := p.ParseString("test.txt", `a b`)
+	diagnostics := participle.Diagnostics(err)
+	data, err := json.Marshal(diagnostics)
+	require.NoError(t, err)
+	require.Equal(t, `[{"severity":"error","code":"unexpected-token","range":{`+
+		`"start":{"filename":"test.txt","offset":2,"line":1,"column":3},`+
+		`"end":{"filename":"test.txt","offset":3,"line":1,"column":4}},`+
+		`"message":"unexpected token \"b\" (expected \":\")"}]`, string(data))
+
+	require.Zero(t, participle.Diagnostics(nil))
+}
+
+func TestDiagnosticsRelated(t *testing.T) {
+	inner := participle.Errorf(lexer.Position{Line: 1, Column: 1}, "declared here")
+	outer := participle.Errors{
+		participle.Wrapf(lexer.Position{Line: 2, Column: 3}, fmt.Errorf("redeclared: %w", inner), "bad"),
+		fmt.Errorf("other"),
+	}
+	require.Equal(t, []participle.Diagnostic{
+		{
+			Severity: participle.SeverityError,
+			Range: participle.DiagnosticRange{
+				Start: participle.DiagnosticPosition{Line: 2, Column: 3},
+				End:   participle.DiagnosticPosition{Line: 2, Column: 3},
+			},
+			Message: "bad: redeclared: 1:1: declared here",
+			Related: []participle.DiagnosticRelated{{
+				Range: participle.DiagnosticRange{
+					Start: participle.DiagnosticPosition{Line: 1, Column: 1},
+					End:   participle.DiagnosticPosition{Line: 1, Column: 1},
+				},
+				Message: "declared here",
+			}},
+		},
+		{Severity: participle.SeverityError, Message: "other"},
+	}, participle.Diagnostics(outer))
+}
+
+type warnedDecl struct {
+	Var  bool   `( @"var" | "let" )`
+	Name string `@Ident`
+}
+
+func (w *warnedDecl) Warnings(span lexer.Span) []participle.Diagnostic {
+	if !w.Var {
+		return nil
+	}
+	return []participle.Diagnostic{participle.NewDiagnostic(participle.SeverityWarning, span, "%q is deprecated, use \"let\"", "var")}
+}
+
+func TestCollectDiagnostics(t *testing.T) {
+	type assignment struct {
+		Decl  *warnedDecl `@@ "="`
+		Value int         `@Int`
+	}
+	type statement struct {
+		Decl       *warnedDecl `  @@ ";"`
+		Assignment *assignment `| @@ ";"`
+	}
+	type grammar struct {
+		Statements []*statement `@@*`
+	}
+	p := mustTestParser[grammar](t, participle.UseLookahead(3))
+
+	var diagnostics []participle.Diagnostic
+	_, err := p.ParseString("", `let a; var b = 1;`, participle.CollectDiagnostics(&diagnostics))
+	require.NoError(t, err)
+	// The warning from the backtracked alternative is discarded.
+	require.Equal(t, []participle.Diagnostic{{
+		Severity: participle.SeverityWarning,
+		Range: participle.DiagnosticRange{
+			Start: participle.DiagnosticPosition{Offset: 7, Line: 1, Column: 8},
+			End:   participle.DiagnosticPosition{Offset: 12, Line: 1, Column: 13},
+		},
+		Message: `"var" is deprecated, use "let"`,
+	}}, diagnostics)
+}
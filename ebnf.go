@@ -2,6 +2,8 @@ package participle
 
 import (
 	"fmt"
+	"reflect"
+	"regexp"
 	"strings"
 )
 
@@ -20,7 +22,7 @@ type ebnfp struct {
 func ebnf(n node) string {
 	outp := []*ebnfp{}
 	switch n.(type) {
-	case *strct:
+	case *strct, *expression, *rule:
 		buildEBNF(true, n, map[node]bool{}, nil, &outp)
 		out := []string{}
 		for _, p := range outp {
@@ -35,6 +37,20 @@ func ebnf(n node) string {
 	}
 }
 
+// Matches the package qualifiers of type arguments in the names of generic types.
+var typeArgQualifier = regexp.MustCompile(`(?:[\w.-]+/)*[\w-]+\.`)
+
+// productionName returns the upper-cased name of a production for type t.
+//
+// Type arguments of generic types are included without package qualifiers, eg. "List[Ident,Comma]".
+func productionName(t reflect.Type) string {
+	name := t.Name()
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i] + typeArgQualifier.ReplaceAllString(name[i:], "")
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
 func buildEBNF(root bool, n node, seen map[node]bool, p *ebnfp, outp *[]*ebnfp) {
 	switch n := n.(type) {
 	case *disjunction:
@@ -52,7 +68,7 @@ func buildEBNF(root bool, n node, seen map[node]bool, p *ebnfp, outp *[]*ebnfp)
 		}
 
 	case *union:
-		name := strings.ToUpper(n.typ.Name()[:1]) + n.typ.Name()[1:]
+		name := productionName(n.typ)
 		if p != nil {
 			p.out += name
 		}
@@ -70,11 +86,34 @@ func buildEBNF(root bool, n node, seen map[node]bool, p *ebnfp, outp *[]*ebnfp)
 		}
 
 	case *custom:
-		name := strings.ToUpper(n.typ.Name()[:1]) + n.typ.Name()[1:]
+		name := productionName(n.typ)
 		p.out += name
 
+	case *expression:
+		name := productionName(n.typ)
+		if p != nil {
+			p.out += name
+		}
+		if seen[n] {
+			return
+		}
+		p = &ebnfp{name: name}
+		*outp = append(*outp, p)
+		seen[n] = true
+		buildEBNF(false, n.operandNode, seen, p, outp)
+		p.out += " (("
+		for i, token := range n.tokens {
+			if i > 0 {
+				p.out += " | "
+			}
+			p.out += fmt.Sprintf("%q", token)
+		}
+		p.out += ") "
+		buildEBNF(false, n.operandNode, seen, p, outp)
+		p.out += ")*"
+
 	case *strct:
-		name := strings.ToUpper(n.typ.Name()[:1]) + n.typ.Name()[1:]
+		name := n.name
 		if p != nil {
 			p.out += name
 		}
@@ -86,17 +125,33 @@ func buildEBNF(root bool, n node, seen map[node]bool, p *ebnfp, outp *[]*ebnfp)
 		*outp = append(*outp, p)
 		buildEBNF(true, n.expr, seen, p, outp)
 
+	case *rule:
+		if p != nil {
+			p.out += n.name
+		}
+		if seen[n] {
+			return
+		}
+		seen[n] = true
+		p = &ebnfp{name: n.name}
+		*outp = append(*outp, p)
+		buildEBNF(true, n.expr, seen, p, outp)
+
 	case *sequence:
 		group := n.next != nil && !root
 		if group {
 			p.out += "("
 		}
-		for n != nil {
-			buildEBNF(false, n.node, seen, p, outp)
-			n = n.next
-			if n != nil {
+		first := true
+		for ; n != nil; n = n.next {
+			if _, ok := n.node.(*recoverDirective); ok {
+				continue
+			}
+			if !first {
 				p.out += " "
 			}
+			first = false
+			buildEBNF(false, n.node, seen, p, outp)
 		}
 		if group {
 			p.out += ")"
@@ -115,9 +170,19 @@ func buildEBNF(root bool, n node, seen map[node]bool, p *ebnfp, outp *[]*ebnfp)
 		p.out += "~"
 		buildEBNF(false, n.node, seen, p, outp)
 
+	case *adjacent:
+		p.out += "^"
+		buildEBNF(false, n.node, seen, p, outp)
+
 	case *literal:
 		p.out += fmt.Sprintf("%q", n.s)
 
+	case *cut:
+		p.out += "=>"
+
+	case *recoverDirective:
+		// Not part of the grammar.
+
 	case *group:
 		if child, ok := n.expr.(*group); ok && child.mode == groupMatchOnce {
 			buildEBNF(false, child.expr, seen, p, outp)
@@ -139,14 +204,27 @@ func buildEBNF(root bool, n node, seen map[node]bool, p *ebnfp, outp *[]*ebnfp)
 			p.out += "*"
 		case groupMatchOneOrMore:
 			p.out += "+"
+		case groupMatchRange:
+			switch {
+			case n.max < 0:
+				p.out += fmt.Sprintf("{%d,}", n.min)
+			case n.max == n.min:
+				p.out += fmt.Sprintf("{%d}", n.min)
+			default:
+				p.out += fmt.Sprintf("{%d,%d}", n.min, n.max)
+			}
 		case groupMatchOnce:
 		}
 
 	case *lookaheadGroup:
+		p.out += "(?"
+		if n.behind {
+			p.out += "<"
+		}
 		if !n.negative {
-			p.out += "(?= "
+			p.out += "= "
 		} else {
-			p.out += "(?! "
+			p.out += "! "
 		}
 		buildEBNF(true, n.expr, seen, p, outp)
 		p.out += ")"
@@ -0,0 +1,552 @@
+package ebnf
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// Parser parses input with a grammar supplied as EBNF at runtime.
+//
+// The result of a parse is a generic tree, where each production that matched
+// is represented by a map of the form:
+//
+//	{"type": "<production>", "pos": lexer.Position, "children": []any{...}}
+//
+// Children are either the values of the tokens matched by literals and token
+// references, or the maps of nested productions. Groups and repetitions do not
+// introduce their own nodes.
+//
+// Unlike parsers built from structs, alternatives are tried with unlimited
+// backtracking. Left recursive grammars are not supported, and are rejected by
+// Compile.
+type Parser struct {
+	root        string
+	productions map[string]*Production
+	literals    map[string]string      // Quoted literals to their values.
+	bounds      map[string][2]int      // Repetition bounds, where a maximum of -1 is unbounded.
+	widths      map[*SubExpression]int // Maximum number of tokens matched by lookbehind assertions.
+	symbols     map[string]lexer.TokenType
+	lex         lexer.Definition
+	elide       []lexer.TokenType
+}
+
+// Compile an EBNF grammar, in the form produced by participle's Parser.String(), into a Parser.
+//
+// The first production is the root of the grammar. Token references such as
+// <ident> match the symbol of "def" with the same name, ignoring case, and
+// tokens of the symbols in "elide" are discarded before parsing.
+func Compile(grammar string, def lexer.Definition, elide ...string) (*Parser, error) {
+	ast, err := ParseString(grammar)
+	if err != nil {
+		return nil, err
+	}
+	if len(ast.Productions) == 0 {
+		return nil, fmt.Errorf("grammar has no productions")
+	}
+	p := &Parser{
+		root:        ast.Productions[0].Production,
+		productions: map[string]*Production{},
+		literals:    map[string]string{},
+		bounds:      map[string][2]int{},
+		widths:      map[*SubExpression]int{},
+		symbols:     map[string]lexer.TokenType{},
+		lex:         def,
+	}
+	for sym, tt := range def.Symbols() {
+		p.symbols[strings.ToLower(sym)] = tt
+	}
+	for _, sym := range elide {
+		tt, ok := def.Symbols()[sym]
+		if !ok {
+			return nil, fmt.Errorf("unknown token type %q", sym)
+		}
+		p.elide = append(p.elide, tt)
+	}
+	for _, production := range ast.Productions {
+		if _, ok := p.productions[production.Production]; ok {
+			return nil, fmt.Errorf("duplicate production %q", production.Production)
+		}
+		p.productions[production.Production] = production
+	}
+	for _, production := range ast.Productions {
+		if err := p.compile(production.Expression); err != nil {
+			return nil, fmt.Errorf("%s: %w", production.Production, err)
+		}
+	}
+	if err := p.checkLeftRecursion(ast.Productions); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Left recursion would recurse forever, so reject it.
+func (p *Parser) checkLeftRecursion(productions []*Production) error {
+	nullable := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for _, production := range productions {
+			if !nullable[production.Production] && p.nullable(production.Expression, nullable) {
+				nullable[production.Production] = true
+				changed = true
+			}
+		}
+	}
+	// 0 is unvisited, 1 is in progress, 2 is done.
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		path = append(path, name)
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("%s: left recursion via %s", name, strings.Join(path[indexOf(path, name):], " -> "))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, next := range p.leftmost(p.productions[name].Expression, nullable, nil) {
+			if err := visit(next, path); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		return nil
+	}
+	for _, production := range productions {
+		if err := visit(production.Production, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func indexOf(path []string, name string) int {
+	for i, n := range path {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns true if "expr" can match without consuming input.
+func (p *Parser) nullable(expr *Expression, nullable map[string]bool) bool {
+	for _, seq := range expr.Alternatives {
+		if p.nullableSequence(seq, nullable) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Parser) nullableSequence(seq *Sequence, nullable map[string]bool) bool {
+	for _, term := range seq.Terms {
+		if !p.nullableTerm(term, nullable) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Parser) nullableTerm(term *Term, nullable map[string]bool) bool {
+	switch {
+	case term.Repetition == "?" || term.Repetition == "*" || strings.HasPrefix(term.Repetition, "{0"):
+		return true
+	case term.Negation || term.Repetition == "!":
+		return false
+	case term.Name != "":
+		return nullable[term.Name]
+	case term.Group != nil:
+		return term.Group.Lookahead != LookaheadAssertionNone || p.nullable(term.Group.Expr, nullable)
+	case term.Cut:
+		return true
+	}
+	return false
+}
+
+// Append the productions that "expr" may invoke before consuming any input to "out".
+func (p *Parser) leftmost(expr *Expression, nullable map[string]bool, out []string) []string {
+	for _, seq := range expr.Alternatives {
+		for _, term := range seq.Terms {
+			switch {
+			case term.Name != "":
+				out = append(out, term.Name)
+			case term.Group != nil:
+				out = p.leftmost(term.Group.Expr, nullable, out)
+			}
+			if !p.nullableTerm(term, nullable) {
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Validate references and precompute literals and repetition bounds.
+func (p *Parser) compile(expr *Expression) error {
+	for _, seq := range expr.Alternatives {
+		for _, term := range seq.Terms {
+			switch {
+			case term.Name != "":
+				if _, ok := p.productions[term.Name]; !ok {
+					return fmt.Errorf("undefined production %q", term.Name)
+				}
+			case term.Literal != "":
+				value, err := strconv.Unquote(term.Literal)
+				if err != nil {
+					return fmt.Errorf("invalid literal %s: %w", term.Literal, err)
+				}
+				p.literals[term.Literal] = value
+			case term.Token != "":
+				if _, ok := p.symbols[strings.ToLower(term.Token)]; !ok {
+					return fmt.Errorf("unknown token type <%s>", term.Token)
+				}
+			case term.Group != nil:
+				if err := p.compile(term.Group.Expr); err != nil {
+					return err
+				}
+				if term.Group.Lookbehind {
+					width, bounded := p.maxWidth(term.Group.Expr, map[string]bool{})
+					if !bounded {
+						return fmt.Errorf("lookbehind must match a bounded number of tokens in %s", term.Group)
+					}
+					p.widths[term.Group] = width
+				}
+			}
+			if strings.HasPrefix(term.Repetition, "{") {
+				bounds, err := parseBounds(term.Repetition)
+				if err != nil {
+					return err
+				}
+				p.bounds[term.Repetition] = bounds
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the maximum number of tokens that "expr" can match, if bounded.
+func (p *Parser) maxWidth(expr *Expression, visiting map[string]bool) (width int, bounded bool) {
+	for _, seq := range expr.Alternatives {
+		w := 0
+		for _, term := range seq.Terms {
+			tw, ok := p.maxTermWidth(term, visiting)
+			if !ok {
+				return 0, false
+			}
+			w += tw
+		}
+		if w > width {
+			width = w
+		}
+	}
+	return width, true
+}
+
+func (p *Parser) maxTermWidth(term *Term, visiting map[string]bool) (width int, bounded bool) {
+	switch {
+	case term.Negation, term.Literal != "", term.Token != "":
+		width = 1
+	case term.Name != "":
+		production, ok := p.productions[term.Name]
+		if !ok {
+			return 0, true // Reported as undefined when compiled.
+		}
+		if visiting[term.Name] {
+			return 0, false // Recursive.
+		}
+		visiting[term.Name] = true
+		defer delete(visiting, term.Name)
+		if width, bounded = p.maxWidth(production.Expression, visiting); !bounded {
+			return 0, false
+		}
+	case term.Group != nil && term.Group.Lookahead == LookaheadAssertionNone:
+		if width, bounded = p.maxWidth(term.Group.Expr, visiting); !bounded {
+			return 0, false
+		}
+	}
+	switch term.Repetition {
+	case "", "?", "!":
+		return width, true
+	case "*", "+":
+		return 0, width == 0
+	}
+	bounds, err := parseBounds(term.Repetition)
+	if err != nil {
+		return 0, true // Reported as invalid when compiled.
+	}
+	if bounds[1] < 0 {
+		return 0, width == 0
+	}
+	return width * bounds[1], true
+}
+
+func parseBounds(repetition string) ([2]int, error) {
+	parts := strings.SplitN(strings.Trim(repetition, "{}"), ",", 2)
+	min, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return [2]int{}, fmt.Errorf("invalid repetition %s", repetition)
+	}
+	max := min
+	if len(parts) == 2 {
+		max = -1
+		if parts[1] != "" {
+			if max, err = strconv.Atoi(parts[1]); err != nil {
+				return [2]int{}, fmt.Errorf("invalid repetition %s", repetition)
+			}
+		}
+	}
+	if max == 0 || (max > 0 && max < min) {
+		return [2]int{}, fmt.Errorf("invalid repetition %s", repetition)
+	}
+	return [2]int{min, max}, nil
+}
+
+// Parse from r into a generic tree.
+func (p *Parser) Parse(filename string, r io.Reader) (map[string]any, error) {
+	lex, err := p.lex.Lex(filename, r)
+	if err != nil {
+		return nil, err
+	}
+	return p.parse(lex)
+}
+
+// ParseString parses s into a generic tree.
+func (p *Parser) ParseString(filename string, s string) (map[string]any, error) {
+	if sd, ok := p.lex.(lexer.StringDefinition); ok {
+		lex, err := sd.LexString(filename, s)
+		if err != nil {
+			return nil, err
+		}
+		return p.parse(lex)
+	}
+	return p.Parse(filename, strings.NewReader(s))
+}
+
+func (p *Parser) parse(lex lexer.Lexer) (map[string]any, error) {
+	peeker, err := lexer.Upgrade(lex, p.elide...)
+	if err != nil {
+		return nil, err
+	}
+	ctx := &dynamicContext{Parser: p, lex: peeker}
+	node, ok := ctx.production(p.root)
+	if ok && !ctx.lex.Peek().EOF() {
+		ctx.fail(nil, "<EOF>")
+		ok = false
+	}
+	if !ok {
+		if ctx.unexpected == nil {
+			ctx.fail(nil, "")
+		}
+		return nil, &participle.UnexpectedTokenError{Unexpected: *ctx.unexpected, Expect: ctx.expected}
+	}
+	return node, nil
+}
+
+// State of a single dynamic parse.
+type dynamicContext struct {
+	*Parser
+	lex        *lexer.PeekingLexer
+	unexpected *lexer.Token // The furthest token that failed to match.
+	expected   string
+	committed  bool // Set when a sequence fails after a cut, failing the parse.
+}
+
+// Record a failure to match "expected" at the next token.
+func (d *dynamicContext) fail(term *Term, expected string) {
+	if term != nil {
+		expected = term.String()
+	}
+	token := d.lex.Peek()
+	if d.unexpected == nil || token.Pos.Offset > d.unexpected.Pos.Offset {
+		d.unexpected = token
+		d.expected = expected
+	}
+}
+
+func (d *dynamicContext) production(name string) (map[string]any, bool) {
+	pos := d.lex.Peek().Pos
+	children, ok := d.expression(d.productions[name].Expression, []any{})
+	if !ok {
+		// Report the production rather than its first term if it failed immediately.
+		if d.unexpected != nil && d.unexpected.Pos.Offset == pos.Offset {
+			d.expected = name
+		}
+		return nil, false
+	}
+	return map[string]any{"type": name, "pos": pos, "children": children}, true
+}
+
+func (d *dynamicContext) expression(expr *Expression, children []any) ([]any, bool) {
+	for _, seq := range expr.Alternatives {
+		if out, ok := d.sequence(seq, children); ok || d.committed {
+			return out, ok
+		}
+	}
+	return children, false
+}
+
+func (d *dynamicContext) sequence(seq *Sequence, children []any) ([]any, bool) {
+	checkpoint := d.lex.MakeCheckpoint()
+	out := children
+	cut := false
+	for _, term := range seq.Terms {
+		var ok bool
+		if out, ok = d.term(term, out); !ok {
+			d.committed = d.committed || cut
+			d.lex.LoadCheckpoint(checkpoint)
+			return children[:len(children):len(children)], false
+		}
+		cut = cut || term.Cut
+	}
+	return out, true
+}
+
+func (d *dynamicContext) term(term *Term, children []any) ([]any, bool) {
+	min, max := 1, 1
+	switch term.Repetition {
+	case "":
+		return d.atom(term, children)
+	case "!":
+		cursor := d.lex.Cursor()
+		out, ok := d.atom(term, children)
+		if ok && d.lex.Cursor() == cursor {
+			d.fail(term, "")
+			return children, false
+		}
+		return out, ok
+	case "?":
+		min = 0
+	case "*":
+		min, max = 0, -1
+	case "+":
+		max = -1
+	default:
+		bounds := d.bounds[term.Repetition]
+		min, max = bounds[0], bounds[1]
+	}
+	matches := 0
+	for ; max < 0 || matches < max; matches++ {
+		checkpoint := d.lex.MakeCheckpoint()
+		out, ok := d.atom(term, children)
+		if !ok {
+			if d.committed {
+				return children, false
+			}
+			d.lex.LoadCheckpoint(checkpoint)
+			break
+		}
+		children = out
+		if d.lex.Cursor() == checkpoint.Cursor() {
+			matches++
+			break
+		}
+	}
+	if matches < min {
+		return children, false
+	}
+	return children, true
+}
+
+// Match a term, ignoring its repetition.
+func (d *dynamicContext) atom(term *Term, children []any) ([]any, bool) {
+	if d.committed {
+		return children, false
+	}
+	// Elided tokens between the previous and next tokens are skipped over by Peek.
+	if term.Adjacent && d.lex.RawPeek() != d.lex.Peek() {
+		d.fail(nil, term.String())
+		return children, false
+	}
+	if !term.Negation {
+		return d.primary(term, children)
+	}
+	token := d.lex.Peek()
+	checkpoint, committed := d.lex.MakeCheckpoint(), d.committed
+	_, matched := d.primary(term, nil)
+	d.lex.LoadCheckpoint(checkpoint)
+	d.committed = committed
+	if matched || token.EOF() {
+		d.fail(term, "")
+		return children, false
+	}
+	d.lex.Next()
+	return append(children, token.Value), true
+}
+
+func (d *dynamicContext) primary(term *Term, children []any) ([]any, bool) {
+	switch {
+	case term.Name != "":
+		node, ok := d.production(term.Name)
+		if !ok {
+			return children, false
+		}
+		return append(children, node), true
+
+	case term.Literal != "":
+		token := d.lex.Peek()
+		if token.EOF() || token.Value != d.literals[term.Literal] {
+			d.fail(nil, term.Literal)
+			return children, false
+		}
+		d.lex.Next()
+		return append(children, token.Value), true
+
+	case term.Token != "":
+		token := d.lex.Peek()
+		if token.Type != d.symbols[strings.ToLower(term.Token)] {
+			d.fail(nil, "<"+term.Token+">")
+			return children, false
+		}
+		d.lex.Next()
+		return append(children, token.Value), true
+
+	case term.Group != nil:
+		if term.Group.Lookahead == LookaheadAssertionNone {
+			return d.expression(term.Group.Expr, children)
+		}
+		checkpoint, committed := d.lex.MakeCheckpoint(), d.committed
+		var ok bool
+		if term.Group.Lookbehind {
+			ok = d.lookbehind(term.Group, checkpoint)
+		} else {
+			_, ok = d.expression(term.Group.Expr, nil)
+		}
+		d.lex.LoadCheckpoint(checkpoint)
+		d.committed = committed
+		if ok != (term.Group.Lookahead == LookaheadAssertionPositive) {
+			d.fail(nil, term.Group.String())
+			return children, false
+		}
+		return children, true
+
+	case term.Cut:
+		return children, true
+	}
+	panic("??")
+}
+
+// Match the expression of a lookbehind assertion against runs of increasing
+// length, up to its maximum width, of the tokens preceding "checkpoint".
+//
+// The expression must match the run exactly, ending at "checkpoint".
+func (d *dynamicContext) lookbehind(group *SubExpression, checkpoint lexer.Checkpoint) bool {
+	committed := d.committed
+	for n := 0; n <= d.widths[group]; n++ {
+		d.lex.LoadCheckpoint(checkpoint)
+		start, ok := d.lex.CheckpointBefore(n)
+		if !ok {
+			return false
+		}
+		d.lex.LoadCheckpoint(start)
+		d.committed = committed
+		if _, ok := d.expression(group.Expr, nil); ok && d.lex.Cursor() == checkpoint.Cursor() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package ebnf
+
+import (
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+func TestCompile(t *testing.T) {
+	p, err := Compile(`
+Config = Entry* .
+Entry = <ident> "=" => Value ";" .
+Value = <int> | <string> | List .
+List = "[" (Value ("," Value)*)? "]" .
+`, lexer.TextScannerLexer)
+	require.NoError(t, err)
+	actual, err := p.ParseString("", `a = 1; b = ["x", 2];`)
+	require.NoError(t, err)
+	pos := func(offset, column int) lexer.Position {
+		return lexer.Position{Offset: offset, Line: 1, Column: column}
+	}
+	require.Equal(t, map[string]any{"type": "Config", "pos": pos(0, 1), "children": []any{
+		map[string]any{"type": "Entry", "pos": pos(0, 1), "children": []any{
+			"a", "=", map[string]any{"type": "Value", "pos": pos(4, 5), "children": []any{"1"}}, ";",
+		}},
+		map[string]any{"type": "Entry", "pos": pos(7, 8), "children": []any{
+			"b", "=", map[string]any{"type": "Value", "pos": pos(11, 12), "children": []any{
+				map[string]any{"type": "List", "pos": pos(11, 12), "children": []any{
+					"[",
+					map[string]any{"type": "Value", "pos": pos(12, 13), "children": []any{`"x"`}},
+					",",
+					map[string]any{"type": "Value", "pos": pos(17, 18), "children": []any{"2"}},
+					"]",
+				}},
+			}}, ";",
+		}},
+	}}, actual)
+
+	_, err = p.ParseString("", `a = 1; b = [1 2];`)
+	require.EqualError(t, err, `1:15: unexpected token "2" (expected ",")`)
+	_, err = p.ParseString("", `a = ;`)
+	require.EqualError(t, err, `1:5: unexpected token ";" (expected Value)`)
+}
+
+func TestCompileRepetition(t *testing.T) {
+	p, err := Compile(`Address = <int> (":" <int>){3} Rest .
+Rest = ~";"* (?= ";") ";" .`, lexer.TextScannerLexer)
+	require.NoError(t, err)
+	actual, err := p.ParseString("", `10:0:0:1 a b ;`)
+	require.NoError(t, err)
+	require.Equal(t, []any{"10", ":", "0", ":", "0", ":", "1"}, actual["children"].([]any)[:7])
+	rest := actual["children"].([]any)[7].(map[string]any)
+	require.Equal(t, []any{"a", "b", ";"}, rest["children"].([]any))
+}
+
+func TestCompileErrors(t *testing.T) {
+	_, err := Compile(`A = B .`, lexer.TextScannerLexer)
+	require.EqualError(t, err, `A: undefined production "B"`)
+	_, err = Compile(`A = <number> .`, lexer.TextScannerLexer)
+	require.EqualError(t, err, `A: unknown token type <number>`)
+	_, err = Compile(`A = <int>{2,1} .`, lexer.TextScannerLexer)
+	require.EqualError(t, err, `A: invalid repetition {2,1}`)
+	_, err = Compile(`A = <int> . A = <ident> .`, lexer.TextScannerLexer)
+	require.EqualError(t, err, `duplicate production "A"`)
+	_, err = Compile(`Expr = Expr "+" <int> | <int> .`, lexer.TextScannerLexer)
+	require.EqualError(t, err, `Expr: left recursion via Expr -> Expr`)
+	_, err = Compile(`A = "x"? (B | "y") . B = (?= "z") A* "b" .`, lexer.TextScannerLexer)
+	require.EqualError(t, err, `A: left recursion via A -> B -> A`)
+}
+
+func TestCompileLookaheadDoesNotCommit(t *testing.T) {
+	p, err := Compile(`A = (?! "x" => "y") "x" "z" | "x" .`, lexer.TextScannerLexer)
+	require.NoError(t, err)
+	_, err = p.ParseString("", `x`)
+	require.NoError(t, err)
+	p, err = Compile(`A = ~("x" => "y") "z" | "x" .`, lexer.TextScannerLexer)
+	require.NoError(t, err)
+	_, err = p.ParseString("", `x`)
+	require.NoError(t, err)
+}
+
+func TestCompileParserGrammar(t *testing.T) {
+	p, err := Compile(parser.String(), lexer.TextScannerLexer)
+	require.NoError(t, err)
+	actual, err := p.ParseString("", `A = "a" B* . B = <ident>{1,2} => "b" .`)
+	require.NoError(t, err)
+	require.Equal(t, "EBNF", actual["type"])
+	require.Equal(t, 2, len(actual["children"].([]any)))
+}
+
+func TestCompileAdjacent(t *testing.T) {
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Int", `\d+`},
+		{"Ident", `[a-z]+`},
+		{"Whitespace", `\s+`},
+	})
+	p, err := Compile(`Duration = <int> ^<ident> .`, def, "Whitespace")
+	require.NoError(t, err)
+	_, err = p.ParseString("", `10ms`)
+	require.NoError(t, err)
+	_, err = p.ParseString("", `10 ms`)
+	require.EqualError(t, err, `1:4: unexpected token "ms" (expected ^<ident>)`)
+}
+
+func TestCompileLookbehind(t *testing.T) {
+	type part struct {
+		Unary  bool   `  (?<! Int | ")") @"-"`
+		Binary bool   `| (?<= Int | ")") @"-"`
+		Other  string `| @(Int | "(" | ")")`
+	}
+	type grammar struct {
+		Parts []part `@@*`
+	}
+	grammarEBNF := participle.MustBuild[grammar]().String()
+	p, err := Compile(grammarEBNF, lexer.TextScannerLexer)
+	require.NoError(t, err)
+	actual, err := p.ParseString("", `-1 - (2 - -3)`)
+	require.NoError(t, err)
+	alternatives := []string{}
+	for _, child := range actual["children"].([]any) {
+		part := child.(map[string]any)
+		alternatives = append(alternatives, part["children"].([]any)[0].(string))
+	}
+	require.Equal(t, []string{"-", "1", "-", "(", "2", "-", "-", "3", ")"}, alternatives)
+
+	// Unary minus can't follow an operand.
+	p, err = Compile(`Expr = ("-" | (?<! <int>) "~")* <int> ("-" <int>)* .`, lexer.TextScannerLexer)
+	require.NoError(t, err)
+	_, err = p.ParseString("", `~~1-2`)
+	require.NoError(t, err)
+
+	_, err = Compile(`A = ((?<= "(" <int>*) <int>)* .`, lexer.TextScannerLexer)
+	require.EqualError(t, err, `A: lookbehind must match a bounded number of tokens in (?<="(" <int>*)`)
+}
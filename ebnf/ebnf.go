@@ -5,9 +5,9 @@
 //      EBNF = Production* .
 //      Production = <ident> "=" Expression "." .
 //      Expression = Sequence ("|" Sequence)* .
-//      SubExpression = "(" ("?!" | "?=")? Expression ")" .
+//      SubExpression = "(" ("?" "<"? ("!" | "="))? Expression ")" .
 //      Sequence = Term+ .
-//      Term = "~"? (<ident> | <string> | ("<" <ident> ">") | SubExpression) ("*" | "+" | "?" | "!")? .
+//      Term = "^"? "~"? (<ident> | <string> | ("<" <ident> ">") | SubExpression | "=" ">") ("*" | "+" | "?" | "!" | "{" <int> ("," <int>?)? "}")? .
 package ebnf
 
 import (
@@ -28,28 +28,39 @@ var _ Node = &Term{}
 
 // Term in the EBNF grammar.
 type Term struct {
+	Adjacent bool `@("^")?`
 	Negation bool `@("~")?`
 
 	Name    string         `(   @Ident`
 	Literal string         `  | @String`
 	Token   string         `  | "<" @Ident ">"`
-	Group   *SubExpression `  | @@ )`
+	Group   *SubExpression `  | @@`
+	Cut     bool           `  | @("=" ">") )`
 
-	Repetition string `@("*" | "+" | "?" | "!")?`
+	Repetition string `@("*" | "+" | "?" | "!" | "{" Int ("," Int?)? "}")?`
 }
 
 func (t *Term) sealed() {}
 
 func (t *Term) String() string {
+	prefix := ""
+	if t.Adjacent {
+		prefix += "^"
+	}
+	if t.Negation {
+		prefix += "~"
+	}
 	switch {
 	case t.Name != "":
-		return t.Name + t.Repetition
+		return prefix + t.Name + t.Repetition
 	case t.Literal != "":
-		return t.Literal + t.Repetition
+		return prefix + t.Literal + t.Repetition
 	case t.Token != "":
-		return "<" + t.Token + ">" + t.Repetition
+		return prefix + "<" + t.Token + ">" + t.Repetition
 	case t.Group != nil:
-		return t.Group.String() + t.Repetition
+		return prefix + t.Group.String() + t.Repetition
+	case t.Cut:
+		return "=>" + t.Repetition
 	default:
 		panic("??")
 	}
@@ -82,9 +93,13 @@ const (
 var _ Node = &SubExpression{}
 
 // SubExpression is an expression inside parentheses ( ... )
+//
+// If Lookbehind is set, Lookahead is the kind of assertion made about the
+// preceding tokens rather than the following ones.
 type SubExpression struct {
-	Lookahead LookaheadAssertion `"(" ("?" @("!" | "="))?`
-	Expr      *Expression        `@@ ")"`
+	Lookbehind bool               `"(" ("?" @"<"?`
+	Lookahead  LookaheadAssertion `@("!" | "="))?`
+	Expr       *Expression        `@@ ")"`
 }
 
 func (s *SubExpression) sealed() {}
@@ -92,7 +107,11 @@ func (s *SubExpression) sealed() {}
 func (s *SubExpression) String() string {
 	out := "("
 	if s.Lookahead != LookaheadAssertionNone {
-		out += "?" + string(s.Lookahead)
+		out += "?"
+		if s.Lookbehind {
+			out += "<"
+		}
+		out += string(s.Lookahead)
 	}
 	out += s.Expr.String() + ")"
 	return out
@@ -1,7 +1,9 @@
 package participle
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/alecthomas/participle/v2/lexer"
 )
@@ -21,22 +23,459 @@ type Error interface {
 
 // FormatError formats an error in the form "[<filename>:][<line>:<pos>:] <message>"
 func FormatError(err Error) string {
-	msg := ""
-	pos := err.Position()
+	if prefix := positionPrefix(err.Position()); prefix != "" {
+		return prefix + " " + err.Message()
+	}
+	return err.Message()
+}
+
+// The "[<filename>:][<line>:<pos>:]" prefix of a formatted error.
+func positionPrefix(pos lexer.Position) string {
+	prefix := ""
 	if pos.Filename != "" {
-		msg += pos.Filename + ":"
+		prefix += pos.Filename + ":"
 	}
 	if pos.Line != 0 || pos.Column != 0 {
-		msg += fmt.Sprintf("%d:%d:", pos.Line, pos.Column)
+		prefix += fmt.Sprintf("%d:%d:", pos.Line, pos.Column)
+	}
+	return prefix
+}
+
+// FormatErrorWithSource formats an error like FormatError, followed by the
+// line of "source" containing the error, with a caret at the position of the
+// error and the rest of its range (see ErrorRange) underlined, eg.
+//
+//	1:5: unexpected token "+" (expected <ident>)
+//	a = + b
+//	    ^
+//
+// "source" must be the input that was parsed. If the error position is not
+// within "source", only the FormatError form is returned.
+func FormatErrorWithSource(err Error, source string) string {
+	msg := FormatError(err)
+	pos := err.Position()
+	if pos.Line == 0 || pos.Offset < 0 || pos.Offset > len(source) {
+		return msg
 	}
-	if msg != "" {
-		msg += " " + err.Message()
+	start := strings.LastIndexByte(source[:pos.Offset], '\n') + 1
+	end := strings.IndexByte(source[pos.Offset:], '\n')
+	if end == -1 {
+		end = len(source)
 	} else {
-		msg = err.Message()
+		end += pos.Offset
+	}
+	line := strings.TrimSuffix(source[start:end], "\r")
+	end = start + len(line)
+	if pos.Offset > end {
+		return msg
+	}
+	// Underline the part of the range on this line.
+	from, to := pos.Offset, pos.Offset
+	if r := ErrorRange(err); r.Start.Offset <= pos.Offset && r.End.Offset >= pos.Offset {
+		from, to = r.Start.Offset, r.End.Offset
+	}
+	marker := &strings.Builder{}
+	for i, rn := range line {
+		offset := start + i
+		switch {
+		case offset == pos.Offset:
+			marker.WriteByte('^')
+		case offset >= from && offset < to:
+			marker.WriteByte('~')
+		case offset > pos.Offset:
+		case rn == '\t':
+			// Preserve tabs so the marker lines up regardless of tab width.
+			marker.WriteByte('\t')
+		default:
+			marker.WriteByte(' ')
+		}
+	}
+	if pos.Offset == end {
+		marker.WriteByte('^')
+	}
+	return msg + "\n" + line + "\n" + marker.String()
+}
+
+// ErrorCode is a stable, machine-readable identifier for the kind of a parse error.
+type ErrorCode string
+
+// Error codes reported by ErrorCodeOf.
+const (
+	// CodeUnexpectedToken is reported when a token could not be matched by the grammar.
+	CodeUnexpectedToken ErrorCode = "unexpected-token"
+	// CodeIncompleteInput is reported when the input ended before the grammar was satisfied.
+	CodeIncompleteInput ErrorCode = "incomplete-input"
+	// CodeLexer is reported when the input could not be tokenised.
+	CodeLexer ErrorCode = "lexer-error"
+	// CodeTooManyIterations is reported when a repetition exceeds MaxIterations.
+	CodeTooManyIterations ErrorCode = "too-many-iterations"
+	// CodeTooFewMatches is reported when a repetition matches fewer times than required.
+	CodeTooFewMatches ErrorCode = "too-few-matches"
+	// CodeEmptyMatch is reported when a sub-expression that must not be empty matches nothing.
+	CodeEmptyMatch ErrorCode = "empty-match"
+	// CodeMaxRecursion is reported when the depth set by MaxRecursion() is exceeded.
+	CodeMaxRecursion ErrorCode = "max-recursion"
+	// CodeAborted is reported when the parse is aborted by its context.Context.
+	CodeAborted ErrorCode = "aborted"
+	// CodeInvalidValue is reported when a captured value can not be converted or mapped.
+	CodeInvalidValue ErrorCode = "invalid-value"
+	// CodeInternal is reported when the parser panicked, eg. due to a bug in a
+	// grammar or in a Capture implementation. See PropagatePanics.
+	CodeInternal ErrorCode = "internal-error"
+)
+
+// ErrorCodeOf returns the code of the first error in the chain of "err" that
+// has one, or "" if none do.
+//
+// For Errors, the code of the first error is returned.
+func ErrorCodeOf(err error) ErrorCode {
+	for err != nil {
+		switch e := err.(type) {
+		case *UnexpectedTokenError:
+			if e.Unexpected.EOF() {
+				return CodeIncompleteInput
+			}
+			return CodeUnexpectedToken
+		case *ParseError:
+			if e.Code != "" {
+				return e.Code
+			}
+		case *wrappingParseError:
+			if e.Code != "" {
+				return e.Code
+			}
+		case *lexer.Error:
+			return CodeLexer
+		case Errors:
+			if len(e) == 0 {
+				return ""
+			}
+			err = e[0]
+			continue
+		}
+		err = errors.Unwrap(err)
+	}
+	return ""
+}
+
+// IsIncomplete returns true if "err" was caused by the input ending while the
+// grammar still expected more, such as inside an unclosed group.
+//
+// This is also the case if the reported error is elsewhere, but parsing
+// backtracked from an attempt that reached the end of the input, eg. for
+// "f(a," with the grammar `@Ident "(" (@Ident ("," @Ident)*)? ")"`.
+//
+// This is useful for REPLs, which can prompt for a continuation line rather
+// than reporting an error.
+func IsIncomplete(err error) bool {
+	for err != nil {
+		switch e := err.(type) {
+		case *UnexpectedTokenError:
+			if e.incomplete || e.Unexpected.EOF() {
+				return true
+			}
+		case *ParseError:
+			if e.incomplete || e.Code == CodeIncompleteInput {
+				return true
+			}
+		case *wrappingParseError:
+			if e.incomplete || e.Code == CodeIncompleteInput {
+				return true
+			}
+		case Errors:
+			if len(e) == 0 {
+				return false
+			}
+			err = e[0]
+			continue
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
+
+// Flag "err" as being caused by incomplete input, see IsIncomplete.
+func markIncomplete(err error) {
+	switch e := err.(type) {
+	case *UnexpectedTokenError:
+		e.incomplete = true
+	case *ParseError:
+		e.incomplete = true
+	case *wrappingParseError:
+		e.incomplete = true
+	}
+}
+
+// Failure describes a parse error to an ErrorFormatter.
+type Failure struct {
+	// The original error. Its Message() is the default message.
+	Err  Error
+	Pos  lexer.Position
+	Code ErrorCode
+	// The unexpected token, if the error is an UnexpectedTokenError.
+	Unexpected *lexer.Token
+	// The terminals that would have been accepted in place of Unexpected, if known.
+	Expected []string
+	// The productions that were being parsed, innermost first, if known.
+	Stack []RuleFrame
+}
+
+// ErrorFormatter produces the messages of errors returned by the parser.
+//
+// See FormatErrors.
+type ErrorFormatter interface {
+	// FormatError returns the message for a failure, without positional information.
+	FormatError(failure Failure) string
+}
+
+// ErrorFormatterFunc is a function implementing ErrorFormatter.
+type ErrorFormatterFunc func(failure Failure) string
+
+func (f ErrorFormatterFunc) FormatError(failure Failure) string { return f(failure) } // nolint: golint
+
+// Replace the messages of "err", or of each error in it if it is an Errors, with those from "formatter".
+//
+// The replaced errors are still available through errors.Unwrap().
+func formatErrors(formatter ErrorFormatter, err error) error {
+	switch err := err.(type) {
+	case Errors:
+		out := make(Errors, len(err))
+		for i, e := range err {
+			out[i] = formatErrors(formatter, e)
+		}
+		return out
+	case Error:
+		failure := Failure{Err: err, Pos: err.Position(), Code: ErrorCodeOf(err), Stack: RuleStack(err)}
+		var uerr *UnexpectedTokenError
+		if errors.As(err, &uerr) {
+			failure.Unexpected = &uerr.Unexpected
+			failure.Expected = uerr.Expected()
+		}
+		msg := formatter.FormatError(failure)
+		return &wrappingParseError{err: err, ParseError: ParseError{Msg: msg, Pos: failure.Pos, Code: failure.Code, Range: ErrorRange(err), stack: failure.Stack}}
+	default:
+		return err
+	}
+}
+
+// ErrorRange returns the extent of the input that "err" applies to, so that
+// eg. editors can underline it.
+//
+// For an UnexpectedTokenError this is the unexpected token. For errors that
+// apply to a partial match, such as a repetition that matched too few times or
+// an error returned by a ParsedHook, it covers the partial match. Otherwise the
+// range is empty, starting and ending at the position of the error.
+//
+// For Errors, the range of the first error is returned.
+func ErrorRange(err error) lexer.Span {
+	for e := err; e != nil; {
+		switch ee := e.(type) {
+		case *UnexpectedTokenError:
+			return lexer.SpanOf([]lexer.Token{ee.Unexpected})
+		case *ParseError:
+			if ee.Range != (lexer.Span{}) {
+				return ee.Range
+			}
+		case *wrappingParseError:
+			if ee.Range != (lexer.Span{}) {
+				return ee.Range
+			}
+		case Errors:
+			if len(ee) == 0 {
+				return lexer.Span{}
+			}
+			return ErrorRange(ee[0])
+		}
+		e = errors.Unwrap(e)
+	}
+	if perr, ok := err.(Error); ok {
+		return lexer.Span{Start: perr.Position(), End: perr.Position()}
+	}
+	return lexer.Span{}
+}
+
+// MessageCatalog translates or rephrases the messages of errors generated by the parser.
+//
+// See Messages.
+type MessageCatalog interface {
+	// Translate returns the replacement for an error message format string,
+	// such as "unexpected token %q (expected %s)", or "" to keep the original.
+	//
+	// The replacement is formatted with the same arguments as the original.
+	Translate(code ErrorCode, format string) string
+}
+
+// MessageMap is a MessageCatalog mapping format strings to their replacements.
+type MessageMap map[string]string
+
+func (m MessageMap) Translate(code ErrorCode, format string) string { return m[format] } // nolint: golint
+
+// Translate the messages of "err", or of each error in it if it is an Errors, with "catalog".
+func translateErrors(catalog MessageCatalog, err error) error {
+	switch err := err.(type) {
+	case Errors:
+		out := make(Errors, len(err))
+		for i, e := range err {
+			out[i] = translateErrors(catalog, e)
+		}
+		return out
+	case *UnexpectedTokenError:
+		format, args := err.messageFormat()
+		code := ErrorCodeOf(err)
+		if translated := catalog.Translate(code, format); translated != "" {
+			msg := fmt.Sprintf(translated, args...)
+			return &wrappingParseError{err: err, ParseError: ParseError{Msg: msg, Pos: err.Position(), Code: code, Range: ErrorRange(err), stack: err.stack}}
+		}
+	case *ParseError:
+		if err.format == "" {
+			break
+		}
+		if translated := catalog.Translate(err.Code, err.format); translated != "" {
+			out := *err
+			out.Msg = err.prefix + fmt.Sprintf(translated, err.args...)
+			return &out
+		}
+	case *wrappingParseError:
+		if err.format == "" {
+			break
+		}
+		if translated := catalog.Translate(err.Code, err.format); translated != "" {
+			out := *err
+			out.Msg = err.prefix + fmt.Sprintf(translated, err.args...)
+			return &out
+		}
+	case *lexer.Error:
+		format, args := err.MessageFormat()
+		if format == "" {
+			break
+		}
+		if translated := catalog.Translate(CodeLexer, format); translated != "" {
+			out := *err
+			out.Msg = fmt.Sprintf(translated, args...)
+			return &out
+		}
+	}
+	return err
+}
+
+// The format, arguments and any prefix of the message of "err", if known.
+func messageFormat(err Error) (format string, args []interface{}, prefix string) {
+	switch err := err.(type) {
+	case *UnexpectedTokenError:
+		format, args = err.messageFormat()
+	case *ParseError:
+		format, args, prefix = err.format, err.args, err.prefix
+	case *wrappingParseError:
+		format, args, prefix = err.format, err.args, err.prefix
+	case *lexer.Error:
+		format, args = err.MessageFormat()
+	}
+	return format, args, prefix
+}
+
+// RuleFrame is a production that was being parsed when an error occurred.
+type RuleFrame struct {
+	// The description of the production from GrammarNamer or a `parser_name`
+	// tag, otherwise its name in the EBNF.
+	Name string
+	// The position at which the production started.
+	Pos lexer.Position
+}
+
+func (r RuleFrame) String() string { return fmt.Sprintf("%s at %s", r.Name, r.Pos) }
+
+// RuleStack returns the productions that were being parsed when "err"
+// occurred, innermost first, or nil if they are not known.
+//
+// For Errors, the stack of the first error is returned.
+func RuleStack(err error) []RuleFrame {
+	for err != nil {
+		switch e := err.(type) {
+		case *UnexpectedTokenError:
+			return e.stack
+		case *ParseError:
+			if e.stack != nil {
+				return e.stack
+			}
+		case *wrappingParseError:
+			if e.stack != nil {
+				return e.stack
+			}
+		case Errors:
+			if len(e) == 0 {
+				return nil
+			}
+			err = e[0]
+			continue
+		}
+		err = errors.Unwrap(err)
 	}
-	return msg
+	return nil
 }
 
+// Add up to "frames" productions from the rule stack of "err", or of each error in it if it is an Errors, to its message.
+func addErrorContext(frames int, err error) error {
+	switch e := err.(type) {
+	case Errors:
+		out := make(Errors, len(e))
+		for i, err := range e {
+			out[i] = addErrorContext(frames, err)
+		}
+		return out
+	case Error:
+		stack := RuleStack(e)
+		if len(stack) == 0 {
+			return err
+		}
+		if len(stack) > frames {
+			stack = stack[:frames]
+		}
+		msg := e.Message() + ", while parsing " + stack[0].String()
+		for _, frame := range stack[1:] {
+			msg += " in " + frame.String()
+		}
+		return &wrappingParseError{err: err, ParseError: ParseError{Msg: msg, Pos: e.Position(), Code: ErrorCodeOf(err), Range: ErrorRange(err), stack: RuleStack(err)}}
+	}
+	return err
+}
+
+// The value of a panic in the parser after it has been converted to an error.
+type recoveredPanic struct{ err Error }
+
+// Convert the value "r" of a panic at "pos" within the productions "stack" to an error.
+func panicError(r interface{}, pos lexer.Position, stack []RuleFrame) Error {
+	if p, ok := r.(recoveredPanic); ok {
+		return p.err
+	}
+	var (
+		msg string
+		err error
+	)
+	switch r := r.(type) {
+	case Error:
+		pos, msg, err = r.Position(), r.Message(), r
+	case error:
+		msg, err = "panic: "+r.Error(), r
+	default:
+		msg, err = fmt.Sprintf("panic: %v", r), fmt.Errorf("%v", r)
+	}
+	return &wrappingParseError{err: err, ParseError: ParseError{Msg: msg, Pos: pos, Code: CodeInternal, stack: stack}}
+}
+
+// Errors is returned when parsing with Recover() encounters one or more errors.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the individual errors.
+func (e Errors) Unwrap() []error { return e }
+
 // UnexpectedTokenError is returned by Parse when an unexpected token is encountered.
 //
 // This is useful for composing parsers in order to detect when a sub-parser has terminated.
@@ -44,28 +483,128 @@ type UnexpectedTokenError struct {
 	Unexpected lexer.Token
 	Expect     string
 	expectNode node // Usable instead of Expect, delays creating the string representation until necessary
+	// The node from which to collect expected terminals, including those of
+	// preceding nodes that matched without consuming input. Defaults to expectNode.
+	expectedFrom node
+	// A preceding node that ended at the unexpected token, whose match could
+	// have continued there, eg. a repetition.
+	continues node
+	// Errors from competing alternatives that failed on the same token.
+	alternatives []*UnexpectedTokenError
+	stack        []RuleFrame // Innermost first.
+	incomplete   bool        // See IsIncomplete.
 }
 
 func (u *UnexpectedTokenError) Error() string { return FormatError(u) }
 
 func (u *UnexpectedTokenError) Message() string { // nolint: golint
-	var expected string
-	if u.expectNode != nil {
-		expected = fmt.Sprintf(" (expected %s)", u.expectNode)
-	} else if u.Expect != "" {
-		expected = fmt.Sprintf(" (expected %s)", u.Expect)
+	format, args := u.messageFormat()
+	return fmt.Sprintf(format, args...)
+}
+
+func (u *UnexpectedTokenError) messageFormat() (string, []interface{}) {
+	if expected := u.expectation(); expected != "" {
+		return "unexpected token %q (expected %s)", []interface{}{u.Unexpected, expected}
 	}
-	return fmt.Sprintf("unexpected token %q%s", u.Unexpected, expected)
+	return "unexpected token %q", []interface{}{u.Unexpected}
+}
+
+// The description of what was expected, or "" if it is not known.
+func (u *UnexpectedTokenError) expectation() string {
+	var expected []string
+	for _, alternative := range u.all() {
+		expect := alternative.Expect
+		if alternative.expectNode != nil {
+			expect = alternative.expectNode.String()
+		}
+		if expect != "" && !containsString(expected, expect) {
+			expected = append(expected, expect)
+		}
+	}
+	return strings.Join(expected, " or ")
 }
 func (u *UnexpectedTokenError) Position() lexer.Position { return u.Unexpected.Pos } // nolint: golint
 
+// Expected returns the terminals that would have been accepted in place of the
+// unexpected token, in the form they are written in EBNF, eg. `")"` or `<ident>`.
+//
+// Nil is returned if the expectation is not known.
+func (u *UnexpectedTokenError) Expected() []string {
+	var out []string
+	for _, alternative := range u.all() {
+		for _, terminal := range alternative.expected() {
+			if !containsString(out, terminal) {
+				out = append(out, terminal)
+			}
+		}
+	}
+	return out
+}
+
+func (u *UnexpectedTokenError) expected() []string {
+	var out []string
+	if u.expectedFrom != nil {
+		out = expectedTerminals(u.expectedFrom)
+	} else if u.expectNode != nil {
+		out = expectedTerminals(u.expectNode)
+	} else if u.Expect != "" {
+		out = []string{u.Expect}
+	}
+	if u.continues != nil {
+		for _, terminal := range continuationTerminals(u.continues) {
+			if !containsString(out, terminal) {
+				out = append(out, terminal)
+			}
+		}
+	}
+	return out
+}
+
+func (u *UnexpectedTokenError) all() []*UnexpectedTokenError {
+	return append([]*UnexpectedTokenError{u}, u.alternatives...)
+}
+
+// Merge the expectations of errors from competing alternatives that failed on
+// the same token, otherwise return the latest error "err".
+func mergeErrors(prev, err error) error {
+	perr, ok := prev.(*UnexpectedTokenError)
+	if !ok {
+		return err
+	}
+	uerr, ok := err.(*UnexpectedTokenError)
+	if !ok || perr == uerr || perr.Unexpected.Pos != uerr.Unexpected.Pos {
+		return err
+	}
+	merged := *perr
+	merged.alternatives = append(append(append([]*UnexpectedTokenError{}, perr.alternatives...), uerr), uerr.alternatives...)
+	return &merged
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
 // ParseError is returned when a parse error occurs.
 //
 // It is useful for differentiating between parse errors and other errors such
 // as lexing and IO errors.
 type ParseError struct {
-	Msg string
-	Pos lexer.Position
+	Msg  string
+	Pos  lexer.Position
+	Code ErrorCode // Optional, see ErrorCodeOf.
+	// Optional extent of the input that the error applies to, see ErrorRange.
+	Range lexer.Span
+	// The format and arguments of Msg, if created by Errorf, for translation by a MessageCatalog.
+	format     string
+	args       []interface{}
+	prefix     string      // Precedes the message formatted from format, eg. the field added by decorate.
+	stack      []RuleFrame // Innermost first.
+	incomplete bool        // See IsIncomplete.
 }
 
 func (p *ParseError) Error() string            { return FormatError(p) }
@@ -74,7 +613,11 @@ func (p *ParseError) Position() lexer.Position { return p.Pos }
 
 // Errorf creates a new Error at the given position.
 func Errorf(pos lexer.Position, format string, args ...interface{}) Error {
-	return &ParseError{Msg: fmt.Sprintf(format, args...), Pos: pos}
+	return codedErrorf("", pos, format, args...)
+}
+
+func codedErrorf(code ErrorCode, pos lexer.Position, format string, args ...interface{}) *ParseError {
+	return &ParseError{Msg: fmt.Sprintf(format, args...), Pos: pos, Code: code, format: format, args: args}
 }
 
 type wrappingParseError struct {
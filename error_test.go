@@ -1,7 +1,10 @@
 package participle_test
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
 	require "github.com/alecthomas/assert/v2"
@@ -38,13 +41,385 @@ func TestErrorReporting(t *testing.T) {
 	}}, ast)
 
 	_, err = p.ParseString("", `public struct Bar;`)
-	require.EqualError(t, err, `1:8: unexpected token "struct" (expected "union" <ident>)`)
+	require.EqualError(t, err, `1:8: unexpected token "struct" (expected "class" <ident> ("(" <ident> ("," <ident>)+ ")")? or "union" <ident>)`)
+	var uerr *participle.UnexpectedTokenError
+	require.True(t, errors.As(err, &uerr))
+	require.Equal(t, []string{`"class"`, `"union"`}, uerr.Expected())
 	_, err = p.ParseString("", `public class 1;`)
 	require.EqualError(t, err, `1:14: unexpected token "1" (expected <ident> ("(" <ident> ("," <ident>)+ ")")?)`)
 	_, err = p.ParseString("", `public class A(B,C,);`)
 	require.EqualError(t, err, `1:20: unexpected token ")" (expected <ident>)`)
 }
 
+func TestUnexpectedTokenErrorExpected(t *testing.T) {
+	type arg struct {
+		Value string `@Ident | @Int | @"*"`
+	}
+	type call struct {
+		Name string `@Ident "("`
+		Args []*arg `(@@ ("," @@)*)? ")"`
+	}
+	p := mustTestParser[call](t)
+
+	_, err := p.ParseString("", `f(;`)
+	var uerr *participle.UnexpectedTokenError
+	require.True(t, errors.As(err, &uerr))
+	require.Equal(t, []string{"<ident>", "<int>", `"*"`, `")"`}, uerr.Expected())
+
+	_, err = p.ParseString("", `f(a, b c`)
+	require.True(t, errors.As(err, &uerr))
+	require.Equal(t, []string{`")"`, `","`}, uerr.Expected())
+
+	_, err = p.ParseString("", `f(a c`)
+	require.True(t, errors.As(err, &uerr))
+	require.Equal(t, []string{`")"`, `","`}, uerr.Expected())
+
+	require.Zero(t, (&participle.UnexpectedTokenError{}).Expected())
+	require.Equal(t, []string{"x"}, (&participle.UnexpectedTokenError{Expect: "x"}).Expected())
+}
+
+func TestErrorMergesCompetingExpectations(t *testing.T) {
+	type grammar struct {
+		Name  string `  "(" @Ident ")"`
+		Empty bool   `| @("(" ")")`
+	}
+	p := mustTestParser[grammar](t, participle.UseLookahead(2))
+
+	_, err := p.ParseString("", `( 1`)
+	require.EqualError(t, err, `1:3: unexpected token "1" (expected <ident> ")" or ")")`)
+	var uerr *participle.UnexpectedTokenError
+	require.True(t, errors.As(err, &uerr))
+	require.Equal(t, []string{"<ident>", `")"`}, uerr.Expected())
+}
+
+type namedQuery struct {
+	_     struct{} `parser_name:"query expression"`
+	Table string   `"select" @Ident`
+}
+
+type namedValue struct {
+	Value int `@Int`
+}
+
+func (namedValue) GrammarName() string { return "number" }
+
+func TestGrammarName(t *testing.T) {
+	type grammar struct {
+		Query *namedQuery `"(" @@ ")"`
+		Value *namedValue `| "[" @@ "]"`
+	}
+	p := mustTestParser[grammar](t)
+
+	_, err := p.ParseString("", `( from`)
+	require.EqualError(t, err, `1:3: unexpected token "from" (expected query expression)`)
+	var uerr *participle.UnexpectedTokenError
+	require.True(t, errors.As(err, &uerr))
+	require.Equal(t, []string{`"select"`}, uerr.Expected())
+
+	_, err = p.ParseString("", `[ x ]`)
+	require.EqualError(t, err, `1:3: unexpected token "x" (expected number)`)
+
+	_, err = p.ParseString("", `( select 1`)
+	require.EqualError(t, err, `1:10: unexpected token "1" (expected <ident>)`)
+
+	q := mustTestParser[namedQuery](t)
+	_, err = q.ParseString("", `from`)
+	require.EqualError(t, err, `1:1: unexpected token "from" (expected query expression)`)
+}
+
+func TestErrorTieBreak(t *testing.T) {
+	type grammar struct {
+		Name  string `  "(" @Ident ")"`
+		Empty bool   `| @("(" ")")`
+	}
+	tests := []struct {
+		policy   participle.TieBreak
+		expected string
+	}{
+		{participle.TieBreakMerge, `1:3: unexpected token "1" (expected <ident> ")" or ")")`},
+		{participle.TieBreakFirst, `1:3: unexpected token "1" (expected <ident> ")")`},
+		{participle.TieBreakLast, `1:3: unexpected token "1" (expected ")")`},
+	}
+	for _, test := range tests {
+		p := mustTestParser[grammar](t, participle.UseLookahead(2), participle.ErrorTieBreak(test.policy))
+		_, err := p.ParseString("", `( 1`)
+		require.EqualError(t, err, test.expected)
+	}
+}
+
+func TestFormatErrorWithSource(t *testing.T) {
+	type assign struct {
+		Name  string `@Ident "="`
+		Value string `@Ident`
+	}
+	p := mustTestParser[assign](t)
+
+	source := "\n\tabc = 123 d"
+	_, err := p.ParseString("", source)
+	var perr participle.Error
+	require.True(t, errors.As(err, &perr))
+	require.Equal(t, "2:8: unexpected token \"123\" (expected <ident>)\n\tabc = 123 d\n\t      ^~~", participle.FormatErrorWithSource(perr, source))
+
+	perr = participle.Errorf(lexer.Position{Line: 1, Column: 3, Offset: 2}, "oops")
+	require.Equal(t, "1:3: oops\nab\n  ^", participle.FormatErrorWithSource(perr, "ab"))
+	require.Equal(t, "1:3: oops", participle.FormatErrorWithSource(perr, "a"))
+}
+
+func TestErrorRange(t *testing.T) {
+	type grammar struct {
+		Name   string `@Ident`
+		Values []int  `"=" @Int{3}`
+	}
+	p := mustTestParser[grammar](t)
+
+	_, err := p.ParseString("", "abc 10")
+	require.Equal(t, lexer.Span{
+		Start: lexer.Position{Offset: 4, Line: 1, Column: 5},
+		End:   lexer.Position{Offset: 6, Line: 1, Column: 7},
+	}, participle.ErrorRange(err))
+
+	source := "abc = 1 2 ;"
+	_, err = p.ParseString("", source)
+	require.Equal(t, lexer.Span{
+		Start: lexer.Position{Offset: 6, Line: 1, Column: 7},
+		End:   lexer.Position{Offset: 10, Line: 1, Column: 11},
+	}, participle.ErrorRange(err))
+	var perr participle.Error
+	require.True(t, errors.As(err, &perr))
+	require.Equal(t, "1:11: sub-expression <int>{3} must match at least 3 times\nabc = 1 2 ;\n      ~~~~^", participle.FormatErrorWithSource(perr, source))
+
+	pos := lexer.Position{Line: 1, Column: 1}
+	require.Equal(t, lexer.Span{Start: pos, End: pos}, participle.ErrorRange(participle.Errorf(pos, "oops")))
+	require.Equal(t, lexer.Span{}, participle.ErrorRange(errors.New("oops")))
+}
+
+func TestErrorCodeOf(t *testing.T) {
+	type grammar struct {
+		Name  string `@Ident`
+		Count int    `"=" @Int`
+		Items []int  `"[" @Int+ "]"`
+	}
+	p := mustTestParser[grammar](t)
+
+	tests := []struct {
+		input string
+		code  participle.ErrorCode
+	}{
+		{`a = 1 [ 2 ]`, ""},
+		{`a = 1 [ 2 ] b`, participle.CodeUnexpectedToken},
+		{`a = 1 [ 2`, participle.CodeIncompleteInput},
+		{`a = 1 [ ]`, participle.CodeTooFewMatches},
+		{`a = "x`, participle.CodeLexer},
+		{`a = 99999999999999999999 [ 1 ]`, participle.CodeInvalidValue},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := p.ParseString("", test.input)
+			require.Equal(t, test.code, participle.ErrorCodeOf(err))
+		})
+	}
+
+	err := participle.Wrapf(lexer.Position{}, participle.Errors{&participle.ParseError{Code: participle.CodeMaxRecursion}}, "wrapped")
+	require.Equal(t, participle.CodeMaxRecursion, participle.ErrorCodeOf(err))
+	require.Equal(t, participle.ErrorCode(""), participle.ErrorCodeOf(errors.New("other")))
+}
+
+func TestIsIncomplete(t *testing.T) {
+	type statement struct {
+		Name string   `@Ident`
+		Args []string `("(" (@Ident ("," @Ident)*)? ")")? ";"`
+	}
+	type grammar struct {
+		Statements []*statement `@@*`
+	}
+	p := mustTestParser[grammar](t)
+
+	tests := []struct {
+		input      string
+		incomplete bool
+	}{
+		{`f(a, b);`, false},
+		{`f(a,`, true},
+		{`f(a, b)`, true},
+		{`f(a b);`, false},
+		{`f(a; g(`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := p.ParseString("", test.input)
+			require.Equal(t, test.incomplete, participle.IsIncomplete(err))
+		})
+	}
+	require.False(t, participle.IsIncomplete(nil))
+}
+
+func TestFormatErrors(t *testing.T) {
+	type grammar struct {
+		Name  string `@Ident "="`
+		Value string `@(Ident | String)`
+	}
+	formatter := participle.ErrorFormatterFunc(func(failure participle.Failure) string {
+		if failure.Unexpected == nil {
+			return "oh no, " + failure.Err.Message()
+		}
+		return fmt.Sprintf("found %s but wanted one of %s", failure.Unexpected.Value, strings.Join(failure.Expected, ", "))
+	})
+	p := mustTestParser[grammar](t, participle.FormatErrors(formatter))
+
+	_, err := p.ParseString("", `a = 1`)
+	require.EqualError(t, err, `1:5: found 1 but wanted one of <ident>, <string>`)
+	var uerr *participle.UnexpectedTokenError
+	require.True(t, errors.As(err, &uerr))
+	require.Equal(t, participle.CodeUnexpectedToken, participle.ErrorCodeOf(err))
+
+	_, err = p.ParseString("", `a = "b`)
+	require.EqualError(t, err, `1:7: oh no, literal not terminated`)
+}
+
+func TestFormatErrorColor(t *testing.T) {
+	type grammar struct {
+		Name string `@Ident ":"`
+	}
+	p := mustTestParser[grammar](t)
+
+	_, err := p.ParseString("test.txt", `a b`)
+	var perr participle.Error
+	require.True(t, errors.As(err, &perr))
+	require.Equal(t, "\x1b[2mtest.txt:1:3:\x1b[0m unexpected token \x1b[31m\"b\"\x1b[0m (expected \x1b[1m\":\"\x1b[0m)", participle.FormatErrorColor(perr))
+	require.Equal(t, "oops", participle.FormatErrorColor(participle.Errorf(lexer.Position{}, "oops")))
+
+	// Colours are only used for terminals.
+	w := &strings.Builder{}
+	require.NoError(t, participle.PrintError(w, participle.Errors{err, errors.New("other")}))
+	require.Equal(t, "test.txt:1:3: unexpected token \"b\" (expected \":\")\nother\n", w.String())
+}
+
+func TestMessages(t *testing.T) {
+	type grammar struct {
+		Name   string `@Ident`
+		Values []int  `"=" @Int+`
+	}
+	catalog := participle.MessageMap{
+		"unexpected token %q (expected %s)":          "jeton inattendu %[1]q (attendu %[2]s)",
+		"sub-expression %s must match at least once": "la sous-expression %s doit correspondre au moins une fois",
+		"parse aborted: %s":                          "analyse interrompue : %s",
+	}
+	p := mustTestParser[grammar](t, participle.Messages(catalog))
+
+	_, err := p.ParseString("", `a 1`)
+	require.EqualError(t, err, `1:3: jeton inattendu "1" (attendu "=" <int>+)`)
+	require.Equal(t, participle.CodeUnexpectedToken, participle.ErrorCodeOf(err))
+
+	_, err = p.ParseString("", `a = b`)
+	require.EqualError(t, err, `1:5: la sous-expression <int>+ doit correspondre au moins une fois`)
+
+	// Untranslated messages are unchanged.
+	_, err = p.ParseString("", `a = 1 b`)
+	require.EqualError(t, err, `1:7: unexpected token "b"`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = p.ParseStringContext(ctx, "", `a = 1`)
+	require.EqualError(t, err, `1:5: analyse interrompue : context canceled`)
+	require.True(t, errors.Is(err, context.Canceled))
+}
+
+type messageLevel int
+
+func (l *messageLevel) Capture(values []string) error {
+	if values[0] != "1" {
+		return participle.Errorf(lexer.Position{Line: 1, Column: 3}, "invalid level %q", values[0])
+	}
+	*l = 1
+	return nil
+}
+
+func TestMessagesDecoratedAndLexer(t *testing.T) {
+	type grammar struct {
+		Level messageLevel `"level" @Int`
+	}
+	catalog := participle.MessageMap{
+		"invalid level %q":      "niveau invalide %q",
+		"invalid input text %q": "texte invalide %q",
+	}
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Ident", `[a-z]+`},
+		{"Int", `\d+`},
+		{"Whitespace", `\s+`},
+	})
+	p := mustTestParser[grammar](t, participle.Lexer(def), participle.Elide("Whitespace"), participle.Messages(catalog))
+
+	// The field that the error is decorated with is kept.
+	_, err := p.ParseString("", `level 2`)
+	require.EqualError(t, err, `1:3: grammar.Level: niveau invalide "2"`)
+
+	_, err = p.ParseString("", `level 1 !`)
+	require.EqualError(t, err, `1:9: texte invalide "!"`)
+	require.Equal(t, participle.CodeLexer, participle.ErrorCodeOf(err))
+}
+
+type stackArgs struct {
+	_      struct{} `parser_name:"argument list"`
+	Values []string `"(" (@Ident ("," @Ident)*)? ")"`
+}
+
+type stackCall struct {
+	Name string     `@Ident`
+	Args *stackArgs `@@`
+}
+
+func TestRuleStack(t *testing.T) {
+	type grammar struct {
+		Calls []*stackCall `(@@ ";")*`
+	}
+	p := mustTestParser[grammar](t)
+	_, err := p.ParseString("", `f(); g(a b);`)
+	require.EqualError(t, err, `1:10: unexpected token "b" (expected ")")`)
+	require.Equal(t, []participle.RuleFrame{
+		{Name: "argument list", Pos: lexer.Position{Offset: 6, Line: 1, Column: 7}},
+		{Name: "StackCall", Pos: lexer.Position{Offset: 5, Line: 1, Column: 6}},
+		{Name: "Grammar", Pos: lexer.Position{Offset: 0, Line: 1, Column: 1}},
+	}, participle.RuleStack(err))
+
+	p = mustTestParser[grammar](t, participle.ErrorContext(2))
+	_, err = p.ParseString("", `f(); g(a b);`)
+	require.EqualError(t, err, `1:10: unexpected token "b" (expected ")"), while parsing argument list at 1:7 in StackCall at 1:6`)
+	require.Equal(t, 3, len(participle.RuleStack(err)))
+
+	require.Zero(t, participle.RuleStack(errors.New("other")))
+}
+
+type panickyValue string
+
+func (p *panickyValue) Capture(values []string) error {
+	if values[0] == "boom" {
+		panic("boom")
+	}
+	*p = panickyValue(values[0])
+	return nil
+}
+
+func TestPanicsAreErrors(t *testing.T) {
+	type assignment struct {
+		Name  string       `@Ident "="`
+		Value panickyValue `@Ident`
+	}
+	type grammar struct {
+		Assignments []*assignment `@@*`
+	}
+	p := mustTestParser[grammar](t)
+	_, err := p.ParseString("", `a = b c = boom`)
+	require.EqualError(t, err, `1:7: panic: boom`)
+	require.Equal(t, participle.CodeInternal, participle.ErrorCodeOf(err))
+	require.Equal(t, []participle.RuleFrame{
+		{Name: "Assignment", Pos: lexer.Position{Offset: 6, Line: 1, Column: 7}},
+		{Name: "Grammar", Pos: lexer.Position{Offset: 0, Line: 1, Column: 1}},
+	}, participle.RuleStack(err))
+
+	p = mustTestParser[grammar](t, participle.PropagatePanics())
+	require.Panics(t, func() { _, _ = p.ParseString("", `a = boom`) })
+}
+
 func TestErrorWrap(t *testing.T) {
 	expected := errors.New("badbad")
 	err := participle.Wrapf(lexer.Position{Line: 1, Column: 1}, expected, "bad: %s", "thing")
@@ -0,0 +1,96 @@
+package participle_test
+
+import (
+	"fmt"
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+type precExpr interface{ String() string }
+
+type precBinary struct {
+	Left  precExpr
+	Op    string
+	Right precExpr
+}
+
+func (b precBinary) String() string { return fmt.Sprintf("(%s %s %s)", b.Left, b.Op, b.Right) }
+
+type precOperand interface{ String() string }
+
+type precNumber struct {
+	Value int `@Int`
+}
+
+func (n precNumber) String() string { return fmt.Sprint(n.Value) }
+
+type precParens struct {
+	Expr precExpr `"(" @@ ")"`
+}
+
+func (p precParens) String() string { return p.Expr.String() }
+
+type precNegate struct {
+	Operand precOperand `"-" @@`
+}
+
+func (n precNegate) String() string { return fmt.Sprintf("-%s", n.Operand) }
+
+func TestExpression(t *testing.T) {
+	p := mustTestParser[precExpr](t,
+		participle.Union[precOperand](precNumber{}, precParens{}, precNegate{}),
+		participle.Expression[precExpr, precOperand](
+			func(left precExpr, op lexer.Token, right precExpr) precExpr {
+				return precBinary{left, op.Value, right}
+			},
+			participle.Operator{Token: "+", Precedence: 1},
+			participle.Operator{Token: "-", Precedence: 1},
+			participle.Operator{Token: "*", Precedence: 2},
+			participle.Operator{Token: "/", Precedence: 2},
+			participle.Operator{Token: "^", Precedence: 3, RightAssociative: true},
+		))
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1", "1"},
+		{"1 + 2 * 3", "(1 + (2 * 3))"},
+		{"1 * 2 + 3", "((1 * 2) + 3)"},
+		{"1 - 2 - 3", "((1 - 2) - 3)"},
+		{"2 ^ 3 ^ 2", "(2 ^ (3 ^ 2))"},
+		{"(1 + 2) * -3 ^ 2", "((1 + 2) * (-3 ^ 2))"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			actual, err := p.ParseString("", test.input)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, (*actual).String())
+		})
+	}
+
+	_, err := p.ParseString("", "1 + * 2")
+	require.EqualError(t, err, `1:5: unexpected token "*" (expected PrecOperand)`)
+
+	require.Equal(t, `PrecExpr = PrecOperand (("+" | "-" | "*" | "/" | "^") PrecOperand)* .
+PrecOperand = PrecNumber | PrecParens | PrecNegate .
+PrecNumber = <int> .
+PrecParens = "(" PrecExpr ")" .
+PrecNegate = "-" PrecOperand .`, p.String())
+}
+
+func TestExpressionInvalid(t *testing.T) {
+	build := func(left precExpr, op lexer.Token, right precExpr) precExpr { return precBinary{left, op.Value, right} }
+	_, err := participle.Build[precExpr](participle.Expression[precExpr, precNumber](build,
+		participle.Operator{Token: "+"},
+		participle.Operator{Token: "+"}))
+	require.EqualError(t, err, `Expression: duplicate operator "+"`)
+
+	type plain struct {
+		Value int `@Int`
+	}
+	_, err = participle.Build[precExpr](participle.Expression[precExpr, plain](build))
+	require.EqualError(t, err, `Expression: operand type participle_test.plain does not implement participle_test.precExpr`)
+}
@@ -0,0 +1,238 @@
+package participle
+
+import (
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// The FIRST set of a node: the tokens it can start with.
+//
+// Disjunctions use the FIRST sets of their alternatives to skip those that
+// cannot match the next token, rather than trying each in a new branch.
+type firstSet struct {
+	literals   []*literal
+	references []*reference
+}
+
+// Reports whether the node this set belongs to can start with "t".
+func (f *firstSet) matches(ctx *parseContext, t lexer.Token) bool {
+	for _, l := range f.literals {
+		if l.matches(ctx, t) {
+			return true
+		}
+	}
+	for _, r := range f.references {
+		if t.Type == r.typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the next token, or an elided token preceding it, is in the set.
+func (f *firstSet) accepts(ctx *parseContext) bool {
+	match := func(t lexer.Token) bool { return f.matches(ctx, t) }
+	t, _ := ctx.PeekAny(match)
+	return match(t)
+}
+
+// Compute the FIRST sets of the alternatives of every disjunction in the grammar.
+func computeFirstSets(root node) {
+	c := &firstSetComputer{sets: map[node]*firstSet{}}
+	seen := map[node]bool{}
+	_ = visit(root, func(n node, next func() error) error {
+		if seen[n] {
+			return nil
+		}
+		seen[n] = true
+		switch n := n.(type) {
+		case *disjunction:
+			n.firsts = c.alternatives(n.nodes)
+		case *union:
+			n.disjunction.firsts = c.alternatives(n.disjunction.nodes)
+		}
+		return next()
+	})
+}
+
+// The terminals that a match of n can start with, in the form they are written in EBNF.
+//
+// Nodes that do not match terminals defined by the grammar, such as negations
+// and custom productions, are included as a whole.
+func expectedTerminals(n node) []string {
+	c := &terminalCollector{linter: newLinter(), seen: map[node]bool{}, added: map[string]bool{}}
+	c.collect(n)
+	return c.out
+}
+
+// The terminals that could extend a match of n after it has consumed input,
+// such as the start of another iteration of a trailing repetition.
+func continuationTerminals(n node) []string {
+	c := &terminalCollector{linter: newLinter(), seen: map[node]bool{}, added: map[string]bool{}}
+	c.continuations(n, map[node]bool{})
+	return c.out
+}
+
+type terminalCollector struct {
+	linter *linter
+	seen   map[node]bool
+	added  map[string]bool
+	out    []string
+}
+
+func (c *terminalCollector) add(terminal string) {
+	if !c.added[terminal] {
+		c.added[terminal] = true
+		c.out = append(c.out, terminal)
+	}
+}
+
+func (c *terminalCollector) collect(n node) {
+	if c.seen[n] {
+		return
+	}
+	c.seen[n] = true
+	switch n := n.(type) {
+	case *literal, *reference, *negation, *custom, *parseable:
+		c.add(ebnf(n))
+	case *disjunction:
+		for _, alternative := range n.nodes {
+			c.collect(alternative)
+		}
+	case *union:
+		for _, member := range n.disjunction.nodes {
+			c.collect(member)
+		}
+	case *sequence:
+		for ; n != nil; n = n.next {
+			c.collect(n.node)
+			if !c.linter.matchesEmpty(n.node) {
+				break
+			}
+		}
+	case *group:
+		c.collect(n.expr)
+	case *capture:
+		c.collect(n.node)
+	case *adjacent:
+		c.collect(n.node)
+	case *strct:
+		c.collect(n.expr)
+	case *rule:
+		c.collect(n.expr)
+	case *expression:
+		c.collect(n.operandNode)
+	}
+}
+
+type firstSetComputer struct {
+	sets map[node]*firstSet // Nil if a node's FIRST set is unknown.
+}
+
+func (c *firstSetComputer) alternatives(nodes []node) []*firstSet {
+	firsts := make([]*firstSet, len(nodes))
+	known := false
+	for i, n := range nodes {
+		firsts[i] = c.first(n)
+		known = known || firsts[i] != nil
+	}
+	if !known {
+		return nil
+	}
+	return firsts
+}
+
+// The FIRST set of n, or nil if it is unknown.
+//
+// A set is only known if n is guaranteed to not match, without error, when the
+// next token is not in the set. In particular, nodes that can match empty input
+// never have a known set.
+func (c *firstSetComputer) first(n node) *firstSet {
+	if set, ok := c.sets[n]; ok {
+		return set
+	}
+	c.sets[n] = nil // Assume recursive nodes are unknown.
+	var set *firstSet
+	switch n := n.(type) {
+	case *literal:
+		set = &firstSet{literals: []*literal{n}}
+	case *reference:
+		set = &firstSet{references: []*reference{n}}
+	case *disjunction:
+		set = c.union(n.nodes)
+	case *union:
+		set = c.union(n.disjunction.nodes)
+	case *sequence:
+		set = c.first(n.node)
+	case *group:
+		// Other modes either match empty input or fail with an error.
+		if n.mode == groupMatchOnce {
+			set = c.first(n.expr)
+		}
+	case *capture:
+		set = c.first(n.node)
+	case *adjacent:
+		set = c.first(n.node)
+	case *strct:
+		set = c.first(n.expr)
+	case *rule:
+		set = c.first(n.expr)
+	}
+	c.sets[n] = set
+	return set
+}
+
+func (c *firstSetComputer) union(nodes []node) *firstSet {
+	out := &firstSet{}
+	for _, n := range nodes {
+		set := c.first(n)
+		if set == nil {
+			return nil
+		}
+		out.literals = append(out.literals, set.literals...)
+		out.references = append(out.references, set.references...)
+	}
+	return out
+}
+
+func (c *terminalCollector) continuations(n node, seen map[node]bool) {
+	if seen[n] {
+		return
+	}
+	seen[n] = true
+	switch n := n.(type) {
+	case *group:
+		if n.mode == groupMatchZeroOrMore || n.mode == groupMatchOneOrMore || (n.mode == groupMatchRange && (n.max < 0 || n.max > 1)) {
+			c.collect(n.expr)
+		}
+		c.continuations(n.expr, seen)
+	case *sequence:
+		var nodes []node
+		for ; n != nil; n = n.next {
+			nodes = append(nodes, n.node)
+		}
+		// Trailing nodes that can match empty input may have done so, and could still start at the end.
+		for i := len(nodes) - 1; i >= 0; i-- {
+			c.continuations(nodes[i], seen)
+			if !c.linter.matchesEmpty(nodes[i]) {
+				break
+			}
+			c.collect(nodes[i])
+		}
+	case *disjunction:
+		for _, alternative := range n.nodes {
+			c.continuations(alternative, seen)
+		}
+	case *union:
+		for _, member := range n.disjunction.nodes {
+			c.continuations(member, seen)
+		}
+	case *capture:
+		c.continuations(n.node, seen)
+	case *adjacent:
+		c.continuations(n.node, seen)
+	case *strct:
+		c.continuations(n.expr, seen)
+	case *rule:
+		c.continuations(n.expr, seen)
+	}
+}
@@ -3,6 +3,7 @@ package participle
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"text/scanner"
 
 	"github.com/alecthomas/participle/v2/lexer"
@@ -12,6 +13,8 @@ type generatorContext struct {
 	lexer.Definition
 	typeNodes    map[reflect.Type]node
 	symbolsToIDs map[lexer.TokenType]string
+	strcts       []*strct // Structs currently being generated.
+	slexers      []*structLexer
 }
 
 func newGeneratorContext(lex lexer.Definition) *generatorContext {
@@ -47,6 +50,28 @@ func (g *generatorContext) addUnionDefs(defs []unionDef) error {
 	return nil
 }
 
+func (g *generatorContext) addExpressionDefs(defs []expressionDef) error {
+	for _, def := range defs {
+		if _, exists := g.typeNodes[def.typ]; exists {
+			return fmt.Errorf("duplicate definition for interface or union type %s", def.typ)
+		}
+		g.typeNodes[def.typ] = &expression{expressionDef: def}
+	}
+	return nil
+}
+
+// Operands are parsed separately, once all interface types have been defined.
+func (g *generatorContext) addExpressionOperands(defs []expressionDef) error {
+	for _, def := range defs {
+		operandNode, err := g.parseType(def.operand)
+		if err != nil {
+			return err
+		}
+		g.typeNodes[def.typ].(*expression).operandNode = operandNode
+	}
+	return nil
+}
+
 func (g *generatorContext) addCustomDefs(defs []customDef) error {
 	for _, def := range defs {
 		if _, exists := g.typeNodes[def.typ]; exists {
@@ -86,10 +111,22 @@ func (g *generatorContext) parseType(t reflect.Type) (_ node, returnedError erro
 			return nil, err
 		}
 		out := newStrct(t)
+		if t.Name() == "" {
+			out.name = g.anonymousStructName()
+		}
 		g.typeNodes[t] = out // Ensure we avoid infinite recursion.
+		g.strcts = append(g.strcts, out)
+		g.slexers = append(g.slexers, slexer)
+		defer func() {
+			g.strcts = g.strcts[:len(g.strcts)-1]
+			g.slexers = g.slexers[:len(g.slexers)-1]
+		}()
 		if slexer.NumField() == 0 {
 			return nil, fmt.Errorf("can not parse into empty struct %s", t)
 		}
+		if out.defaults, err = collectFieldDefaults(slexer); err != nil {
+			return nil, err
+		}
 		defer decorate(&returnedError, func() string { return slexer.Field().Name })
 		e, err := g.parseDisjunction(slexer)
 		if err != nil {
@@ -107,6 +144,35 @@ func (g *generatorContext) parseType(t reflect.Type) (_ node, returnedError erro
 	return nil, fmt.Errorf("%s should be a struct or should implement the Parseable interface", t)
 }
 
+// Collect the values of `default` tags, checking that they can be set on their fields.
+func collectFieldDefaults(slexer *structLexer) ([]fieldDefault, error) {
+	var defaults []fieldDefault
+	for i := 0; i < slexer.NumField(); i++ {
+		field := slexer.GetField(i)
+		value, ok := field.Tag.Lookup("default")
+		if !ok {
+			continue
+		}
+		if ft := indirectType(field.Type); ft == tokenType || ft == tokensType || ft == tokenTypeType || ft == spanType {
+			return nil, fmt.Errorf("%s.%s: default values are not supported for %s", slexer.s.Name(), field.Name, ft)
+		}
+		if err := setField(nil, nil, reflect.New(slexer.s).Elem(), field, []reflect.Value{reflect.ValueOf(value)}); err != nil {
+			return nil, fmt.Errorf("invalid default %q: %w", value, err)
+		}
+		defaults = append(defaults, fieldDefault{field, value})
+	}
+	return defaults, nil
+}
+
+// Anonymous structs are named after the struct and field they are declared in, eg. "GrammarPairs".
+func (g *generatorContext) anonymousStructName() string {
+	if len(g.strcts) == 0 {
+		return "Grammar"
+	}
+	parent := g.strcts[len(g.strcts)-1]
+	return parent.name + g.slexers[len(g.slexers)-1].Field().Name
+}
+
 func (g *generatorContext) parseDisjunction(slexer *structLexer) (node, error) {
 	out := &disjunction{}
 	for {
@@ -178,6 +244,10 @@ func (g *generatorContext) parseTermNoModifiers(slexer *structLexer, allowUnknow
 		return g.parseLiteral(slexer)
 	case '!', '~':
 		return g.parseNegation(slexer)
+	case '^':
+		return g.parseAdjacent(slexer)
+	case '=':
+		return g.parseCut(slexer)
 	case '[':
 		return g.parseOptional(slexer)
 	case '{':
@@ -186,6 +256,9 @@ func (g *generatorContext) parseTermNoModifiers(slexer *structLexer, allowUnknow
 		// Also handles (? used for lookahead groups
 		return g.parseGroup(slexer)
 	case scanner.Ident:
+		if _, ok := g.Symbols()[t.Value]; !ok && t.Value == "recover" {
+			return g.parseRecover(slexer)
+		}
 		return g.parseReference(slexer)
 	case lexer.EOF:
 		_, _ = slexer.Next()
@@ -206,7 +279,7 @@ func (g *generatorContext) parseTerm(slexer *structLexer, allowUnknown bool) (no
 	return g.parseModifier(slexer, out)
 }
 
-// Parse modifiers: ?, *, + and/or !
+// Parse modifiers: ?, *, +, {m,n} and/or !
 func (g *generatorContext) parseModifier(slexer *structLexer, expr node) (node, error) {
 	out := &group{expr: expr}
 	t, err := slexer.Peek()
@@ -222,6 +295,12 @@ func (g *generatorContext) parseModifier(slexer *structLexer, expr node) (node,
 		out.mode = groupMatchZeroOrMore
 	case '?':
 		out.mode = groupMatchZeroOrOne
+	case '{':
+		// Distinguish bounds from a following { <expression> } repetition.
+		if next, err := slexer.PeekN(1); err != nil || next.Type != scanner.Int {
+			return expr, err
+		}
+		return g.parseBounds(slexer, expr)
 	default:
 		return expr, nil
 	}
@@ -229,6 +308,56 @@ func (g *generatorContext) parseModifier(slexer *structLexer, expr node) (node,
 	return out, nil
 }
 
+// <expression>{n}, <expression>{m,} and <expression>{m,n} match <expression>
+// exactly n times, at least m times, and between m and n times respectively.
+func (g *generatorContext) parseBounds(slexer *structLexer, expr node) (node, error) {
+	_, _ = slexer.Next() // {
+	min, err := g.parseBound(slexer)
+	if err != nil {
+		return nil, err
+	}
+	max := min
+	next, err := slexer.Next()
+	if err != nil {
+		return nil, err
+	}
+	if next.Type == ',' {
+		max = -1
+		if next, err = slexer.Peek(); err != nil {
+			return nil, err
+		} else if next.Type == scanner.Int {
+			if max, err = g.parseBound(slexer); err != nil {
+				return nil, err
+			}
+		}
+		if next, err = slexer.Next(); err != nil {
+			return nil, err
+		}
+	}
+	if next.Type != '}' {
+		return nil, fmt.Errorf("expected } but got %q", next)
+	}
+	if max == 0 || (max > 0 && max < min) {
+		return nil, fmt.Errorf("invalid repetition bounds {%d,%d}", min, max)
+	}
+	return &group{expr: expr, mode: groupMatchRange, min: min, max: max}, nil
+}
+
+func (g *generatorContext) parseBound(slexer *structLexer) (int, error) {
+	token, err := slexer.Next()
+	if err != nil {
+		return 0, err
+	}
+	if token.Type != scanner.Int {
+		return 0, fmt.Errorf("expected repetition bound but got %q", token)
+	}
+	n, err := strconv.Atoi(token.Value)
+	if err != nil || n >= MaxIterations {
+		return 0, fmt.Errorf("invalid repetition bound %q", token.Value)
+	}
+	return n, nil
+}
+
 // @<expression> captures <expression> into the current field.
 func (g *generatorContext) parseCapture(slexer *structLexer) (node, error) {
 	_, _ = slexer.Next()
@@ -246,7 +375,7 @@ func (g *generatorContext) parseCapture(slexer *structLexer) (node, error) {
 		return &capture{field, n}, nil
 	}
 	ft := indirectType(field.Type)
-	if ft.Kind() == reflect.Struct && ft != tokenType && ft != tokensType && !implements(ft, captureType) && !implements(ft, textUnmarshalerType) {
+	if ft.Kind() == reflect.Struct && ft != tokenType && ft != tokensType && ft != spanType && !implements(ft, captureType) && !implements(ft, textUnmarshalerType) {
 		return nil, fmt.Errorf("%s: structs can only be parsed with @@ or by implementing the Capture or encoding.TextUnmarshaler interfaces", ft)
 	}
 	n, err := g.parseTermNoModifiers(slexer, false)
@@ -272,6 +401,49 @@ func (g *generatorContext) parseReference(slexer *structLexer) (node, error) { /
 	return &reference{typ: typ, identifier: token.Value}, nil
 }
 
+// recover("<literal>", ...) declares the tokens at which to resume parsing after an error in the current struct.
+func (g *generatorContext) parseRecover(slexer *structLexer) (node, error) {
+	_, _ = slexer.Next() // recover
+	token, err := slexer.Next()
+	if err != nil {
+		return nil, err
+	}
+	if token.Type != '(' {
+		return nil, fmt.Errorf("expected ( after recover but got %q", token)
+	}
+	out := &recoverDirective{}
+	for {
+		token, err = slexer.Next()
+		if err != nil {
+			return nil, err
+		}
+		switch token.Type {
+		case scanner.String, scanner.RawString, scanner.Char:
+			out.sync = append(out.sync, token.Value)
+		default:
+			return nil, fmt.Errorf("expected recovery token literal but got %q", token)
+		}
+		token, err = slexer.Next()
+		if err != nil {
+			return nil, err
+		}
+		if token.Type == ')' {
+			break
+		}
+		if token.Type != ',' {
+			return nil, fmt.Errorf("expected , or ) but got %q", token)
+		}
+	}
+	s := g.strcts[len(g.strcts)-1]
+	if s.recover == nil {
+		s.recover = map[string]bool{}
+	}
+	for _, token := range out.sync {
+		s.recover[token] = true
+	}
+	return out, nil
+}
+
 // [ <expression> ] optionally matches <expression>.
 func (g *generatorContext) parseOptional(slexer *structLexer) (node, error) {
 	_, _ = slexer.Next() // [
@@ -326,13 +498,21 @@ func (g *generatorContext) parseGroup(slexer *structLexer) (node, error) {
 }
 
 // (?[!=] <expression> ) requires a grouped sub-expression either matches or doesn't match, without consuming it
+//
+// (?<[!=] <expression> ) does the same for the tokens immediately preceding the current position.
 func (g *generatorContext) subparseLookaheadGroup(slexer *structLexer) (node, error) {
 	_, _ = slexer.Next() // ? - the opening ( was already consumed in parseGroup
-	var negative bool
+	var negative, behind bool
 	next, err := slexer.Next()
 	if err != nil {
 		return nil, err
 	}
+	if next.Type == '<' {
+		behind = true
+		if next, err = slexer.Next(); err != nil {
+			return nil, err
+		}
+	}
 	switch next.Type {
 	case '=':
 		negative = false
@@ -345,7 +525,7 @@ func (g *generatorContext) subparseLookaheadGroup(slexer *structLexer) (node, er
 	if err != nil {
 		return nil, err
 	}
-	return &lookaheadGroup{expr: expr, negative: negative}, nil
+	return &lookaheadGroup{expr: expr, negative: negative, behind: behind}, nil
 }
 
 // helper parsing <expression> ) to finish parsing groups or lookahead groups
@@ -364,6 +544,19 @@ func (g *generatorContext) subparseGroup(slexer *structLexer) (node, error) {
 	return disj, nil
 }
 
+// => commits to the current alternative.
+func (g *generatorContext) parseCut(slexer *structLexer) (node, error) {
+	_, _ = slexer.Next() // =
+	next, err := slexer.Next()
+	if err != nil {
+		return nil, err
+	}
+	if next.Type != '>' {
+		return nil, fmt.Errorf("expected => but got %q", "="+next.Value)
+	}
+	return &cut{}, nil
+}
+
 // A token negation
 //
 // Accepts both the form !"some-literal" and !SomeNamedToken
@@ -376,6 +569,16 @@ func (g *generatorContext) parseNegation(slexer *structLexer) (node, error) {
 	return &negation{next}, nil
 }
 
+// ^<expr> requires <expr> to be adjacent to the preceding token, ie. with no elided tokens between them.
+func (g *generatorContext) parseAdjacent(slexer *structLexer) (node, error) {
+	_, _ = slexer.Next() // ^
+	next, err := g.parseTermNoModifiers(slexer, false)
+	if err != nil {
+		return nil, err
+	}
+	return &adjacent{next}, nil
+}
+
 // A literal string.
 //
 // Note that for this to match, the tokeniser must be able to produce this string. For example,
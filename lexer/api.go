@@ -41,6 +41,24 @@ type BytesDefinition interface {
 	LexBytes(filename string, input []byte) (Lexer, error)
 }
 
+// CaseInsensitiveDefinition is an optional interface lexer Definition's can
+// implement to report which symbols are matched case-insensitively.
+//
+// The parser will automatically match literals of these symbols case-insensitively.
+type CaseInsensitiveDefinition interface {
+	CaseInsensitiveSymbols() []string
+}
+
+// PositionDefinition is an optional interface lexer Definition's can implement
+// if they do not position tokens with Position.Advance, eg. because they
+// measure columns in other units.
+//
+// The parser uses it to compute the end positions of nodes and spans.
+type PositionDefinition interface {
+	// AdvancePosition advances "pos" over "span", as the lexer would.
+	AdvancePosition(pos *Position, span string)
+}
+
 // A Lexer returns tokens from a source.
 type Lexer interface {
 	// Next consumes and returns the next token.
@@ -127,6 +145,39 @@ func (p Position) String() string {
 	return fmt.Sprintf("%s:%d:%d", filename, p.Line, p.Column)
 }
 
+// Span is the extent of a sequence of tokens, from the start of the first to the end of the last.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%s-%s", s.Start, s.End)
+}
+
+// SpanOf returns the Span of "tokens".
+//
+// The end of the Span is computed from the value of the last token, so it
+// may not be exact if the lexer transformed the value. It is advanced with
+// Position.Advance, see DefinitionSpanOf for lexers that position tokens
+// differently.
+func SpanOf(tokens []Token) Span {
+	return DefinitionSpanOf(nil, tokens)
+}
+
+// DefinitionSpanOf returns the Span of "tokens" produced by "def".
+//
+// It is like SpanOf, except that the end of the Span is advanced with
+// AdvancePosition.
+func DefinitionSpanOf(def Definition, tokens []Token) Span {
+	if len(tokens) == 0 {
+		return Span{}
+	}
+	end := tokens[len(tokens)-1].Pos
+	AdvancePosition(def, &end, tokens[len(tokens)-1].Value)
+	return Span{Start: tokens[0].Pos, End: end}
+}
+
 // A Token returned by a Lexer.
 type Token struct {
 	// Type of token. This is the value keyed by symbol as returned by Definition.Symbols().
@@ -169,3 +220,30 @@ func MakeSymbolTable(def Definition, types ...string) (map[TokenType]bool, error
 	}
 	return table, nil
 }
+
+// lexString lexes s with def, using the StringDefinition fast path if available.
+func lexString(def Definition, filename string, s string) (Lexer, error) {
+	if sd, ok := def.(StringDefinition); ok {
+		return sd.LexString(filename, s)
+	}
+	return def.Lex(filename, strings.NewReader(s))
+}
+
+// AdvancePosition advances "pos" over "span" as "def" would, if it implements
+// PositionDefinition, or with Position.Advance otherwise.
+func AdvancePosition(def Definition, pos *Position, span string) {
+	if pd, ok := def.(PositionDefinition); ok {
+		pd.AdvancePosition(pos, span)
+		return
+	}
+	pos.Advance(span)
+}
+
+// caseInsensitiveSymbols returns the case-insensitive symbols of def, if it
+// implements CaseInsensitiveDefinition.
+func caseInsensitiveSymbols(def Definition) []string {
+	if ci, ok := def.(CaseInsensitiveDefinition); ok {
+		return ci.CaseInsensitiveSymbols()
+	}
+	return nil
+}
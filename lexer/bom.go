@@ -0,0 +1,142 @@
+package lexer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// DetectBOM wraps a Definition so that input starting with a UTF-8, UTF-16LE
+// or UTF-16BE byte order mark is transcoded to UTF-8 before lexing.
+//
+// The byte order mark itself is not passed to the wrapped lexer. Token offsets
+// are remapped to byte offsets in the original input, while lines and columns
+// are those of the decoded text. Input without a byte order mark is lexed
+// unchanged.
+func DetectBOM(def Definition) Definition {
+	return &bomDefinition{def}
+}
+
+type bomDefinition struct {
+	def Definition
+}
+
+var _ interface {
+	StringDefinition
+	BytesDefinition
+	CaseInsensitiveDefinition
+	PositionDefinition
+} = &bomDefinition{}
+
+func (b *bomDefinition) Symbols() map[string]TokenType { // nolint: golint
+	return b.def.Symbols()
+}
+
+// CaseInsensitiveSymbols implements CaseInsensitiveDefinition.
+func (b *bomDefinition) CaseInsensitiveSymbols() []string {
+	return caseInsensitiveSymbols(b.def)
+}
+
+// AdvancePosition implements PositionDefinition.
+func (b *bomDefinition) AdvancePosition(pos *Position, span string) {
+	AdvancePosition(b.def, pos, span)
+}
+
+func (b *bomDefinition) Lex(filename string, r io.Reader) (Lexer, error) { // nolint: golint
+	w := &bytes.Buffer{}
+	_, err := io.Copy(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return b.LexBytes(filename, w.Bytes())
+}
+
+func (b *bomDefinition) LexString(filename string, s string) (Lexer, error) { // nolint: golint
+	if !strings.HasPrefix(s, "\xef\xbb\xbf") && !strings.HasPrefix(s, "\xff\xfe") && !strings.HasPrefix(s, "\xfe\xff") {
+		return lexString(b.def, filename, s)
+	}
+	return b.LexBytes(filename, []byte(s))
+}
+
+func (b *bomDefinition) LexBytes(filename string, data []byte) (Lexer, error) { // nolint: golint
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		lex, err := lexString(b.def, filename, string(data[3:]))
+		if err != nil {
+			return nil, err
+		}
+		return &bomLexer{lexer: lex, bom: 3}, nil
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		order = binary.BigEndian
+	default:
+		return lexString(b.def, filename, string(data))
+	}
+	data = data[2:]
+	if len(data)%2 != 0 {
+		return nil, errors.New("invalid UTF-16 input: odd number of bytes")
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[i*2:])
+	}
+	decoded := string(utf16.Decode(units))
+	lex, err := lexString(b.def, filename, decoded)
+	if err != nil {
+		return nil, err
+	}
+	return &bomLexer{lexer: lex, bom: 2, utf16: true, decoded: decoded}, nil
+}
+
+// bomLexer remaps token offsets in decoded UTF-8 text to offsets in the original input.
+type bomLexer struct {
+	lexer   Lexer
+	bom     int
+	utf16   bool
+	decoded string
+	offset  int // UTF-8 offset in "decoded" corresponding to "units".
+	units   int // UTF-16 code units preceding "offset".
+}
+
+func (b *bomLexer) Next() (Token, error) {
+	t, err := b.lexer.Next()
+	if err != nil {
+		var lerr *Error
+		if errors.As(err, &lerr) {
+			lerr.Pos.Offset = b.remap(lerr.Pos.Offset)
+		}
+		return t, err
+	}
+	t.Pos.Offset = b.remap(t.Pos.Offset)
+	return t, nil
+}
+
+// Remap a UTF-8 offset to an offset in the original input.
+//
+// As tokens are usually produced in order, UTF-16 offsets are computed
+// incrementally from the previous token.
+func (b *bomLexer) remap(offset int) int {
+	if !b.utf16 {
+		return offset + b.bom
+	}
+	if offset < b.offset {
+		b.offset, b.units = 0, 0
+	}
+	if offset > len(b.decoded) {
+		offset = len(b.decoded)
+	}
+	for _, r := range b.decoded[b.offset:offset] {
+		if r >= 0x10000 {
+			b.units += 2
+		} else {
+			b.units++
+		}
+	}
+	b.offset = offset
+	return b.bom + b.units*2
+}
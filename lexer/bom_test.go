@@ -0,0 +1,66 @@
+package lexer_test
+
+import (
+	"bytes"
+	"testing"
+	"unicode/utf16"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+func encodeUTF16(s string, bigEndian bool) []byte {
+	out := []byte{0xff, 0xfe}
+	if bigEndian {
+		out = []byte{0xfe, 0xff}
+	}
+	for _, unit := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			out = append(out, byte(unit>>8), byte(unit))
+		} else {
+			out = append(out, byte(unit), byte(unit>>8))
+		}
+	}
+	return out
+}
+
+func TestDetectBOM(t *testing.T) {
+	def := lexer.DetectBOM(lexer.MustSimple([]lexer.SimpleRule{
+		{"Ident", `\pL+`},
+		{"Symbol", `[^\pL\s]`},
+		{"whitespace", `\s+`},
+	}))
+	tests := []struct {
+		name    string
+		input   []byte
+		offsets []int
+	}{
+		{"NoBOM", []byte("héllo 😀 wörld"), []int{0, 7, 12}},
+		{"UTF8", append([]byte{0xef, 0xbb, 0xbf}, "héllo 😀 wörld"...), []int{3, 10, 15}},
+		{"UTF16LE", encodeUTF16("héllo 😀 wörld", false), []int{2, 14, 20}},
+		{"UTF16BE", encodeUTF16("héllo 😀 wörld", true), []int{2, 14, 20}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lex, err := def.Lex("", bytes.NewReader(test.input))
+			require.NoError(t, err)
+			tokens, err := lexer.ConsumeAll(lex)
+			require.NoError(t, err)
+			values := []string{}
+			offsets := []int{}
+			for _, token := range tokens[:len(tokens)-1] {
+				values = append(values, token.Value)
+				offsets = append(offsets, token.Pos.Offset)
+			}
+			require.Equal(t, []string{"héllo", "😀", "wörld"}, values)
+			require.Equal(t, test.offsets, offsets)
+			require.Equal(t, 9, tokens[2].Pos.Column)
+		})
+	}
+}
+
+func TestDetectBOMInvalidUTF16(t *testing.T) {
+	def := lexer.DetectBOM(lexer.MustSimple([]lexer.SimpleRule{{"Ident", `\pL+`}}))
+	_, err := def.Lex("", bytes.NewReader([]byte{0xff, 0xfe, 'a'}))
+	require.EqualError(t, err, "invalid UTF-16 input: odd number of bytes")
+}
@@ -0,0 +1,215 @@
+package lexer
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// combinedState matches all rules of a lexer state at once.
+//
+// Rules are first narrowed down by the first byte of the input to those that
+// could possibly match, then the remaining candidates are matched with a
+// single alternation.
+type combinedState struct {
+	dispatch [256]*combinedRules
+}
+
+// Combine the rules of a state, or return nil if the state contains rules
+// that cannot be combined, such as those with backreferences or Return().
+func combineState(rules []compiledRule) *combinedState {
+	firsts := make([]*[256]bool, len(rules))
+	for i, rule := range rules {
+		if rule.RE == nil || rule.Rule == ReturnRule {
+			return nil
+		}
+		re, err := syntax.Parse(rule.Pattern, syntax.Perl)
+		if err != nil {
+			return nil
+		}
+		first, nullable := firstBytes(re.Simplify())
+		if !nullable {
+			firsts[i] = first
+		}
+	}
+	state := &combinedState{}
+	// Bytes with the same candidate rules share a regular expression.
+	cache := map[string]*combinedRules{}
+	for b := range state.dispatch {
+		key := &strings.Builder{}
+		candidates := make([]int, 0, len(rules))
+		for i, first := range firsts {
+			if first == nil || first[b] {
+				candidates = append(candidates, i)
+				fmt.Fprintf(key, "%d,", i)
+			}
+		}
+		combined, ok := cache[key.String()]
+		if !ok {
+			if combined = combineRules(rules, candidates); combined == nil && len(candidates) > 0 {
+				return nil
+			}
+			cache[key.String()] = combined
+		}
+		state.dispatch[b] = combined
+	}
+	return state
+}
+
+// Match returns the first matching rule and its submatch indexes.
+func (c *combinedState) match(rules []compiledRule, data string) (*compiledRule, []int) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	combined := c.dispatch[data[0]]
+	if combined == nil {
+		return nil, nil
+	}
+	return combined.match(rules, data)
+}
+
+// combinedRules is a single regular expression matching a subset of the rules
+// in a state.
+//
+// Each rule is wrapped in a capture group, with the rule's own groups following
+// it. Go's regexp alternation is leftmost-first, so the first rule to match at
+// the current position is selected, exactly as when each rule is tried in turn.
+type combinedRules struct {
+	re     *regexp.Regexp
+	rules  []int // Index of each alternative in the state's rules.
+	groups []int // Group of each alternative, followed by one past the last group.
+}
+
+func combineRules(rules []compiledRule, candidates []int) *combinedRules {
+	if len(candidates) == 0 {
+		return nil
+	}
+	pattern := &strings.Builder{}
+	pattern.WriteString("^(?:")
+	groups := make([]int, 0, len(candidates)+1)
+	group := 1
+	for i, candidate := range candidates {
+		rule := rules[candidate]
+		if i > 0 {
+			pattern.WriteString("|")
+		}
+		pattern.WriteString("(" + rule.Pattern + ")")
+		groups = append(groups, group)
+		group += rule.RE.NumSubexp() + 1
+	}
+	pattern.WriteString(")")
+	groups = append(groups, group)
+	re, err := regexp.Compile(pattern.String())
+	if err != nil || re.NumSubexp() != group-1 {
+		return nil
+	}
+	return &combinedRules{re: re, rules: candidates, groups: groups}
+}
+
+func (c *combinedRules) match(rules []compiledRule, data string) (*compiledRule, []int) {
+	m := c.re.FindStringSubmatchIndex(data)
+	if m == nil {
+		return nil, nil
+	}
+	for i, rule := range c.rules {
+		if start := c.groups[i] * 2; m[start] != -1 {
+			return &rules[rule], m[start : c.groups[i+1]*2]
+		}
+	}
+	return nil, nil
+}
+
+// firstBytes returns the set of bytes that a match of re can start with, and
+// whether re can match the empty string.
+//
+// The set is conservative: all non-ASCII runes map to every byte >= 0x80.
+func firstBytes(re *syntax.Regexp) (first *[256]bool, nullable bool) {
+	first = &[256]bool{}
+	addRange := func(lo, hi rune) {
+		for r := lo; r <= hi && r < utf8.RuneSelf; r++ {
+			first[r] = true
+		}
+		if hi >= utf8.RuneSelf {
+			for b := utf8.RuneSelf; b < 256; b++ {
+				first[b] = true
+			}
+		}
+	}
+	addRune := func(r rune, fold bool) {
+		addRange(r, r)
+		if fold {
+			for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+				addRange(f, f)
+			}
+		}
+	}
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return first, false
+
+	case syntax.OpLiteral:
+		if len(re.Rune) == 0 {
+			return first, true
+		}
+		addRune(re.Rune[0], re.Flags&syntax.FoldCase != 0)
+		return first, false
+
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			addRange(re.Rune[i], re.Rune[i+1])
+		}
+		return first, false
+
+	case syntax.OpAnyChar:
+		addRange(0, utf8.MaxRune)
+		return first, false
+
+	case syntax.OpAnyCharNotNL:
+		addRange(0, '\n'-1)
+		addRange('\n'+1, utf8.MaxRune)
+		return first, false
+
+	case syntax.OpCapture:
+		return firstBytes(re.Sub[0])
+
+	case syntax.OpStar, syntax.OpQuest:
+		first, _ = firstBytes(re.Sub[0])
+		return first, true
+
+	case syntax.OpPlus:
+		return firstBytes(re.Sub[0])
+
+	case syntax.OpRepeat:
+		first, nullable = firstBytes(re.Sub[0])
+		return first, nullable || re.Min == 0
+
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			subFirst, subNullable := firstBytes(sub)
+			for b, ok := range subFirst {
+				first[b] = first[b] || ok
+			}
+			if !subNullable {
+				return first, false
+			}
+		}
+		return first, true
+
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			subFirst, subNullable := firstBytes(sub)
+			for b, ok := range subFirst {
+				first[b] = first[b] || ok
+			}
+			nullable = nullable || subNullable
+		}
+		return first, nullable
+
+	default:
+		// Empty-width assertions.
+		return first, true
+	}
+}
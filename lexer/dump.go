@@ -0,0 +1,51 @@
+package lexer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Dump lexes "input" with "def" and writes each token to "w", one per line,
+// with its position, type name, value and, for the stateful lexer, the state
+// and rule that produced it.
+//
+// This is useful for diagnosing why a grammar does not match. If lexing fails
+// the tokens up to the error are written, followed by the error.
+//
+// eg.
+//
+//	1:1   Ident    "hello"  Root.Ident
+//	1:7   Ident    "world"  Root.Ident
+//	1:12  EOF      ""       Root
+func Dump(def Definition, input string, w io.Writer) error {
+	lex, err := lexString(def, "", input)
+	if err != nil {
+		return err
+	}
+	names := SymbolsByRune(def)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for {
+		t, err := lex.Next()
+		if err != nil {
+			_ = tw.Flush()
+			fmt.Fprintf(w, "error: %s\n", err)
+			return err
+		}
+		name, ok := names[t.Type]
+		if !ok {
+			name = fmt.Sprintf("%d", t.Type)
+		}
+		origin := ""
+		if sl, ok := lex.(*StatefulLexer); ok {
+			state, rule := sl.Origin()
+			origin = strings.TrimSuffix(state+"."+rule, ".")
+		}
+		fmt.Fprintf(tw, "%d:%d\t%s\t%q\t%s\n", t.Pos.Line, t.Pos.Column, name, t.Value, origin)
+		if t.EOF() {
+			break
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,31 @@
+package lexer_test
+
+import (
+	"strings"
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+func TestDump(t *testing.T) {
+	w := &strings.Builder{}
+	err := lexer.Dump(lexer.MustStateful(interpolatedRules), `"hi ${x}"`, w)
+	require.NoError(t, err)
+	require.Equal(t, `1:1   String     "\""   Root.String
+1:2   Char       "hi "  String.Char
+1:5   Expr       "${"   String.Expr
+1:7   Ident      "x"    Expr.Ident
+1:8   ExprEnd    "}"    Expr.ExprEnd
+1:9   StringEnd  "\""   String.StringEnd
+1:10  EOF        ""     Root
+`, w.String())
+
+	w.Reset()
+	err = lexer.Dump(lexer.MustStateful(interpolatedRules), `"${!}"`, w)
+	require.Error(t, err)
+	require.Equal(t, `1:1  String  "\""  Root.String
+1:2  Expr    "${"  String.Expr
+error: 1:4: invalid input text "!}\""
+`, w.String())
+}
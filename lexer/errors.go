@@ -17,18 +17,25 @@ type errorInterface interface {
 type Error struct {
 	Msg string
 	Pos Position
+	// The format and arguments of Msg, if created by errorf.
+	format string
+	args   []interface{}
 }
 
 var _ errorInterface = &Error{}
 
 // Creates a new Error at the given position.
 func errorf(pos Position, format string, args ...interface{}) *Error {
-	return &Error{Msg: fmt.Sprintf(format, args...), Pos: pos}
+	return &Error{Msg: fmt.Sprintf(format, args...), Pos: pos, format: format, args: args}
 }
 
 func (e *Error) Message() string    { return e.Msg } // nolint: golint
 func (e *Error) Position() Position { return e.Pos } // nolint: golint
 
+// MessageFormat returns the format string and arguments that Msg was
+// formatted from, eg. for translation, or "" if they are not known.
+func (e *Error) MessageFormat() (format string, args []interface{}) { return e.format, e.args }
+
 // Error formats the error with FormatError.
 func (e *Error) Error() string { return formatError(e.Pos, e.Msg) }
 
@@ -0,0 +1,98 @@
+package lexer
+
+import (
+	"io"
+)
+
+// FilterFunc is called for each token produced by a lexer, including the
+// final EOF token, and returns the tokens to emit in its place.
+//
+// Returning no tokens drops the token, returning several injects tokens. If
+// the tokens returned for EOF do not themselves end with an EOF token, the
+// original EOF token is emitted after them.
+type FilterFunc func(token Token) ([]Token, error)
+
+// Filter wraps a Definition so that every token is passed through a FilterFunc.
+//
+// This can be used to drop, rewrite, split or inject tokens, eg. for keyword
+// promotion or automatic semicolon insertion. "newFilter" is called to create
+// a FilterFunc for each Lexer, so a FilterFunc may retain state between the
+// tokens of a single input.
+func Filter(def Definition, newFilter func() FilterFunc) Definition {
+	return &filterDefinition{def: def, newFilter: newFilter}
+}
+
+type filterDefinition struct {
+	def       Definition
+	newFilter func() FilterFunc
+}
+
+var _ interface {
+	StringDefinition
+	CaseInsensitiveDefinition
+	PositionDefinition
+} = &filterDefinition{}
+
+func (f *filterDefinition) Symbols() map[string]TokenType { // nolint: golint
+	return f.def.Symbols()
+}
+
+// CaseInsensitiveSymbols implements CaseInsensitiveDefinition.
+func (f *filterDefinition) CaseInsensitiveSymbols() []string {
+	return caseInsensitiveSymbols(f.def)
+}
+
+// AdvancePosition implements PositionDefinition.
+func (f *filterDefinition) AdvancePosition(pos *Position, span string) {
+	AdvancePosition(f.def, pos, span)
+}
+
+func (f *filterDefinition) Lex(filename string, r io.Reader) (Lexer, error) { // nolint: golint
+	lex, err := f.def.Lex(filename, r)
+	if err != nil {
+		return nil, err
+	}
+	return &filterLexer{lexer: lex, fn: f.newFilter()}, nil
+}
+
+func (f *filterDefinition) LexString(filename string, s string) (Lexer, error) { // nolint: golint
+	lex, err := lexString(f.def, filename, s)
+	if err != nil {
+		return nil, err
+	}
+	return &filterLexer{lexer: lex, fn: f.newFilter()}, nil
+}
+
+type filterLexer struct {
+	lexer   Lexer
+	fn      FilterFunc
+	pending []Token
+	eof     *Token
+}
+
+func (f *filterLexer) Next() (Token, error) {
+	for len(f.pending) == 0 {
+		if f.eof != nil {
+			return *f.eof, nil
+		}
+		t, err := f.lexer.Next()
+		if err != nil {
+			return Token{}, err
+		}
+		tokens, err := f.fn(t)
+		if err != nil {
+			return Token{}, err
+		}
+		if t.EOF() {
+			if len(tokens) > 0 && tokens[len(tokens)-1].EOF() {
+				t = tokens[len(tokens)-1]
+				tokens = tokens[:len(tokens)-1]
+			}
+			f.eof = &t
+		}
+		f.pending = append(f.pending, tokens...)
+	}
+	t := f.pending[0]
+	f.pending = f.pending[1:]
+	return t, nil
+}
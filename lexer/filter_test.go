@@ -0,0 +1,70 @@
+package lexer_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+func TestFilter(t *testing.T) {
+	base := lexer.MustSimple([]lexer.SimpleRule{
+		{"Ident", `\w+`},
+		{"Newline", `\n`},
+		{"Semicolon", `;`},
+		{"whitespace", `[ \t]+`},
+	})
+	symbols := base.Symbols()
+	// Automatic semicolon insertion: newlines after an identifier become
+	// semicolons, other newlines are dropped, and a semicolon is inserted at EOF.
+	def := lexer.Filter(base, func() lexer.FilterFunc {
+		var last lexer.Token
+		return func(token lexer.Token) ([]lexer.Token, error) {
+			defer func() { last = token }()
+			switch token.Type {
+			case symbols["Newline"]:
+				if last.Type == symbols["Ident"] {
+					return []lexer.Token{{Type: symbols["Semicolon"], Value: ";", Pos: token.Pos}}, nil
+				}
+				return nil, nil
+			case lexer.EOF:
+				if last.Type == symbols["Ident"] {
+					return []lexer.Token{{Type: symbols["Semicolon"], Value: ";", Pos: token.Pos}}, nil
+				}
+			case symbols["Ident"]:
+				if token.Value == "bad" {
+					return nil, errors.New("bad token")
+				}
+			}
+			return []lexer.Token{token}, nil
+		}
+	})
+	lex, err := def.Lex("", strings.NewReader("a b\n\nc; d"))
+	require.NoError(t, err)
+	tokens, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	actual := []string{}
+	for _, token := range tokens {
+		actual = append(actual, token.String())
+	}
+	require.Equal(t, []string{"a", "b", ";", "c", ";", "d", ";", "<EOF>"}, actual)
+
+	lex, err = def.Lex("", strings.NewReader("a bad"))
+	require.NoError(t, err)
+	_, err = lexer.ConsumeAll(lex)
+	require.EqualError(t, err, "bad token")
+
+	// Each Lexer has its own filter state.
+	first, err := def.Lex("", strings.NewReader("a\n"))
+	require.NoError(t, err)
+	second, err := def.Lex("", strings.NewReader("\nb"))
+	require.NoError(t, err)
+	token, err := first.Next()
+	require.NoError(t, err)
+	require.Equal(t, "a", token.Value)
+	token, err = second.Next()
+	require.NoError(t, err)
+	require.Equal(t, "b", token.Value)
+}
@@ -0,0 +1,141 @@
+package lexer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// IncludeOpener resolves an include directive token to the file it references.
+//
+// The returned filename is used in the positions of the included tokens and to
+// detect include cycles. If the returned reader implements io.Closer it will be
+// closed once all of its tokens have been consumed.
+type IncludeOpener func(include Token) (filename string, r io.Reader, err error)
+
+// IncludeFiles wraps a Definition so that tokens of type "symbol" are replaced
+// by the tokens of the file they reference, as resolved by "open".
+//
+// Included files are lexed with the same Definition, so they may themselves
+// include further files. Including a file that is already being included
+// results in an error at the position of the include directive.
+//
+// The include directive token itself is not emitted; it is up to "open" to
+// extract the filename from its value, eg. by stripping a leading "include".
+func IncludeFiles(def Definition, symbol string, open IncludeOpener) (Definition, error) {
+	rn, ok := def.Symbols()[symbol]
+	if !ok {
+		return nil, fmt.Errorf("lexer does not support symbol %q", symbol)
+	}
+	return &includeDefinition{def: def, symbol: rn, open: open}, nil
+}
+
+type includeDefinition struct {
+	def    Definition
+	symbol TokenType
+	open   IncludeOpener
+}
+
+var _ interface {
+	StringDefinition
+	CaseInsensitiveDefinition
+	PositionDefinition
+} = &includeDefinition{}
+
+func (d *includeDefinition) Symbols() map[string]TokenType { // nolint: golint
+	return d.def.Symbols()
+}
+
+// CaseInsensitiveSymbols implements CaseInsensitiveDefinition.
+func (d *includeDefinition) CaseInsensitiveSymbols() []string {
+	return caseInsensitiveSymbols(d.def)
+}
+
+// AdvancePosition implements PositionDefinition.
+func (d *includeDefinition) AdvancePosition(pos *Position, span string) {
+	AdvancePosition(d.def, pos, span)
+}
+
+func (d *includeDefinition) Lex(filename string, r io.Reader) (Lexer, error) { // nolint: golint
+	lex, err := d.def.Lex(filename, r)
+	if err != nil {
+		return nil, err
+	}
+	return &includeLexer{def: d, stack: []includeFile{{filename: filename, lexer: lex}}}, nil
+}
+
+func (d *includeDefinition) LexString(filename string, s string) (Lexer, error) { // nolint: golint
+	lex, err := lexString(d.def, filename, s)
+	if err != nil {
+		return nil, err
+	}
+	return &includeLexer{def: d, stack: []includeFile{{filename: filename, lexer: lex}}}, nil
+}
+
+type includeFile struct {
+	filename string
+	lexer    Lexer
+	closer   io.Closer
+}
+
+type includeLexer struct {
+	def   *includeDefinition
+	stack []includeFile
+}
+
+func (l *includeLexer) Next() (Token, error) {
+	for {
+		top := l.stack[len(l.stack)-1]
+		t, err := top.lexer.Next()
+		if err != nil {
+			return Token{}, err
+		}
+		switch {
+		case t.EOF() && len(l.stack) > 1:
+			l.stack = l.stack[:len(l.stack)-1]
+			if top.closer != nil {
+				if err := top.closer.Close(); err != nil {
+					return Token{}, errorf(t.Pos, "%s", err)
+				}
+			}
+
+		case t.Type == l.def.symbol:
+			if err := l.include(t); err != nil {
+				return Token{}, err
+			}
+
+		default:
+			return t, nil
+		}
+	}
+}
+
+func (l *includeLexer) include(t Token) error {
+	filename, r, err := l.def.open(t)
+	if err != nil {
+		return errorf(t.Pos, "%s", err)
+	}
+	closer, _ := r.(io.Closer)
+	for i, file := range l.stack {
+		if file.filename == filename {
+			cycle := make([]string, 0, len(l.stack)-i+1)
+			for _, file := range l.stack[i:] {
+				cycle = append(cycle, file.filename)
+			}
+			cycle = append(cycle, filename)
+			if closer != nil {
+				_ = closer.Close()
+			}
+			return errorf(t.Pos, "include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	lex, err := l.def.def.Lex(filename, r)
+	if err != nil {
+		if closer != nil {
+			_ = closer.Close()
+		}
+		return errorf(t.Pos, "%s", err)
+	}
+	l.stack = append(l.stack, includeFile{filename: filename, lexer: lex, closer: closer})
+	return nil
+}
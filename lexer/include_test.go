@@ -0,0 +1,61 @@
+package lexer_test
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+func TestIncludeFiles(t *testing.T) {
+	files := map[string]string{
+		"a.conf":     "x include b.conf y",
+		"b.conf":     "include c.conf\nz",
+		"c.conf":     "w",
+		"cycle.conf": "include d.conf",
+		"d.conf":     "include cycle.conf",
+	}
+	base := lexer.MustSimple([]lexer.SimpleRule{
+		{"Include", `include\s+\S+`},
+		{"Ident", `\w+`},
+		{"whitespace", `\s+`},
+	})
+	def, err := lexer.IncludeFiles(base, "Include", func(include lexer.Token) (string, io.Reader, error) {
+		filename := strings.Fields(include.Value)[1]
+		source, ok := files[filename]
+		if !ok {
+			return "", nil, fmt.Errorf("%s not found", filename)
+		}
+		return filename, strings.NewReader(source), nil
+	})
+	require.NoError(t, err)
+
+	lex, err := def.Lex("a.conf", strings.NewReader(files["a.conf"]))
+	require.NoError(t, err)
+	tokens, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	actual := []string{}
+	for _, token := range tokens {
+		actual = append(actual, token.Pos.String()+" "+token.String())
+	}
+	require.Equal(t, []string{
+		"a.conf:1:1 x",
+		"c.conf:1:1 w",
+		"b.conf:2:1 z",
+		"a.conf:1:18 y",
+		"a.conf:1:19 <EOF>",
+	}, actual)
+
+	lex, err = def.Lex("cycle.conf", strings.NewReader(files["cycle.conf"]))
+	require.NoError(t, err)
+	_, err = lexer.ConsumeAll(lex)
+	require.EqualError(t, err, "d.conf:1:1: include cycle: cycle.conf -> d.conf -> cycle.conf")
+
+	lex, err = def.Lex("", strings.NewReader("include missing.conf"))
+	require.NoError(t, err)
+	_, err = lexer.ConsumeAll(lex)
+	require.EqualError(t, err, "1:1: missing.conf not found")
+}
@@ -0,0 +1,219 @@
+package lexer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// IndentOption configures an IndentationDefinition.
+type IndentOption func(d *IndentationDefinition)
+
+// IndentTabWidth sets the number of columns between tab stops when measuring indentation.
+//
+// The default is 8.
+func IndentTabWidth(n int) IndentOption {
+	return func(d *IndentationDefinition) {
+		d.tabWidth = n
+	}
+}
+
+// IndentTrivia marks token types that are passed through without starting a
+// logical line, such as comments.
+//
+// Lines consisting solely of trivia do not affect indentation.
+func IndentTrivia(types ...string) IndentOption {
+	return func(d *IndentationDefinition) {
+		d.triviaNames = append(d.triviaNames, types...)
+	}
+}
+
+// IndentationDefinition wraps another Definition and synthesizes "Indent",
+// "Dedent" and "Newline" tokens from the leading whitespace of each line, in
+// the style of Python or YAML.
+//
+// A "Newline" token is emitted at the end of each logical line, followed by an
+// "Indent" token if the next line is indented further, or one "Dedent" token
+// for each indentation level closed by the next line. All open levels are
+// closed at EOF.
+//
+// The wrapped lexer is responsible for dropping whitespace and newlines (eg.
+// with a lowercase rule in the stateful lexer). Token offsets from the wrapped
+// lexer must be correct, as they are used to measure indentation.
+type IndentationDefinition struct {
+	def         Definition
+	tabWidth    int
+	triviaNames []string
+	trivia      map[TokenType]bool
+	symbols     map[string]TokenType
+	indent      TokenType
+	dedent      TokenType
+	newline     TokenType
+}
+
+var _ interface {
+	StringDefinition
+	CaseInsensitiveDefinition
+	PositionDefinition
+} = &IndentationDefinition{}
+
+// MustIndentation creates a new IndentationDefinition and panics if it is incorrect.
+func MustIndentation(def Definition, options ...IndentOption) *IndentationDefinition {
+	d, err := NewIndentation(def, options...)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// NewIndentation creates a Definition that synthesizes indentation tokens for def.
+func NewIndentation(def Definition, options ...IndentOption) (*IndentationDefinition, error) {
+	d := &IndentationDefinition{def: def, tabWidth: 8}
+	for _, option := range options {
+		option(d)
+	}
+	if d.tabWidth < 1 {
+		return nil, fmt.Errorf("tab width must be positive but is %d", d.tabWidth)
+	}
+	trivia, err := MakeSymbolTable(def, d.triviaNames...)
+	if err != nil {
+		return nil, err
+	}
+	d.trivia = trivia
+	d.symbols = make(map[string]TokenType, len(def.Symbols())+3)
+	next := EOF
+	for sym, rn := range def.Symbols() {
+		d.symbols[sym] = rn
+		if rn < next {
+			next = rn
+		}
+	}
+	for _, sym := range []string{"Indent", "Dedent", "Newline"} {
+		if _, ok := d.symbols[sym]; ok {
+			return nil, fmt.Errorf("lexer already defines the symbol %q", sym)
+		}
+		next--
+		d.symbols[sym] = next
+	}
+	d.indent, d.dedent, d.newline = d.symbols["Indent"], d.symbols["Dedent"], d.symbols["Newline"]
+	return d, nil
+}
+
+func (d *IndentationDefinition) Symbols() map[string]TokenType { // nolint: golint
+	return d.symbols
+}
+
+// CaseInsensitiveSymbols implements CaseInsensitiveDefinition.
+func (d *IndentationDefinition) CaseInsensitiveSymbols() []string {
+	return caseInsensitiveSymbols(d.def)
+}
+
+// AdvancePosition implements PositionDefinition.
+func (d *IndentationDefinition) AdvancePosition(pos *Position, span string) {
+	AdvancePosition(d.def, pos, span)
+}
+
+func (d *IndentationDefinition) Lex(filename string, r io.Reader) (Lexer, error) { // nolint: golint
+	w := &strings.Builder{}
+	_, err := io.Copy(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return d.LexString(filename, w.String())
+}
+
+// LexString implements StringDefinition.
+func (d *IndentationDefinition) LexString(filename string, s string) (Lexer, error) {
+	lex, err := lexString(d.def, filename, s)
+	if err != nil {
+		return nil, err
+	}
+	return &indentationLexer{def: d, lexer: lex, source: s, levels: []int{0}}, nil
+}
+
+type indentationLexer struct {
+	def     *IndentationDefinition
+	lexer   Lexer
+	source  string
+	levels  []int
+	pending []Token
+	line    int      // Line of the current logical line's last significant token, or 0 if it has ended.
+	end     Position // End of the last significant token.
+}
+
+func (l *indentationLexer) Next() (Token, error) {
+	for len(l.pending) == 0 {
+		if err := l.fill(); err != nil {
+			return Token{}, err
+		}
+	}
+	t := l.pending[0]
+	l.pending = l.pending[1:]
+	return t, nil
+}
+
+func (l *indentationLexer) fill() error {
+	t, err := l.lexer.Next()
+	if err != nil {
+		return err
+	}
+	if l.line != 0 && (t.EOF() || t.Pos.Line > l.line) {
+		l.pending = append(l.pending, Token{Type: l.def.newline, Value: "\n", Pos: l.end})
+		l.line = 0
+	}
+	switch {
+	case t.EOF():
+		for len(l.levels) > 1 {
+			l.levels = l.levels[:len(l.levels)-1]
+			l.pending = append(l.pending, Token{Type: l.def.dedent, Pos: t.Pos})
+		}
+
+	case l.def.trivia[t.Type]:
+
+	default:
+		if t.Pos.Line > l.end.Line || l.end.Line == 0 {
+			if err := l.indent(t); err != nil {
+				return err
+			}
+		}
+		l.end = t.Pos
+		AdvancePosition(l.def.def, &l.end, t.Value)
+		l.line = l.end.Line
+	}
+	l.pending = append(l.pending, t)
+	return nil
+}
+
+// Emit Indent or Dedent tokens for the first significant token on a line.
+func (l *indentationLexer) indent(t Token) error {
+	start := strings.LastIndexByte(l.source[:t.Pos.Offset], '\n') + 1
+	width := 0
+	end := start
+	for ; end < t.Pos.Offset; end++ {
+		if c := l.source[end]; c == '\t' {
+			width += l.def.tabWidth - width%l.def.tabWidth
+		} else if c == ' ' {
+			width++
+		} else {
+			break
+		}
+	}
+	current := l.levels[len(l.levels)-1]
+	switch {
+	case width > current:
+		l.levels = append(l.levels, width)
+		pos := t.Pos
+		pos.Offset, pos.Column = start, 1
+		l.pending = append(l.pending, Token{Type: l.def.indent, Value: l.source[start:end], Pos: pos})
+
+	case width < current:
+		for width < l.levels[len(l.levels)-1] {
+			l.levels = l.levels[:len(l.levels)-1]
+			l.pending = append(l.pending, Token{Type: l.def.dedent, Pos: t.Pos})
+		}
+		if width != l.levels[len(l.levels)-1] {
+			return errorf(t.Pos, "unindent does not match any outer indentation level")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package lexer_test
+
+import (
+	"strings"
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+var indentRules = []lexer.SimpleRule{
+	{"Comment", `#[^\n]*`},
+	{"String", `"""(?:[^"]|"[^"]|""[^"])*"""`},
+	{"Ident", `\w+`},
+	{"Punct", `[:=]`},
+	{"whitespace", `\s+`},
+}
+
+func lexIndented(t *testing.T, def *lexer.IndentationDefinition, input string) (string, error) {
+	t.Helper()
+	lex, err := def.LexString("", input)
+	require.NoError(t, err)
+	tokens, err := lexer.ConsumeAll(lex)
+	names := lexer.SymbolsByRune(def)
+	out := []string{}
+	for _, token := range tokens {
+		switch name := names[token.Type]; name {
+		case "Indent", "Dedent", "Newline", "EOF":
+			out = append(out, name)
+		default:
+			out = append(out, token.Value)
+		}
+	}
+	return strings.Join(out, " "), err
+}
+
+func TestIndentation(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		tokens string
+		err    string
+	}{
+		{name: "Flat",
+			input:  "a\nb\n",
+			tokens: "a Newline b Newline EOF"},
+		{name: "Nested",
+			input:  "if a:\n  b\n  if c:\n    d\ne\n",
+			tokens: "if a : Newline Indent b Newline if c : Newline Indent d Newline Dedent Dedent e Newline EOF"},
+		{name: "DedentAtEOF",
+			input:  "a:\n  b:\n    c",
+			tokens: "a : Newline Indent b : Newline Indent c Newline Dedent Dedent EOF"},
+		{name: "BlankLinesAndComments",
+			input:  "a:\n\n  b\n# comment\n      # comment\n  c\n",
+			tokens: "a : Newline Indent b Newline # comment # comment c Newline Dedent EOF"},
+		{name: "Tabs",
+			input:  "a:\n\tb\n        c\n",
+			tokens: "a : Newline Indent b Newline c Newline Dedent EOF"},
+		{name: "MultilineToken",
+			input:  "a = \"\"\"x\ny\"\"\"\n  b\n",
+			tokens: "a = \"\"\"x\ny\"\"\" Newline Indent b Newline Dedent EOF"},
+		{name: "InconsistentDedent",
+			input:  "a:\n    b\n  c\n",
+			tokens: "",
+			err:    `3:3: unindent does not match any outer indentation level`},
+	}
+	def := lexer.MustIndentation(lexer.MustSimple(indentRules), lexer.IndentTrivia("Comment"))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, err := lexIndented(t, def, test.input)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, test.tokens, tokens)
+		})
+	}
+}
+
+func TestIndentationTabWidth(t *testing.T) {
+	def := lexer.MustIndentation(lexer.MustSimple(indentRules), lexer.IndentTabWidth(4))
+	tokens, err := lexIndented(t, def, "a:\n\tb\n    c\n")
+	require.NoError(t, err)
+	require.Equal(t, "a : Newline Indent b Newline c Newline Dedent EOF", tokens)
+}
+
+func TestIndentationSymbolConflict(t *testing.T) {
+	_, err := lexer.NewIndentation(lexer.MustSimple([]lexer.SimpleRule{{"Indent", `\s+`}}))
+	require.EqualError(t, err, `lexer already defines the symbol "Indent"`)
+}
+
+func TestIndentationParse(t *testing.T) {
+	type Block struct {
+		Name string   `@Ident ":" Newline`
+		Body []string `Indent (@Ident Newline)+ Dedent`
+	}
+	type File struct {
+		Blocks []*Block `@@*`
+	}
+	def := lexer.MustIndentation(lexer.MustSimple(indentRules))
+	parser := participle.MustBuild[File](participle.Lexer(def))
+	actual, err := parser.ParseString("", "a:\n  b\n  c\nd:\n  e\n")
+	require.NoError(t, err)
+	require.Equal(t, &File{Blocks: []*Block{
+		{Name: "a", Body: []string{"b", "c"}},
+		{Name: "d", Body: []string{"e"}},
+	}}, actual)
+}
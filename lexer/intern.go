@@ -0,0 +1,115 @@
+package lexer
+
+import (
+	"fmt"
+	"io"
+)
+
+// Intern wraps a Definition so that identical values of the given token types
+// share a single string.
+//
+// By default token values are slices of the input, so retaining any of them,
+// eg. in an AST, retains the entire input. Interned values are copied once per
+// distinct value, allowing the input to be released and cutting memory use for
+// large inputs with many repeated identifiers or keywords. If no types are
+// given, all tokens are interned.
+//
+// The interning table is local to each Lexer and is discarded with it.
+func Intern(def Definition, types ...string) (Definition, error) {
+	d := &internDefinition{def: def}
+	if len(types) > 0 {
+		symbols := def.Symbols()
+		d.types = map[TokenType]bool{}
+		for _, name := range types {
+			rn, ok := symbols[name]
+			if !ok {
+				return nil, fmt.Errorf("lexer does not support symbol %q", name)
+			}
+			d.types[rn] = true
+		}
+	}
+	return d, nil
+}
+
+type internDefinition struct {
+	def   Definition
+	types map[TokenType]bool // nil to intern all tokens
+}
+
+var _ interface {
+	StringDefinition
+	BytesDefinition
+	CaseInsensitiveDefinition
+	PositionDefinition
+} = &internDefinition{}
+
+func (d *internDefinition) Symbols() map[string]TokenType { // nolint: golint
+	return d.def.Symbols()
+}
+
+// CaseInsensitiveSymbols implements CaseInsensitiveDefinition.
+func (d *internDefinition) CaseInsensitiveSymbols() []string {
+	return caseInsensitiveSymbols(d.def)
+}
+
+// AdvancePosition implements PositionDefinition.
+func (d *internDefinition) AdvancePosition(pos *Position, span string) {
+	AdvancePosition(d.def, pos, span)
+}
+
+func (d *internDefinition) Lex(filename string, r io.Reader) (Lexer, error) { // nolint: golint
+	lex, err := d.def.Lex(filename, r)
+	if err != nil {
+		return nil, err
+	}
+	return d.wrap(lex), nil
+}
+
+func (d *internDefinition) LexString(filename string, s string) (Lexer, error) { // nolint: golint
+	lex, err := lexString(d.def, filename, s)
+	if err != nil {
+		return nil, err
+	}
+	return d.wrap(lex), nil
+}
+
+func (d *internDefinition) LexBytes(filename string, data []byte) (Lexer, error) { // nolint: golint
+	var (
+		lex Lexer
+		err error
+	)
+	if bd, ok := d.def.(BytesDefinition); ok {
+		lex, err = bd.LexBytes(filename, data)
+	} else {
+		lex, err = lexString(d.def, filename, string(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.wrap(lex), nil
+}
+
+func (d *internDefinition) wrap(lex Lexer) Lexer {
+	return &internLexer{lexer: lex, types: d.types, table: map[string]string{}}
+}
+
+type internLexer struct {
+	lexer Lexer
+	types map[TokenType]bool
+	table map[string]string
+}
+
+func (l *internLexer) Next() (Token, error) {
+	t, err := l.lexer.Next()
+	if err != nil || t.EOF() || (l.types != nil && !l.types[t.Type]) {
+		return t, err
+	}
+	if value, ok := l.table[t.Value]; ok {
+		t.Value = value
+	} else {
+		value = string([]byte(t.Value))
+		l.table[value] = value
+		t.Value = value
+	}
+	return t, nil
+}
@@ -0,0 +1,39 @@
+package lexer_test
+
+import (
+	"testing"
+	"unsafe"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+func TestIntern(t *testing.T) {
+	base := lexer.MustSimple([]lexer.SimpleRule{
+		{"Ident", `\w+`},
+		{"Punct", `[,;]`},
+		{"whitespace", `\s+`},
+	})
+	def, err := lexer.Intern(base, "Ident")
+	require.NoError(t, err)
+	input := []byte("foo, bar, foo;")
+	lex, err := def.(lexer.BytesDefinition).LexBytes("", input)
+	require.NoError(t, err)
+	tokens, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	require.Equal(t, "foo", tokens[0].Value)
+	require.Equal(t, "foo", tokens[4].Value)
+	// Identical values share memory, which is not shared with the input.
+	require.Equal(t, stringData(tokens[0].Value), stringData(tokens[4].Value))
+	copy(input, "FOO")
+	require.Equal(t, "foo", tokens[0].Value)
+	// Other tokens are not interned.
+	require.NotEqual(t, stringData(tokens[1].Value), stringData(tokens[3].Value))
+
+	_, err = lexer.Intern(base, "Number")
+	require.EqualError(t, err, `lexer does not support symbol "Number"`)
+}
+
+func stringData(s string) uintptr {
+	return *(*uintptr)(unsafe.Pointer(&s))
+}
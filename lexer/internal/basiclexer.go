@@ -36,6 +36,12 @@ func (lexerGeneratedBasicDefinitionImpl) Symbols() map[string]lexer.TokenType {
 	}
 }
 
+func (lexerGeneratedBasicDefinitionImpl) CaseInsensitiveSymbols() []string {
+	return []string{
+		"Comment",
+	}
+}
+
 func (lexerGeneratedBasicDefinitionImpl) LexString(filename string, s string) (lexer.Lexer, error) {
 	return &lexerGeneratedBasicImpl{
 		s: s,
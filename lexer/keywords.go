@@ -0,0 +1,138 @@
+package lexer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// KeywordOption configures a KeywordDefinition.
+type KeywordOption func(d *KeywordDefinition)
+
+// KeywordsCaseInsensitive matches keywords regardless of case, eg. for SQL.
+func KeywordsCaseInsensitive() KeywordOption {
+	return func(d *KeywordDefinition) {
+		d.caseInsensitive = true
+	}
+}
+
+// KeywordDefinition wraps another Definition and re-types identifier tokens
+// whose value is a reserved keyword as "Keyword" tokens.
+//
+// Keywords can then be matched by literals such as "select" in the grammar,
+// while they are rejected wherever an identifier token is required, without
+// any lookahead or predicates.
+type KeywordDefinition struct {
+	def             Definition
+	ident           TokenType
+	keyword         TokenType
+	keywords        map[string]bool
+	caseInsensitive bool
+	symbols         map[string]TokenType
+}
+
+var _ interface {
+	StringDefinition
+	CaseInsensitiveDefinition
+	PositionDefinition
+} = &KeywordDefinition{}
+
+// MustKeywords creates a new KeywordDefinition and panics if it is incorrect.
+func MustKeywords(def Definition, ident string, keywords []string, options ...KeywordOption) *KeywordDefinition {
+	d, err := NewKeywords(def, ident, keywords, options...)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// NewKeywords creates a Definition that re-types tokens of the symbol "ident"
+// as "Keyword" tokens if their value is one of "keywords".
+func NewKeywords(def Definition, ident string, keywords []string, options ...KeywordOption) (*KeywordDefinition, error) {
+	d := &KeywordDefinition{def: def, keywords: make(map[string]bool, len(keywords))}
+	for _, option := range options {
+		option(d)
+	}
+	symbols := def.Symbols()
+	var ok bool
+	if d.ident, ok = symbols[ident]; !ok {
+		return nil, fmt.Errorf("unknown token type %q", ident)
+	}
+	if _, ok := symbols["Keyword"]; ok {
+		return nil, fmt.Errorf("lexer already defines the symbol %q", "Keyword")
+	}
+	d.symbols = make(map[string]TokenType, len(symbols)+1)
+	next := EOF
+	for sym, rn := range symbols {
+		d.symbols[sym] = rn
+		if rn < next {
+			next = rn
+		}
+	}
+	d.keyword = next - 1
+	d.symbols["Keyword"] = d.keyword
+	for _, keyword := range keywords {
+		d.keywords[d.normalise(keyword)] = true
+	}
+	return d, nil
+}
+
+func (d *KeywordDefinition) normalise(value string) string {
+	if d.caseInsensitive {
+		return strings.ToLower(value)
+	}
+	return value
+}
+
+func (d *KeywordDefinition) Symbols() map[string]TokenType { // nolint: golint
+	return d.symbols
+}
+
+// CaseInsensitiveSymbols implements CaseInsensitiveDefinition.
+//
+// "Keyword" is included if keywords are matched case-insensitively.
+func (d *KeywordDefinition) CaseInsensitiveSymbols() []string {
+	symbols := caseInsensitiveSymbols(d.def)
+	if d.caseInsensitive {
+		symbols = append(symbols[:len(symbols):len(symbols)], "Keyword")
+	}
+	return symbols
+}
+
+// AdvancePosition implements PositionDefinition.
+func (d *KeywordDefinition) AdvancePosition(pos *Position, span string) {
+	AdvancePosition(d.def, pos, span)
+}
+
+func (d *KeywordDefinition) Lex(filename string, r io.Reader) (Lexer, error) { // nolint: golint
+	lex, err := d.def.Lex(filename, r)
+	if err != nil {
+		return nil, err
+	}
+	return &keywordLexer{def: d, lexer: lex}, nil
+}
+
+// LexString implements StringDefinition.
+func (d *KeywordDefinition) LexString(filename string, s string) (Lexer, error) {
+	lex, err := lexString(d.def, filename, s)
+	if err != nil {
+		return nil, err
+	}
+	return &keywordLexer{def: d, lexer: lex}, nil
+}
+
+type keywordLexer struct {
+	def   *KeywordDefinition
+	lexer Lexer
+}
+
+func (k *keywordLexer) Next() (Token, error) {
+	t, err := k.lexer.Next()
+	if err != nil {
+		return t, err
+	}
+	if t.Type == k.def.ident && k.def.keywords[k.def.normalise(t.Value)] {
+		t.Type = k.def.keyword
+	}
+	return t, nil
+}
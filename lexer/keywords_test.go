@@ -0,0 +1,51 @@
+package lexer_test
+
+import (
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+var keywordRules = []lexer.SimpleRule{
+	{"Ident", `\w+`},
+	{"Punct", `[,*]`},
+	{"whitespace", `\s+`},
+}
+
+func TestKeywords(t *testing.T) {
+	def := lexer.MustKeywords(lexer.MustSimple(keywordRules), "Ident", []string{"select", "from"}, lexer.KeywordsCaseInsensitive())
+	lex, err := def.LexString("", "SELECT a, selected From b")
+	require.NoError(t, err)
+	tokens, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	names := lexer.SymbolsByRune(def)
+	actual := []string{}
+	for _, token := range tokens[:len(tokens)-1] {
+		actual = append(actual, names[token.Type]+":"+token.Value)
+	}
+	require.Equal(t, []string{"Keyword:SELECT", "Ident:a", "Punct:,", "Ident:selected", "Keyword:From", "Ident:b"}, actual)
+}
+
+func TestKeywordsErrors(t *testing.T) {
+	_, err := lexer.NewKeywords(lexer.MustSimple(keywordRules), "Identifier", nil)
+	require.EqualError(t, err, `unknown token type "Identifier"`)
+	_, err = lexer.NewKeywords(lexer.MustSimple(append(keywordRules, lexer.SimpleRule{"Keyword", `@\w+`})), "Ident", nil)
+	require.EqualError(t, err, `lexer already defines the symbol "Keyword"`)
+}
+
+func TestKeywordsParse(t *testing.T) {
+	type Select struct {
+		Columns []string `"select" @(Ident | "*") ("," @Ident)*`
+		Table   string   `"from" @Ident`
+	}
+	def := lexer.MustKeywords(lexer.MustSimple(keywordRules), "Ident", []string{"select", "from"}, lexer.KeywordsCaseInsensitive())
+	parser := participle.MustBuild[Select](participle.Lexer(def), participle.CaseInsensitive("Keyword"))
+	actual, err := parser.ParseString("", "SELECT a, b FROM t")
+	require.NoError(t, err)
+	require.Equal(t, &Select{Columns: []string{"a", "b"}, Table: "t"}, actual)
+
+	_, err = parser.ParseString("", "select from from t")
+	require.EqualError(t, err, `1:8: unexpected token "from" (expected (<ident> | "*") ("," <ident>)* "from" <ident>)`)
+}
@@ -0,0 +1,133 @@
+package lexer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultLineDirective matches C-style line directives of the form:
+//
+//	#line 20 "foo.y"
+//
+// The first group is the line number and the optional second group is the filename.
+var DefaultLineDirective = regexp.MustCompile(`^#\s*line\s+(\d+)(?:\s+"([^"]*)")?`)
+
+// LineDirectives wraps a Definition so that tokens of type "symbol" are
+// treated as line directives that remap the positions of subsequent tokens.
+//
+// "directive" is matched against the value of each such token. Its first
+// group must capture the line number of the line following the directive, and
+// an optional second group may capture a new filename. Directive tokens are
+// not passed on to the parser, while tokens of type "symbol" that do not match
+// "directive" are passed through unchanged.
+//
+// This allows grammars for generated or preprocessed sources to report
+// positions in the original files.
+func LineDirectives(def Definition, symbol string, directive *regexp.Regexp) (Definition, error) {
+	rn, ok := def.Symbols()[symbol]
+	if !ok {
+		return nil, fmt.Errorf("lexer does not support symbol %q", symbol)
+	}
+	if directive.NumSubexp() < 1 {
+		return nil, fmt.Errorf("line directive %q must capture a line number", directive)
+	}
+	return &lineDirectiveDefinition{def: def, symbol: rn, directive: directive}, nil
+}
+
+type lineDirectiveDefinition struct {
+	def       Definition
+	symbol    TokenType
+	directive *regexp.Regexp
+}
+
+var _ interface {
+	StringDefinition
+	CaseInsensitiveDefinition
+	PositionDefinition
+} = &lineDirectiveDefinition{}
+
+func (d *lineDirectiveDefinition) Symbols() map[string]TokenType { // nolint: golint
+	return d.def.Symbols()
+}
+
+// CaseInsensitiveSymbols implements CaseInsensitiveDefinition.
+func (d *lineDirectiveDefinition) CaseInsensitiveSymbols() []string {
+	return caseInsensitiveSymbols(d.def)
+}
+
+// AdvancePosition implements PositionDefinition.
+func (d *lineDirectiveDefinition) AdvancePosition(pos *Position, span string) {
+	AdvancePosition(d.def, pos, span)
+}
+
+func (d *lineDirectiveDefinition) Lex(filename string, r io.Reader) (Lexer, error) { // nolint: golint
+	lex, err := d.def.Lex(filename, r)
+	if err != nil {
+		return nil, err
+	}
+	return &lineDirectiveLexer{def: d, lexer: lex}, nil
+}
+
+func (d *lineDirectiveDefinition) LexString(filename string, s string) (Lexer, error) { // nolint: golint
+	lex, err := lexString(d.def, filename, s)
+	if err != nil {
+		return nil, err
+	}
+	return &lineDirectiveLexer{def: d, lexer: lex}, nil
+}
+
+type lineDirectiveLexer struct {
+	def   *lineDirectiveDefinition
+	lexer Lexer
+	// Set once a directive has been seen.
+	remap    bool
+	filename string
+	line     int // Line the directive applies to.
+	next     int // Original line following the directive.
+}
+
+func (l *lineDirectiveLexer) Next() (Token, error) {
+	for {
+		t, err := l.lexer.Next()
+		if err != nil {
+			var lerr *Error
+			if errors.As(err, &lerr) {
+				l.remapPos(&lerr.Pos)
+			}
+			return t, err
+		}
+		if t.Type == l.def.symbol {
+			if groups := l.def.directive.FindStringSubmatch(t.Value); groups != nil {
+				line, err := strconv.Atoi(groups[1])
+				if err != nil {
+					return Token{}, errorf(t.Pos, "invalid line directive %q: %s", t.Value, err)
+				}
+				if len(groups) > 2 && groups[2] != "" {
+					l.filename = groups[2]
+				} else if !l.remap {
+					l.filename = t.Pos.Filename
+				}
+				l.remap = true
+				l.line = line
+				l.next = t.Pos.Line + strings.Count(t.Value, "\n") + 1
+				if strings.HasSuffix(t.Value, "\n") {
+					l.next--
+				}
+				continue
+			}
+		}
+		l.remapPos(&t.Pos)
+		return t, nil
+	}
+}
+
+func (l *lineDirectiveLexer) remapPos(pos *Position) {
+	if l.remap {
+		pos.Filename = l.filename
+		pos.Line = l.line + pos.Line - l.next
+	}
+}
@@ -0,0 +1,43 @@
+package lexer_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+func TestLineDirectives(t *testing.T) {
+	def, err := lexer.LineDirectives(lexer.MustSimple([]lexer.SimpleRule{
+		{"Directive", `#[^\n]*\n`},
+		{"Ident", `\w+`},
+		{"whitespace", `\s+`},
+	}), "Directive", lexer.DefaultLineDirective)
+	require.NoError(t, err)
+	lex, err := def.Lex("gen.go", strings.NewReader("a\n#line 20 \"foo.y\"\nb\n\nc\n# line 5\nd #pragma\ne"))
+	require.NoError(t, err)
+	tokens, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	actual := []string{}
+	for _, token := range tokens[:len(tokens)-1] {
+		actual = append(actual, token.Pos.String()+" "+token.Value)
+	}
+	require.Equal(t, []string{
+		"gen.go:1:1 a",
+		"foo.y:20:1 b",
+		"foo.y:22:1 c",
+		"foo.y:5:1 d",
+		"foo.y:5:3 #pragma\n",
+		"foo.y:6:1 e",
+	}, actual)
+}
+
+func TestLineDirectivesInvalid(t *testing.T) {
+	def := lexer.MustSimple([]lexer.SimpleRule{{"Ident", `\w+`}})
+	_, err := lexer.LineDirectives(def, "Directive", lexer.DefaultLineDirective)
+	require.EqualError(t, err, `lexer does not support symbol "Directive"`)
+	_, err = lexer.LineDirectives(def, "Ident", regexp.MustCompile(`line`))
+	require.EqualError(t, err, `line directive "line" must capture a line number`)
+}
@@ -0,0 +1,127 @@
+package lexer
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Merge combines several stateful lexer definitions into one.
+//
+// Rules for each state are concatenated in the order the definitions are
+// given, so earlier definitions take priority. Rules with the same name and
+// pattern, such as those shared by several fragments, are only included once.
+// Merging fails if two rules have the same name but different patterns, or the
+// same pattern but different names within a state.
+//
+// The options of the definitions, such as MaxTokenLength and Columns, are
+// combined. Merging fails if two definitions set an option to different
+// values.
+//
+// eg.
+//
+//	def, err := lexer.Merge(numbers, strings, comments)
+func Merge(defs ...*StatefulDefinition) (*StatefulDefinition, error) {
+	merged := Rules{}
+	names := map[string]Rule{}
+	returns := map[string]bool{}
+	options, err := mergeOptions(defs)
+	if err != nil {
+		return nil, err
+	}
+	for _, def := range defs {
+		rules := def.Rules()
+		states := make([]string, 0, len(rules))
+		for state := range rules {
+			states = append(states, state)
+		}
+		sort.Strings(states)
+		for _, state := range states {
+			seen := map[string]bool{}
+			patterns := map[string]Rule{}
+			for _, rule := range merged[state] {
+				seen[rule.Name] = true
+				patterns[rule.Pattern] = rule
+			}
+			for _, rule := range rules[state] {
+				if rule == ReturnRule {
+					returns[state] = true
+					continue
+				}
+				if existing, ok := names[rule.Name]; ok && existing.Pattern != rule.Pattern {
+					return nil, fmt.Errorf("rule %q is defined with conflicting patterns %q and %q", rule.Name, existing.Pattern, rule.Pattern)
+				}
+				if existing, ok := patterns[rule.Pattern]; ok && existing.Name != rule.Name {
+					return nil, fmt.Errorf("rules %q and %q have the same pattern %q", existing.Name, rule.Name, rule.Pattern)
+				}
+				names[rule.Name] = rule
+				patterns[rule.Pattern] = rule
+				if seen[rule.Name] {
+					continue
+				}
+				seen[rule.Name] = true
+				merged[state] = append(merged[state], rule)
+			}
+		}
+	}
+	// Return() must remain the final rule of a state.
+	for state := range returns {
+		merged[state] = append(merged[state], ReturnRule)
+	}
+	return New(merged, options...)
+}
+
+// Combine the options of defs, failing if two definitions set an option to different values.
+func mergeOptions(defs []*StatefulDefinition) ([]Option, error) {
+	merged := &StatefulDefinition{}
+	for _, def := range defs {
+		merged.errorTokens = merged.errorTokens || def.errorTokens
+		merged.offsetsOnly = merged.offsetsOnly || def.offsetsOnly
+		merged.zeroCopy = merged.zeroCopy || def.zeroCopy
+		merged.caseInsensitive = append(merged.caseInsensitive, def.caseInsensitive...)
+		if err := mergeOption("Columns", &merged.columns, def.columns); err != nil {
+			return nil, err
+		}
+		if err := mergeOption("TabWidth", &merged.tabWidth, def.tabWidth); err != nil {
+			return nil, err
+		}
+		if err := mergeOption("MaxTokenLength", &merged.maxTokenLength, def.maxTokenLength); err != nil {
+			return nil, err
+		}
+	}
+	var options []Option
+	if merged.errorTokens {
+		options = append(options, ErrorTokens())
+	}
+	if merged.offsetsOnly {
+		options = append(options, OffsetsOnly())
+	}
+	if merged.zeroCopy {
+		options = append(options, ZeroCopy())
+	}
+	if len(merged.caseInsensitive) > 0 {
+		options = append(options, CaseInsensitive(merged.caseInsensitive...))
+	}
+	if merged.columns != ColumnRunes {
+		options = append(options, Columns(merged.columns))
+	}
+	if merged.tabWidth != 0 {
+		options = append(options, TabWidth(merged.tabWidth))
+	}
+	if merged.maxTokenLength != 0 {
+		options = append(options, MaxTokenLength(merged.maxTokenLength))
+	}
+	return options, nil
+}
+
+// Set "merged" to "value" unless it is the zero value, failing if "merged" is already set to another value.
+func mergeOption[T comparable](name string, merged *T, value T) error {
+	var zero T
+	if value == zero {
+		return nil
+	}
+	if *merged != zero && *merged != value {
+		return fmt.Errorf("conflicting %s options %v and %v", name, *merged, value)
+	}
+	*merged = value
+	return nil
+}
@@ -0,0 +1,80 @@
+package lexer_test
+
+import (
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+func TestMerge(t *testing.T) {
+	numbers := lexer.MustSimple([]lexer.SimpleRule{
+		{"Number", `\d+`},
+		{"whitespace", `\s+`},
+	})
+	strings := lexer.MustStateful(lexer.Rules{
+		"Root": {
+			{"String", `"`, lexer.Push("String")},
+			{"whitespace", `\s+`, nil},
+		},
+		"String": {
+			{"StringEnd", `"`, lexer.Pop()},
+			{"Char", `[^"]+`, nil},
+		},
+	})
+	idents := lexer.MustSimple([]lexer.SimpleRule{{"Ident", `\w+`}})
+	def, err := lexer.Merge(numbers, strings, idents)
+	require.NoError(t, err)
+	require.Equal(t, lexer.Rules{
+		"Root": {
+			{"Number", `\d+`, nil},
+			{"whitespace", `\s+`, nil},
+			{"String", `"`, lexer.Push("String")},
+			{"Ident", `\w+`, nil},
+		},
+		"String": {
+			{"StringEnd", `"`, lexer.Pop()},
+			{"Char", `[^"]+`, nil},
+		},
+	}, def.Rules())
+
+	lex, err := def.LexString("", `123 "abc" abc`)
+	require.NoError(t, err)
+	tokens, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	actual := []string{}
+	for _, token := range tokens[:len(tokens)-1] {
+		actual = append(actual, token.Value)
+	}
+	require.Equal(t, []string{"123", `"`, "abc", `"`, "abc"}, actual)
+}
+
+func TestMergeConflicts(t *testing.T) {
+	a := lexer.MustSimple([]lexer.SimpleRule{{"Ident", `\w+`}})
+	b := lexer.MustSimple([]lexer.SimpleRule{{"Ident", `[a-z]+`}})
+	c := lexer.MustSimple([]lexer.SimpleRule{{"Word", `\w+`}})
+	_, err := lexer.Merge(a, b)
+	require.EqualError(t, err, `rule "Ident" is defined with conflicting patterns "\\w+" and "[a-z]+"`)
+	_, err = lexer.Merge(a, c)
+	require.EqualError(t, err, `rules "Ident" and "Word" have the same pattern "\\w+"`)
+}
+
+func TestMergeOptions(t *testing.T) {
+	limited := lexer.MustSimple([]lexer.SimpleRule{{"Ident", `[a-z]+`}}, lexer.MaxTokenLength(3), lexer.CaseInsensitive("Ident"))
+	columns := lexer.MustSimple([]lexer.SimpleRule{{"whitespace", `\s+`}}, lexer.Columns(lexer.ColumnBytes), lexer.TabWidth(4))
+	def, err := lexer.Merge(limited, columns)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Ident"}, def.CaseInsensitiveSymbols())
+	lex, err := def.LexString("", "\tABC")
+	require.NoError(t, err)
+	tokens, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	require.Equal(t, 5, tokens[0].Pos.Column)
+	lex, err = def.LexString("", "abcdefgh")
+	require.NoError(t, err)
+	_, err = lexer.ConsumeAll(lex)
+	require.EqualError(t, err, `1:1: rule "Ident": token exceeds the maximum length of 3 bytes`)
+
+	_, err = lexer.Merge(limited, lexer.MustSimple([]lexer.SimpleRule{{"Int", `\d+`}}, lexer.MaxTokenLength(8)))
+	require.EqualError(t, err, `conflicting MaxTokenLength options 3 and 8`)
+}
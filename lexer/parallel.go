@@ -0,0 +1,157 @@
+package lexer
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Parallel wraps a Definition so that large inputs are split into chunks of
+// approximately "chunkSize" bytes, which are lexed concurrently.
+//
+// Chunks are split after a newline, and the positions of tokens and errors in
+// each chunk are corrected to be relative to the start of the input. This is
+// only safe for line-oriented formats where each line can be lexed
+// independently, ie. every line starts in the lexer's initial state and no
+// token spans a line boundary other than by ending with a newline.
+//
+// Inputs smaller than twice the chunk size are lexed sequentially.
+func Parallel(def Definition, chunkSize int) Definition {
+	return &parallelDefinition{def: def, chunkSize: chunkSize}
+}
+
+type parallelDefinition struct {
+	def       Definition
+	chunkSize int
+}
+
+var _ interface {
+	StringDefinition
+	CaseInsensitiveDefinition
+	PositionDefinition
+} = &parallelDefinition{}
+
+func (p *parallelDefinition) Symbols() map[string]TokenType { // nolint: golint
+	return p.def.Symbols()
+}
+
+// CaseInsensitiveSymbols implements CaseInsensitiveDefinition.
+func (p *parallelDefinition) CaseInsensitiveSymbols() []string {
+	return caseInsensitiveSymbols(p.def)
+}
+
+// AdvancePosition implements PositionDefinition.
+func (p *parallelDefinition) AdvancePosition(pos *Position, span string) {
+	AdvancePosition(p.def, pos, span)
+}
+
+func (p *parallelDefinition) Lex(filename string, r io.Reader) (Lexer, error) { // nolint: golint
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return p.LexString(filename, string(data))
+}
+
+func (p *parallelDefinition) LexString(filename string, s string) (Lexer, error) { // nolint: golint
+	if p.chunkSize <= 0 || len(s) < p.chunkSize*2 {
+		return lexString(p.def, filename, s)
+	}
+	chunks := p.split(s)
+	results := make([]parallelChunk, len(chunks))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	wg := sync.WaitGroup{}
+	offset, line := 0, 1
+	for i, chunk := range chunks {
+		results[i].offset, results[i].line = offset, line
+		offset += len(chunk)
+		line += strings.Count(chunk, "\n")
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(result *parallelChunk, chunk string) {
+			defer func() { <-sem; wg.Done() }()
+			result.lex(p.def, filename, chunk)
+		}(&results[i], chunk)
+	}
+	wg.Wait()
+	return &parallelLexer{chunks: results}, nil
+}
+
+// Split s into chunks ending with a newline, except for the last.
+func (p *parallelDefinition) split(s string) []string {
+	chunks := []string{}
+	for len(s) > p.chunkSize {
+		end := strings.IndexByte(s[p.chunkSize:], '\n')
+		if end < 0 {
+			break
+		}
+		end += p.chunkSize + 1
+		chunks = append(chunks, s[:end])
+		s = s[end:]
+	}
+	return append(chunks, s)
+}
+
+type parallelChunk struct {
+	offset int // Offset of the chunk in the input.
+	line   int // Line the chunk starts on.
+	tokens []Token
+	eof    Token
+	err    error
+}
+
+func (c *parallelChunk) lex(def Definition, filename string, chunk string) {
+	lex, err := lexString(def, filename, chunk)
+	if err != nil {
+		c.err = err
+		return
+	}
+	for {
+		t, err := lex.Next()
+		if err != nil {
+			var lerr *Error
+			if errors.As(err, &lerr) {
+				c.remap(&lerr.Pos)
+			}
+			c.err = err
+			return
+		}
+		c.remap(&t.Pos)
+		if t.EOF() {
+			c.eof = t
+			return
+		}
+		c.tokens = append(c.tokens, t)
+	}
+}
+
+func (c *parallelChunk) remap(pos *Position) {
+	pos.Offset += c.offset
+	if pos.Line > 0 {
+		pos.Line += c.line - 1
+	}
+}
+
+type parallelLexer struct {
+	chunks []parallelChunk
+}
+
+func (p *parallelLexer) Next() (Token, error) {
+	for {
+		chunk := &p.chunks[0]
+		if len(chunk.tokens) > 0 {
+			t := chunk.tokens[0]
+			chunk.tokens = chunk.tokens[1:]
+			return t, nil
+		}
+		if chunk.err != nil {
+			return Token{}, chunk.err
+		}
+		if len(p.chunks) == 1 {
+			return chunk.eof, nil
+		}
+		p.chunks = p.chunks[1:]
+	}
+}
@@ -0,0 +1,35 @@
+package lexer_test
+
+import (
+	"strings"
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+func TestParallel(t *testing.T) {
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Ident", `[\pL\d_]+`},
+		{"Punct", `[=;]`},
+		{"Newline", `\n`},
+		{"whitespace", `[ \t]+`},
+	})
+	input := strings.Repeat("key = value;\nα = β;\n\n", 100)
+	lex, err := def.LexString("test", input)
+	require.NoError(t, err)
+	expected, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+
+	parallel := lexer.Parallel(def, 64)
+	lex, err = parallel.Lex("test", strings.NewReader(input))
+	require.NoError(t, err)
+	actual, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	require.Equal(t, expected, actual)
+
+	lex, err = parallel.(lexer.StringDefinition).LexString("test", input+input+"ok\nbad!")
+	require.NoError(t, err)
+	_, err = lexer.ConsumeAll(lex)
+	require.EqualError(t, err, `test:602:4: invalid input text "!"`)
+}
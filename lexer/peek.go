@@ -4,7 +4,7 @@ package lexer
 type PeekingLexer struct {
 	Checkpoint
 	tokens []Token
-	elide  map[TokenType]bool
+	elide  elideSet
 }
 
 // RawCursor index in the token stream.
@@ -24,10 +24,7 @@ type Checkpoint struct {
 // "elide" is a slice of token types to elide from processing.
 func Upgrade(lex Lexer, elide ...TokenType) (*PeekingLexer, error) {
 	r := &PeekingLexer{
-		elide: make(map[TokenType]bool, len(elide)),
-	}
-	for _, rn := range elide {
-		r.elide[rn] = true
+		elide: newElideSet(elide),
 	}
 	for {
 		t, err := lex.Next()
@@ -83,11 +80,39 @@ func (p *PeekingLexer) RawPeek() *Token {
 	return &p.tokens[p.rawCursor]
 }
 
+// PeekN peeks ahead at the n'th next non-elided token, where PeekN(0) is equivalent to Peek().
+//
+// If fewer than n tokens remain, the EOF token is returned.
+func (p *PeekingLexer) PeekN(n int) *Token {
+	cursor := p.nextCursor
+	for ; n > 0; n-- {
+		if p.tokens[cursor].EOF() {
+			break
+		}
+		cursor++
+		for !p.tokens[cursor].EOF() && p.elide.has(p.tokens[cursor].Type) {
+			cursor++
+		}
+	}
+	return &p.tokens[cursor]
+}
+
+// RawPeekN peeks ahead at the n'th next raw token, where RawPeekN(0) is equivalent to RawPeek().
+//
+// Unlike PeekN, this will include elided tokens. If fewer than n tokens remain, the EOF token is returned.
+func (p *PeekingLexer) RawPeekN(n int) *Token {
+	cursor := int(p.rawCursor) + n
+	if cursor >= len(p.tokens) {
+		cursor = len(p.tokens) - 1
+	}
+	return &p.tokens[cursor]
+}
+
 // advanceToNonElided advances nextCursor to the closest non-elided token
 func (p *PeekingLexer) advanceToNonElided() {
 	for ; ; p.nextCursor++ {
 		t := &p.tokens[p.nextCursor]
-		if t.EOF() || !p.elide[t.Type] {
+		if t.EOF() || !p.elide.has(t.Type) {
 			return
 		}
 	}
@@ -103,7 +128,7 @@ func (p *PeekingLexer) advanceToNonElided() {
 func (p *PeekingLexer) PeekAny(match func(Token) bool) (t Token, rawCursor RawCursor) {
 	for i := p.rawCursor; ; i++ {
 		t = p.tokens[i]
-		if t.EOF() || match(t) || !p.elide[t.Type] {
+		if t.EOF() || match(t) || !p.elide.has(t.Type) {
 			return t, i
 		}
 	}
@@ -116,7 +141,7 @@ func (p *PeekingLexer) FastForward(rawCursor RawCursor) {
 		if t.EOF() {
 			break
 		}
-		if !p.elide[t.Type] {
+		if !p.elide.has(t.Type) {
 			p.cursor++
 		}
 	}
@@ -124,6 +149,25 @@ func (p *PeekingLexer) FastForward(rawCursor RawCursor) {
 	p.advanceToNonElided()
 }
 
+// CheckpointBefore returns a Checkpoint positioned "n" non-elided tokens before the next token.
+//
+// It returns false if fewer than "n" tokens have been consumed.
+func (p *PeekingLexer) CheckpointBefore(n int) (Checkpoint, bool) {
+	if n > p.cursor {
+		return Checkpoint{}, false
+	} else if n == 0 {
+		return p.Checkpoint, true
+	}
+	i := p.rawCursor
+	for count := 0; count < n; {
+		i--
+		if !p.elide.has(p.tokens[i].Type) {
+			count++
+		}
+	}
+	return Checkpoint{rawCursor: i, nextCursor: i, cursor: p.cursor - n}, true
+}
+
 func (p *PeekingLexer) MakeCheckpoint() Checkpoint {
 	return p.Checkpoint
 }
@@ -131,3 +175,53 @@ func (p *PeekingLexer) MakeCheckpoint() Checkpoint {
 func (p *PeekingLexer) LoadCheckpoint(checkpoint Checkpoint) {
 	p.Checkpoint = checkpoint
 }
+
+// maxDenseElideRange is the largest range of token types that an elideSet
+// stores densely, above which it falls back to a map.
+const maxDenseElideRange = 256
+
+// elideSet is a set of token types.
+//
+// Types are indexed relative to the smallest type in a dense slice, unless
+// they span more than maxDenseElideRange types, in which case they are stored
+// in a map.
+type elideSet struct {
+	offset TokenType
+	types  []bool
+	sparse map[TokenType]bool
+}
+
+func newElideSet(elide []TokenType) elideSet {
+	if len(elide) == 0 {
+		return elideSet{}
+	}
+	min, max := elide[0], elide[0]
+	for _, rn := range elide {
+		if rn < min {
+			min = rn
+		}
+		if rn > max {
+			max = rn
+		}
+	}
+	if uint64(int64(max)-int64(min)) >= maxDenseElideRange {
+		set := elideSet{sparse: make(map[TokenType]bool, len(elide))}
+		for _, rn := range elide {
+			set.sparse[rn] = true
+		}
+		return set
+	}
+	set := elideSet{offset: min, types: make([]bool, max-min+1)}
+	for _, rn := range elide {
+		set.types[rn-min] = true
+	}
+	return set
+}
+
+func (e elideSet) has(t TokenType) bool {
+	if e.sparse != nil {
+		return e.sparse[t]
+	}
+	i := uint(t - e.offset)
+	return i < uint(len(e.types)) && e.types[i]
+}
@@ -1,6 +1,7 @@
 package lexer_test
 
 import (
+	"math"
 	"testing"
 
 	require "github.com/alecthomas/assert/v2"
@@ -56,6 +57,106 @@ func TestPeekingLexer_Peek_Next_Checkpoint(t *testing.T) {
 	require.Equal(t, expected[0], *plex.Peek(), "should have reverted to pre-Next state")
 }
 
+func TestPeekingLexer_PeekN(t *testing.T) {
+	tokens := []lexer.Token{
+		{Type: 1, Value: "a"},
+		{Type: 3, Value: " "},
+		{Type: 2, Value: "b"},
+		{Type: 3, Value: " "},
+		{Type: 1, Value: "c"},
+	}
+	l, err := lexer.Upgrade(&staticLexer{tokens: tokens}, 3)
+	require.NoError(t, err)
+	require.Equal(t, l.Peek(), l.PeekN(0))
+	require.Equal(t, tokens[2], *l.PeekN(1))
+	require.Equal(t, tokens[4], *l.PeekN(2))
+	require.True(t, l.PeekN(3).EOF())
+	require.True(t, l.PeekN(100).EOF())
+	require.Equal(t, l.RawPeek(), l.RawPeekN(0))
+	require.Equal(t, tokens[1], *l.RawPeekN(1))
+	require.True(t, l.RawPeekN(100).EOF())
+
+	l.Next()
+	checkpoint := l.Checkpoint
+	require.Equal(t, tokens[4], *l.PeekN(1))
+	require.Equal(t, tokens[3], *l.RawPeekN(2))
+	require.Equal(t, checkpoint, l.Checkpoint, "PeekN should not advance the lexer")
+}
+
+func TestPeekingLexer_Elide(t *testing.T) {
+	tokens := []lexer.Token{
+		{Type: -5, Value: "a"},
+		{Type: -2, Value: "//"},
+		{Type: '+', Value: "+"},
+		{Type: ' ', Value: " "},
+		{Type: -4, Value: "b"},
+	}
+	l, err := lexer.Upgrade(&staticLexer{tokens: tokens}, -2, ' ')
+	require.NoError(t, err)
+	actual := []lexer.Token{}
+	for !l.Peek().EOF() {
+		actual = append(actual, *l.Next())
+	}
+	require.Equal(t, []lexer.Token{tokens[0], tokens[2], tokens[4]}, actual)
+}
+
+func TestPeekingLexer_ElideSparse(t *testing.T) {
+	tokens := []lexer.Token{
+		{Type: -5, Value: "a"},
+		{Type: math.MinInt32, Value: "//"},
+		{Type: '+', Value: "+"},
+		{Type: math.MaxInt32, Value: " "},
+		{Type: -4, Value: "b"},
+	}
+	l, err := lexer.Upgrade(&staticLexer{tokens: tokens}, math.MinInt32, math.MaxInt32)
+	require.NoError(t, err)
+	actual := []lexer.Token{}
+	for !l.Peek().EOF() {
+		actual = append(actual, *l.Next())
+	}
+	require.Equal(t, []lexer.Token{tokens[0], tokens[2], tokens[4]}, actual)
+}
+
+func TestPeekingLexer_CheckpointBefore(t *testing.T) {
+	tokens := []lexer.Token{
+		{Type: -5, Value: "a"},
+		{Type: ' ', Value: " "},
+		{Type: -4, Value: "b"},
+		{Type: ' ', Value: " "},
+		{Type: -4, Value: "c"},
+	}
+	l, err := lexer.Upgrade(&staticLexer{tokens: tokens}, ' ')
+	require.NoError(t, err)
+	l.Next()
+	l.Next()
+	checkpoint, ok := l.CheckpointBefore(2)
+	require.True(t, ok)
+	require.Equal(t, 0, checkpoint.Cursor())
+	_, ok = l.CheckpointBefore(3)
+	require.False(t, ok)
+
+	l.LoadCheckpoint(checkpoint)
+	require.Equal(t, "a", l.Next().Value)
+	require.Equal(t, "b", l.Next().Value)
+	require.Equal(t, "c", l.Peek().Value)
+}
+
+func BenchmarkPeekingLexer_Next(b *testing.B) {
+	tokens := make([]lexer.Token, 0, 2000)
+	for i := 0; i < 1000; i++ {
+		tokens = append(tokens, lexer.Token{Type: -2, Value: "x"}, lexer.Token{Type: -3, Value: " "})
+	}
+	l, err := lexer.Upgrade(&staticLexer{tokens: tokens}, -3)
+	require.NoError(b, err)
+	start := l.Checkpoint
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Checkpoint = start
+		for !l.Next().EOF() {
+		}
+	}
+}
+
 func BenchmarkPeekingLexer_Peek(b *testing.B) {
 	tokens := []lexer.Token{{Type: 1, Value: "x"}, {Type: 3, Value: " "}, {Type: 2, Value: "y"}}
 	l, err := lexer.Upgrade(&staticLexer{tokens: tokens}, 3)
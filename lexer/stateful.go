@@ -11,6 +11,8 @@ import (
 	"strings"
 	"sync"
 	"unicode"
+	"unicode/utf8"
+	"unsafe"
 )
 
 var (
@@ -71,6 +73,18 @@ func (r *Rule) UnmarshalJSON(data []byte) error {
 			return err
 		}
 		action = actual
+	case "until":
+		actual := ActionUntil{}
+		if err := json.Unmarshal(jrule.Action, &actual); err != nil {
+			return err
+		}
+		action = actual
+	case "balanced":
+		actual := ActionBalanced{}
+		if err := json.Unmarshal(jrule.Action, &actual); err != nil {
+			return err
+		}
+		action = actual
 	case "":
 	default:
 		return fmt.Errorf("unknown action %q", jaction.Kind)
@@ -102,6 +116,10 @@ func (r *Rule) MarshalJSON() ([]byte, error) {
 			jaction["kind"] = "push"
 		case include:
 			jaction["kind"] = "include"
+		case ActionUntil:
+			jaction["kind"] = "until"
+		case ActionBalanced:
+			jaction["kind"] = "balanced"
 		default:
 			return nil, fmt.Errorf("unsupported action %T", r.Action)
 		}
@@ -196,6 +214,149 @@ func Push(state string) Action {
 	return ActionPush{state}
 }
 
+// ActionUntil extends the token matched by a Rule up to and including the
+// first subsequent match of "Pattern".
+type ActionUntil struct {
+	Pattern string `json:"pattern"`
+}
+
+func (u ActionUntil) applyAction(lexer *StatefulLexer, groups []string) error {
+	// Lazily skip to the first match of the terminator.
+	re, err := BackrefRegex(&lexer.def.backrefCache, `(?s:.*?)(?:`+u.Pattern+`)`, groups)
+	if err != nil {
+		return err
+	}
+	data, truncated := lexer.actionWindow(len(groups[0]))
+	loc := re.FindStringIndex(data)
+	if loc == nil {
+		if truncated {
+			return lexer.errTokenTooLong()
+		}
+		return fmt.Errorf("unterminated %q", groups[0])
+	}
+	lexer.extend = loc[1]
+	return nil
+}
+
+func (u ActionUntil) validate(rules Rules) error {
+	if backrefReplace.MatchString(u.Pattern) {
+		return nil
+	}
+	_, err := regexp.Compile(u.Pattern)
+	return err
+}
+
+// Until extends the matched token up to and including the next match of pattern.
+//
+// Backreferences (\1, \2, ...) in pattern refer to the groups captured by the
+// rule's own pattern, which allows delimiters chosen by the input to be
+// matched. eg. a heredoc or a Rust-style raw string:
+//
+//	{"Heredoc", `<<(\w+)\b`, lexer.Until(`\n\1\b`)}
+//	{"RawString", `r(#*)"`, lexer.Until(`"\1`)}
+//
+// The search for pattern starts after the text matched by the rule, so the
+// heredoc rule leaves the newline following the delimiter to pattern, which
+// allows the body to be empty.
+func Until(pattern string) Action {
+	return ActionUntil{pattern}
+}
+
+// ActionBalanced extends the token matched by a Rule up to and including the
+// "Close" delimiter balancing the opening delimiter matched by the rule.
+type ActionBalanced struct {
+	Open   string   `json:"open"`
+	Close  string   `json:"close"`
+	Quotes []string `json:"quotes,omitempty"`
+}
+
+func (b ActionBalanced) applyAction(lexer *StatefulLexer, groups []string) error {
+	data, truncated := lexer.actionWindow(len(groups[0]))
+	depth := 1
+	for i := 0; i < len(data); {
+		switch rest := data[i:]; {
+		case strings.HasPrefix(rest, b.Close):
+			i += len(b.Close)
+			depth--
+			if depth == 0 {
+				lexer.extend = i
+				return nil
+			}
+		case strings.HasPrefix(rest, b.Open):
+			i += len(b.Open)
+			depth++
+		default:
+			quote := b.quote(rest)
+			if quote == "" {
+				i++
+				continue
+			}
+			end := b.skipQuoted(rest[len(quote):], quote)
+			if end < 0 {
+				if truncated {
+					return lexer.errTokenTooLong()
+				}
+				return fmt.Errorf("unterminated %s in %q", quote, groups[0])
+			}
+			i += len(quote) + end
+		}
+	}
+	if truncated {
+		return lexer.errTokenTooLong()
+	}
+	return fmt.Errorf("unbalanced %q", groups[0])
+}
+
+func (b ActionBalanced) quote(data string) string {
+	for _, quote := range b.Quotes {
+		if strings.HasPrefix(data, quote) {
+			return quote
+		}
+	}
+	return ""
+}
+
+// Returns the offset following the closing quote, or -1 if there is none.
+func (b ActionBalanced) skipQuoted(data string, quote string) int {
+	for i := 0; i < len(data); i++ {
+		switch {
+		case data[i] == '\\':
+			i++
+		case strings.HasPrefix(data[i:], quote):
+			return i + len(quote)
+		}
+	}
+	return -1
+}
+
+func (b ActionBalanced) validate(rules Rules) error {
+	if b.Open == "" || b.Close == "" {
+		return errors.New("balanced delimiters must not be empty")
+	}
+	if b.Open == b.Close {
+		return fmt.Errorf("balanced delimiters must differ, got %q", b.Open)
+	}
+	for _, quote := range b.Quotes {
+		if quote == "" {
+			return errors.New("balanced quotes must not be empty")
+		}
+	}
+	return nil
+}
+
+// Balanced extends the matched token up to and including the close delimiter
+// that balances it, honouring nested open/close pairs.
+//
+// The rule's pattern should match the opening delimiter. Delimiters within
+// quoted strings, delimited by any of "quotes" and with backslash escapes, are
+// ignored. This allows regions of embedded languages to be lexed as a single
+// token. eg.
+//
+//	{"Block", `\{`, lexer.Balanced("{", "}", `"`, "'")}
+func Balanced(open, close string, quotes ...string) Action {
+	return ActionBalanced{Open: open, Close: close, Quotes: quotes}
+}
+
 type include struct {
 	State string `json:"state"`
 }
@@ -220,18 +381,121 @@ func Include(state string) Rule {
 	return Rule{Action: include{state}}
 }
 
+// Option for modifying how the Lexer works.
+type Option func(d *StatefulDefinition)
+
+// ErrorTokens causes input that does not match any rule to be emitted as an
+// "Error" token rather than aborting lexing.
+//
+// Consecutive unmatched characters are merged into a single token, so that
+// the parser (and any error recovery) can continue from the next valid token.
+func ErrorTokens() Option {
+	return func(d *StatefulDefinition) {
+		d.errorTokens = true
+	}
+}
+
+// ColumnUnit is the unit in which Position.Column is measured.
+type ColumnUnit int
+
+const (
+	// ColumnRunes counts columns in Unicode code points. This is the default.
+	ColumnRunes ColumnUnit = iota
+	// ColumnBytes counts columns in bytes.
+	ColumnBytes
+	// ColumnUTF16 counts columns in UTF-16 code units, as used by eg. the Language Server Protocol.
+	ColumnUTF16
+)
+
+// Columns sets the unit that Position.Column is measured in.
+func Columns(unit ColumnUnit) Option {
+	return func(d *StatefulDefinition) {
+		d.columns = unit
+	}
+}
+
+// TabWidth advances the column of a tab character to the next multiple of n.
+//
+// By default a tab counts as a single column.
+func TabWidth(n int) Option {
+	return func(d *StatefulDefinition) {
+		d.tabWidth = n
+	}
+}
+
+// OffsetsOnly disables line and column tracking, leaving them as zero.
+//
+// Only Position.Offset is populated, which avoids scanning each token for
+// newlines and characters.
+func OffsetsOnly() Option {
+	return func(d *StatefulDefinition) {
+		d.offsetsOnly = true
+	}
+}
+
+// MaxTokenLength limits the amount of input, in bytes, that each rule is matched against.
+//
+// Go's regular expressions run in time linear in the size of their input, but
+// as rules are matched against all of the remaining input, a pattern such as
+// `[a-z]*;` can still take quadratic time over hostile input. Limiting the
+// input bounds the work done per token. A token exceeding the limit, including
+// any input consumed by Until or Balanced actions, results in an error at its
+// position.
+func MaxTokenLength(n int) Option {
+	return func(d *StatefulDefinition) {
+		d.maxTokenLength = n
+	}
+}
+
+// ZeroCopy makes LexBytes reference its input directly rather than copying it.
+//
+// Token values, and any strings captured from them by a parser, then share
+// memory with the input, so it must not be modified or reused, eg. by a
+// bufio.Scanner or a buffer pool, while any of them are in use.
+func ZeroCopy() Option {
+	return func(d *StatefulDefinition) {
+		d.zeroCopy = true
+	}
+}
+
+// CaseInsensitive makes the rules with the given names match case-insensitively.
+//
+// This is equivalent to prefixing each of their patterns with "(?i)". The
+// participle parser will also match literals of these token types
+// case-insensitively.
+func CaseInsensitive(names ...string) Option {
+	return func(d *StatefulDefinition) {
+		d.caseInsensitive = append(d.caseInsensitive, names...)
+	}
+}
+
 // StatefulDefinition is the lexer.Definition.
 type StatefulDefinition struct {
 	rules   compiledRules
 	symbols map[string]TokenType
 	// Map of key->*regexp.Regexp
-	backrefCache sync.Map
-	matchLongest bool
+	backrefCache    sync.Map
+	combined        map[string]*combinedState
+	matchLongest    bool
+	errorTokens     bool
+	caseInsensitive []string
+	columns         ColumnUnit
+	tabWidth        int
+	offsetsOnly     bool
+	maxTokenLength  int
+	zeroCopy        bool
 }
 
+var _ interface {
+	StringDefinition
+	BytesDefinition
+	CaseInsensitiveDefinition
+	PositionDefinition
+} = &StatefulDefinition{}
+
 // MustStateful creates a new stateful lexer and panics if it is incorrect.
-func MustStateful(rules Rules) *StatefulDefinition {
-	def, err := New(rules)
+func MustStateful(rules Rules, options ...Option) *StatefulDefinition {
+	def, err := New(rules, options...)
 	if err != nil {
 		panic(err)
 	}
@@ -239,10 +503,24 @@ func MustStateful(rules Rules) *StatefulDefinition {
 }
 
 // New constructs a new stateful lexer from rules.
-func New(rules Rules) (*StatefulDefinition, error) {
+func New(rules Rules, options ...Option) (*StatefulDefinition, error) {
+	d := &StatefulDefinition{}
+	for _, option := range options {
+		option(d)
+	}
+	if d.tabWidth < 0 {
+		return nil, fmt.Errorf("tab width must not be negative but is %d", d.tabWidth)
+	}
+	caseInsensitive := make(map[string]bool, len(d.caseInsensitive))
+	for _, name := range d.caseInsensitive {
+		caseInsensitive[name] = true
+	}
 	compiled := compiledRules{}
 	for key, set := range rules {
 		for i, rule := range set {
+			if caseInsensitive[rule.Name] && !strings.HasPrefix(rule.Pattern, "(?i)") {
+				rule.Pattern = "(?i)" + rule.Pattern
+			}
 			if validate, ok := rule.Action.(validatingRule); ok {
 				if err := validate.validate(rules); err != nil {
 					return nil, fmt.Errorf("invalid action for rule %q: %w", rule.Name, err)
@@ -299,9 +577,26 @@ restart:
 			rn--
 		}
 	}
-	d := &StatefulDefinition{
-		rules:   compiled,
-		symbols: symbols,
+	for _, name := range d.caseInsensitive {
+		if _, ok := symbols[name]; !ok {
+			return nil, fmt.Errorf("case-insensitive rule %q does not exist", name)
+		}
+	}
+	if d.errorTokens {
+		if _, ok := symbols["Error"]; ok {
+			return nil, fmt.Errorf("rule %q conflicts with the token emitted by ErrorTokens()", "Error")
+		}
+		symbols["Error"] = rn
+	}
+	d.rules = compiled
+	d.symbols = symbols
+	if !d.matchLongest {
+		d.combined = map[string]*combinedState{}
+		for state, rules := range compiled {
+			if combined := combineState(rules); combined != nil {
+				d.combined[state] = combined
+			}
+		}
 	}
 	return d, nil
 }
@@ -323,18 +618,32 @@ func (d *StatefulDefinition) Rules() Rules {
 
 // LexString is a fast-path implementation for lexing strings.
 func (d *StatefulDefinition) LexString(filename string, s string) (Lexer, error) {
+	pos := Position{
+		Filename: filename,
+		Line:     1,
+		Column:   1,
+	}
+	if d.offsetsOnly {
+		pos = Position{Filename: filename}
+	}
 	return &StatefulLexer{
 		def:   d,
 		data:  s,
 		stack: []lexerState{{name: "Root"}},
-		pos: Position{
-			Filename: filename,
-			Line:     1,
-			Column:   1,
-		},
+		pos:   pos,
 	}, nil
 }
 
+// LexBytes is a fast-path implementation for lexing bytes.
+//
+// The input is copied unless the ZeroCopy option is set.
+func (d *StatefulDefinition) LexBytes(filename string, b []byte) (Lexer, error) {
+	if d.zeroCopy {
+		return d.LexString(filename, *(*string)(unsafe.Pointer(&b)))
+	}
+	return d.LexString(filename, string(b))
+}
+
 func (d *StatefulDefinition) Lex(filename string, r io.Reader) (Lexer, error) { // nolint: golint
 	w := &strings.Builder{}
 	_, err := io.Copy(w, r)
@@ -348,6 +657,55 @@ func (d *StatefulDefinition) Symbols() map[string]TokenType { // nolint: golint
 	return d.symbols
 }
 
+// CaseInsensitiveSymbols implements CaseInsensitiveDefinition.
+//
+// A rule is case-insensitive if its pattern starts with "(?i)", either
+// explicitly or via the CaseInsensitive option.
+func (d *StatefulDefinition) CaseInsensitiveSymbols() []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, rules := range d.rules {
+		for _, rule := range rules {
+			if !seen[rule.Name] && strings.HasPrefix(rule.Pattern, "(?i)") {
+				seen[rule.Name] = true
+				out = append(out, rule.Name)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// AdvancePosition implements PositionDefinition, honouring the position options of the definition.
+func (d *StatefulDefinition) AdvancePosition(pos *Position, span string) {
+	switch {
+	case d.offsetsOnly:
+		pos.Offset += len(span)
+		return
+	case d.columns == ColumnRunes && d.tabWidth == 0:
+		pos.Advance(span)
+		return
+	}
+	pos.Offset += len(span)
+	for len(span) > 0 {
+		r, size := utf8.DecodeRuneInString(span)
+		span = span[size:]
+		switch {
+		case r == '\n':
+			pos.Line++
+			pos.Column = 1
+		case r == '\t' && d.tabWidth > 0:
+			pos.Column += d.tabWidth - (pos.Column-1)%d.tabWidth
+		case d.columns == ColumnBytes:
+			pos.Column += size
+		case d.columns == ColumnUTF16 && r >= 0x10000:
+			pos.Column += 2
+		default:
+			pos.Column++
+		}
+	}
+}
+
 // lexerState stored when switching states in the lexer.
 type lexerState struct {
 	name   string
@@ -356,10 +714,14 @@ type lexerState struct {
 
 // StatefulLexer implementation.
 type StatefulLexer struct {
-	stack []lexerState
-	def   *StatefulDefinition
-	data  string
-	pos   Position
+	stack  []lexerState
+	def    *StatefulDefinition
+	data   string
+	pos    Position
+	extend int // Bytes to extend the current match by, set by actions.
+	// State and rule that produced the most recent token.
+	state string
+	rule  string
 }
 
 func (l *StatefulLexer) Next() (Token, error) { // nolint: golint
@@ -372,68 +734,156 @@ next:
 			m     []int
 			match []int
 		)
-		for i, candidate := range rules {
-			// Special case "Return()".
-			if candidate.Rule == ReturnRule {
-				l.stack = l.stack[:len(l.stack)-1]
-				parent = l.stack[len(l.stack)-1]
-				rules = l.def.rules[parent.name]
-				continue next
-			}
-			re, err := l.getPattern(candidate)
-			if err != nil {
-				return Token{}, errorf(l.pos, "rule %q: %s", candidate.Name, err)
-			}
-			m = re.FindStringSubmatchIndex(l.data)
-			if m != nil && (match == nil || m[1] > match[1]) {
-				match = m
-				rule = &rules[i]
-				if !l.def.matchLongest {
-					break
+		data := l.window(l.data)
+		if combined := l.def.combined[parent.name]; combined != nil {
+			rule, match = combined.match(rules, data)
+		} else {
+			for i, candidate := range rules {
+				// Special case "Return()".
+				if candidate.Rule == ReturnRule {
+					l.stack = l.stack[:len(l.stack)-1]
+					parent = l.stack[len(l.stack)-1]
+					rules = l.def.rules[parent.name]
+					continue next
+				}
+				re, err := l.getPattern(candidate)
+				if err != nil {
+					return Token{}, errorf(l.pos, "rule %q: %s", candidate.Name, err)
+				}
+				m = re.FindStringSubmatchIndex(data)
+				if m != nil && (match == nil || m[1] > match[1]) {
+					match = m
+					rule = &rules[i]
+					if !l.def.matchLongest {
+						break
+					}
 				}
 			}
 		}
 		if match == nil || rule == nil {
+			if l.def.errorTokens {
+				return l.errorToken(rules), nil
+			}
 			sample := []rune(l.data)
 			if len(sample) > 16 {
 				sample = append(sample[:16], []rune("...")...)
 			}
 			return Token{}, errorf(l.pos, "invalid input text %q", string(sample))
 		}
+		if l.def.maxTokenLength > 0 && match[1] > l.def.maxTokenLength {
+			return Token{}, errorf(l.pos, "rule %q: %s", rule.Name, l.errTokenTooLong())
+		}
 
+		end := match[1]
 		if rule.Action != nil {
 			groups := make([]string, 0, len(match)/2)
 			for i := 0; i < len(match); i += 2 {
 				groups = append(groups, l.data[match[i]:match[i+1]])
 			}
+			l.extend = 0
 			if err := rule.Action.applyAction(l, groups); err != nil {
 				return Token{}, errorf(l.pos, "rule %q: %s", rule.Name, err)
 			}
+			end += l.extend
 		} else if match[0] == match[1] {
 			return Token{}, errorf(l.pos, "rule %q did not match any input", rule.Name)
 		}
 
-		span := l.data[match[0]:match[1]]
-		l.data = l.data[match[1]:]
+		span := l.data[match[0]:end]
+		l.data = l.data[end:]
 		// l.groups = groups
 
 		// Update position.
 		pos := l.pos
-		l.pos.Advance(span)
+		l.advance(span)
 		if rule.ignore {
 			parent = l.stack[len(l.stack)-1]
 			rules = l.def.rules[parent.name]
 			continue
 		}
+		l.state, l.rule = parent.name, rule.Name
 		return Token{
 			Type:  l.def.symbols[rule.Name],
 			Value: span,
 			Pos:   pos,
 		}, nil
 	}
+	l.state, l.rule = l.stack[len(l.stack)-1].name, ""
 	return EOFToken(l.pos), nil
 }
 
+// Limit the input that rules are matched against to the maximum token length.
+//
+// One byte beyond the limit is included, so that a match exceeding the limit
+// can be distinguished from one of exactly the limit followed by more input.
+func (l *StatefulLexer) window(data string) string {
+	if l.def.maxTokenLength > 0 && len(data) > l.def.maxTokenLength {
+		return data[:l.def.maxTokenLength+1]
+	}
+	return data
+}
+
+// Limit the input that an action may extend a match of "matched" bytes over
+// to the maximum token length, returning true if the input was truncated.
+func (l *StatefulLexer) actionWindow(matched int) (string, bool) {
+	data := l.data[matched:]
+	if l.def.maxTokenLength > 0 && len(data) > l.def.maxTokenLength-matched {
+		return data[:l.def.maxTokenLength-matched], true
+	}
+	return data, false
+}
+
+func (l *StatefulLexer) errTokenTooLong() error {
+	return fmt.Errorf("token exceeds the maximum length of %d bytes", l.def.maxTokenLength)
+}
+
+// Origin returns the state and the name of the rule that produced the most recently returned token.
+func (l *StatefulLexer) Origin() (state, rule string) {
+	return l.state, l.rule
+}
+
+// Advance the lexer position over span, honouring the position options of the definition.
+func (l *StatefulLexer) advance(span string) {
+	l.def.AdvancePosition(&l.pos, span)
+}
+
+// Consume input up to the next position at which any rule matches.
+func (l *StatefulLexer) errorToken(rules []compiledRule) Token {
+	_, n := utf8.DecodeRuneInString(l.data)
+	for n < len(l.data) && !l.matchesAny(rules, l.data[n:]) {
+		_, size := utf8.DecodeRuneInString(l.data[n:])
+		n += size
+	}
+	span := l.data[:n]
+	l.data = l.data[n:]
+	pos := l.pos
+	l.advance(span)
+	l.state, l.rule = l.stack[len(l.stack)-1].name, ""
+	return Token{
+		Type:  l.def.symbols["Error"],
+		Value: span,
+		Pos:   pos,
+	}
+}
+
+func (l *StatefulLexer) matchesAny(rules []compiledRule, data string) bool {
+	data = l.window(data)
+	if combined := l.def.combined[l.stack[len(l.stack)-1].name]; combined != nil {
+		rule, _ := combined.match(rules, data)
+		return rule != nil
+	}
+	for _, candidate := range rules {
+		if candidate.Rule == ReturnRule {
+			continue
+		}
+		re, err := l.getPattern(candidate)
+		if err == nil && re.MatchString(data) {
+			return true
+		}
+	}
+	return false
+}
+
 func (l *StatefulLexer) getPattern(candidate compiledRule) (*regexp.Regexp, error) {
 	if candidate.RE != nil {
 		return candidate.RE, nil
@@ -3,6 +3,7 @@ package lexer_test
 import (
 	"encoding/json"
 	"log"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -41,6 +42,19 @@ func TestMarshalUnmarshal(t *testing.T) {
 	require.Equal(t, interpolatedRules, unmarshalledRules)
 }
 
+func TestMarshalUnmarshalActions(t *testing.T) {
+	rules := lexer.Rules{"Root": {
+		{"RawString", `r(#*)"`, lexer.Until(`"\1`)},
+		{"Block", `\{`, lexer.Balanced("{", "}", `"`)},
+	}}
+	data, err := json.Marshal(rules)
+	require.NoError(t, err)
+	unmarshalledRules := lexer.Rules{}
+	err = json.Unmarshal(data, &unmarshalledRules)
+	require.NoError(t, err)
+	require.Equal(t, rules, unmarshalledRules)
+}
+
 func TestStatefulLexer(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -54,6 +68,81 @@ func TestStatefulLexer(t *testing.T) {
 			buildErr: `invalid action for rule "foo": push to unknown state "Invalid"`,
 			rules:    lexer.Rules{"Root": {{`foo`, ``, lexer.Push("Invalid")}}},
 		},
+		{name: "UntilHeredoc",
+			input:  "a <<END\nhello END\nEND b",
+			tokens: []string{"a", "<<END\nhello END\nEND", "b"},
+			rules: lexer.Rules{"Root": {
+				{"Heredoc", `<<(\w+)\b`, lexer.Until(`\n\1\b`)},
+				{"Ident", `\w+`, nil},
+				{"whitespace", `\s+`, nil},
+			}},
+		},
+		{name: "UntilEmptyHeredoc",
+			input:  "a <<END\nEND b",
+			tokens: []string{"a", "<<END\nEND", "b"},
+			rules: lexer.Rules{"Root": {
+				{"Heredoc", `<<(\w+)\b`, lexer.Until(`\n\1\b`)},
+				{"Ident", `\w+`, nil},
+				{"whitespace", `\s+`, nil},
+			}},
+		},
+		{name: "UntilRawString",
+			input:  `r#"a "quoted" string"# r"b"`,
+			tokens: []string{`r#"a "quoted" string"#`, `r"b"`},
+			rules: lexer.Rules{"Root": {
+				{"RawString", `r(#*)"`, lexer.Until(`"\1`)},
+				{"whitespace", `\s+`, nil},
+			}},
+		},
+		{name: "UntilUnterminated",
+			input: `r##"abc"#`,
+			err:   `1:1: rule "RawString": unterminated "r##\""`,
+			rules: lexer.Rules{"Root": {
+				{"RawString", `r(#*)"`, lexer.Until(`"\1`)},
+			}},
+		},
+		{name: "UntilInvalidPattern",
+			buildErr: "invalid action for rule \"RawString\": error parsing regexp: missing closing ): `(`",
+			rules: lexer.Rules{"Root": {
+				{"RawString", `r"`, lexer.Until(`(`)},
+			}},
+		},
+		{name: "BalancedNested",
+			input:  `code { if (a) { b("}") } } c`,
+			tokens: []string{"code", `{ if (a) { b("}") } }`, "c"},
+			rules: lexer.Rules{"Root": {
+				{"Block", `\{`, lexer.Balanced("{", "}", `"`, "'")},
+				{"Ident", `\w+`, nil},
+				{"whitespace", `\s+`, nil},
+			}},
+		},
+		{name: "BalancedEscapedQuote",
+			input:  `<% a = "%>\"%>"; %>`,
+			tokens: []string{`<% a = "%>\"%>"; %>`},
+			rules: lexer.Rules{"Root": {
+				{"Template", `<%`, lexer.Balanced("<%", "%>", `"`)},
+			}},
+		},
+		{name: "BalancedUnbalanced",
+			input: `{ { }`,
+			err:   `1:1: rule "Block": unbalanced "{"`,
+			rules: lexer.Rules{"Root": {
+				{"Block", `\{`, lexer.Balanced("{", "}")},
+			}},
+		},
+		{name: "BalancedUnterminatedQuote",
+			input: `{ "} }`,
+			err:   `1:1: rule "Block": unterminated " in "{"`,
+			rules: lexer.Rules{"Root": {
+				{"Block", `\{`, lexer.Balanced("{", "}", `"`)},
+			}},
+		},
+		{name: "BalancedSameDelimiters",
+			buildErr: `invalid action for rule "Block": balanced delimiters must differ, got "|"`,
+			rules: lexer.Rules{"Root": {
+				{"Block", `\|`, lexer.Balanced("|", "|")},
+			}},
+		},
 		{name: "BackrefNoGroups",
 			input: `hello`,
 			err:   `1:1: rule "Backref": invalid backref expansion: "\\1": invalid group 1 from parent with 0 groups`,
@@ -353,6 +442,258 @@ func TestHereDoc(t *testing.T) {
 	require.Equal(t, expected, actual)
 }
 
+func TestErrorTokens(t *testing.T) {
+	def, err := lexer.New(lexer.Rules{
+		"Root": {
+			{"Ident", `\w+`, nil},
+			{"Punct", `[=;]`, nil},
+			{"whitespace", `\s+`, nil},
+		},
+	}, lexer.ErrorTokens())
+	require.NoError(t, err)
+	lex, err := def.LexString("", "a = $%! b;\n€ c")
+	require.NoError(t, err)
+	tokens, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	errorType := def.Symbols()["Error"]
+	require.Equal(t, []lexer.Token{
+		{Type: def.Symbols()["Ident"], Value: "a", Pos: lexer.Position{Offset: 0, Line: 1, Column: 1}},
+		{Type: def.Symbols()["Punct"], Value: "=", Pos: lexer.Position{Offset: 2, Line: 1, Column: 3}},
+		{Type: errorType, Value: "$%!", Pos: lexer.Position{Offset: 4, Line: 1, Column: 5}},
+		{Type: def.Symbols()["Ident"], Value: "b", Pos: lexer.Position{Offset: 8, Line: 1, Column: 9}},
+		{Type: def.Symbols()["Punct"], Value: ";", Pos: lexer.Position{Offset: 9, Line: 1, Column: 10}},
+		{Type: errorType, Value: "€", Pos: lexer.Position{Offset: 11, Line: 2, Column: 1}},
+		{Type: def.Symbols()["Ident"], Value: "c", Pos: lexer.Position{Offset: 15, Line: 2, Column: 3}},
+		{Type: lexer.EOF, Pos: lexer.Position{Offset: 16, Line: 2, Column: 4}},
+	}, tokens)
+
+	_, err = lexer.New(lexer.Rules{"Root": {{"Error", `.`, nil}}}, lexer.ErrorTokens())
+	require.EqualError(t, err, `rule "Error" conflicts with the token emitted by ErrorTokens()`)
+}
+
+func TestLexBytesZeroCopy(t *testing.T) {
+	rules := []lexer.SimpleRule{
+		{"Ident", `\w+`},
+		{"whitespace", `\s+`},
+	}
+	// By default the input is copied.
+	input := []byte("hello world")
+	lex, err := lexer.MustSimple(rules).LexBytes("", input)
+	require.NoError(t, err)
+	tokens, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	copy(input[6:], "WORLD")
+	require.Equal(t, "world", tokens[1].Value)
+
+	input = []byte("hello world")
+	lex, err = lexer.MustSimple(rules, lexer.ZeroCopy()).LexBytes("", input)
+	require.NoError(t, err)
+	tokens, err = lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	require.Equal(t, "world", tokens[1].Value)
+	// Token values share memory with the input.
+	copy(input[6:], "WORLD")
+	require.Equal(t, "WORLD", tokens[1].Value)
+}
+
+func TestCaseInsensitiveRules(t *testing.T) {
+	def, err := lexer.New(lexer.Rules{
+		"Root": {
+			{"Keyword", `select|from`, nil},
+			{"Ident", `\w+`, nil},
+			{"Regex", `(?i)re`, nil},
+			{"whitespace", `\s+`, nil},
+		},
+	}, lexer.CaseInsensitive("Keyword"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"Keyword", "Regex"}, def.CaseInsensitiveSymbols())
+	require.Equal(t, "(?i)select|from", def.Rules()["Root"][0].Pattern)
+
+	type grammar struct {
+		Field string `"select" @Ident`
+		Table string `"FROM" @Ident`
+	}
+	parser := participle.MustBuild[grammar](participle.Lexer(def))
+	actual, err := parser.ParseString("", "SeLeCt name from users")
+	require.NoError(t, err)
+	require.Equal(t, &grammar{Field: "name", Table: "users"}, actual)
+
+	_, err = lexer.New(lexer.Rules{"Root": {{"Ident", `\w+`, nil}}}, lexer.CaseInsensitive("Keyword"))
+	require.EqualError(t, err, `case-insensitive rule "Keyword" does not exist`)
+}
+
+func TestCaseInsensitiveRulesWrapped(t *testing.T) {
+	def := lexer.MustStateful(lexer.Rules{
+		"Root": {
+			{"Keyword", `select|from`, nil},
+			{"Ident", `\w+`, nil},
+			{"whitespace", `\s+`, nil},
+		},
+	}, lexer.CaseInsensitive("Keyword"))
+	interned, err := lexer.Intern(def)
+	require.NoError(t, err)
+	included, err := lexer.IncludeFiles(def, "Ident", nil)
+	require.NoError(t, err)
+	directives, err := lexer.LineDirectives(def, "Ident", regexp.MustCompile(`^line(\d+)$`))
+	require.NoError(t, err)
+	wrappers := []lexer.Definition{
+		lexer.DetectBOM(def),
+		lexer.Filter(def, func() lexer.FilterFunc {
+			return func(token lexer.Token) ([]lexer.Token, error) { return []lexer.Token{token}, nil }
+		}),
+		lexer.MustIndentation(def),
+		lexer.Parallel(def, 1024),
+		interned,
+		included,
+		directives,
+	}
+	for _, wrapper := range wrappers {
+		ci, ok := wrapper.(lexer.CaseInsensitiveDefinition)
+		require.True(t, ok, "%T", wrapper)
+		require.Equal(t, []string{"Keyword"}, ci.CaseInsensitiveSymbols(), "%T", wrapper)
+	}
+	keywords := lexer.MustKeywords(lexer.MustSimple(keywordRules), "Ident", []string{"select"}, lexer.KeywordsCaseInsensitive())
+	require.Equal(t, []string{"Keyword"}, keywords.CaseInsensitiveSymbols())
+
+	type grammar struct {
+		Field string `"select" @Ident`
+		Table string `"FROM" @Ident`
+	}
+	parser := participle.MustBuild[grammar](participle.Lexer(lexer.DetectBOM(interned)))
+	actual, err := parser.ParseString("", "SeLeCt name from users")
+	require.NoError(t, err)
+	require.Equal(t, &grammar{Field: "name", Table: "users"}, actual)
+}
+
+func TestStatefulRuleOrder(t *testing.T) {
+	// Rules are matched in order, even when combined into a single expression.
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Keyword", `(?i)if\b`},
+		{"Greedy", `x*y`},
+		{"Ident", `\pL\w*`},
+		{"Number", `-?\d+(\.\d+)?`},
+		{"Op", `-|\.\.|\.`},
+		{"whitespace", `\s+`},
+	})
+	lex, err := def.LexString("", "IF iffy élan -1.5 - 1..2 . y xxy")
+	require.NoError(t, err)
+	tokens, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	names := lexer.SymbolsByRune(def)
+	actual := []string{}
+	for _, token := range tokens[:len(tokens)-1] {
+		actual = append(actual, names[token.Type]+":"+token.Value)
+	}
+	require.Equal(t, []string{
+		"Keyword:IF", "Ident:iffy", "Ident:élan", "Number:-1.5", "Op:-", "Number:1",
+		"Op:..", "Number:2", "Op:.", "Greedy:y", "Greedy:xxy",
+	}, actual)
+}
+
+func TestStatefulPositions(t *testing.T) {
+	rules := lexer.Rules{"Root": {
+		{"Ident", `\S+`, nil},
+		{"whitespace", `\s+`, nil},
+	}}
+	tests := []struct {
+		name      string
+		options   []lexer.Option
+		positions []lexer.Position
+	}{
+		{"Default", nil, []lexer.Position{
+			{Offset: 7, Line: 1, Column: 4},
+			{Offset: 10, Line: 2, Column: 2},
+			{Offset: 12, Line: 2, Column: 4},
+		}},
+		{"Bytes", []lexer.Option{lexer.Columns(lexer.ColumnBytes)}, []lexer.Position{
+			{Offset: 7, Line: 1, Column: 8},
+			{Offset: 10, Line: 2, Column: 2},
+			{Offset: 12, Line: 2, Column: 4},
+		}},
+		{"UTF16", []lexer.Option{lexer.Columns(lexer.ColumnUTF16)}, []lexer.Position{
+			{Offset: 7, Line: 1, Column: 5},
+			{Offset: 10, Line: 2, Column: 2},
+			{Offset: 12, Line: 2, Column: 4},
+		}},
+		{"TabWidth", []lexer.Option{lexer.TabWidth(4)}, []lexer.Position{
+			{Offset: 7, Line: 1, Column: 4},
+			{Offset: 10, Line: 2, Column: 5},
+			{Offset: 12, Line: 2, Column: 9},
+		}},
+		{"OffsetsOnly", []lexer.Option{lexer.OffsetsOnly()}, []lexer.Position{
+			{Offset: 7},
+			{Offset: 10},
+			{Offset: 12},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			def, err := lexer.New(rules, test.options...)
+			require.NoError(t, err)
+			lex, err := def.LexString("", "é😀 x\n\ty\tz")
+			require.NoError(t, err)
+			tokens, err := lexer.ConsumeAll(lex)
+			require.NoError(t, err)
+			positions := []lexer.Position{}
+			for _, token := range tokens[1:4] {
+				positions = append(positions, token.Pos)
+			}
+			require.Equal(t, test.positions, positions)
+		})
+	}
+}
+
+func TestMaxTokenLength(t *testing.T) {
+	def, err := lexer.New(lexer.Rules{"Root": {
+		{"Ident", `[a-z]+`, nil},
+		{"Statement", `[a-z]*;`, nil},
+		{"whitespace", `\s+`, nil},
+	}}, lexer.MaxTokenLength(8))
+	require.NoError(t, err)
+	lex, err := def.LexString("", "abcdefg abcdefghijkl")
+	require.NoError(t, err)
+	_, err = lexer.ConsumeAll(lex)
+	require.EqualError(t, err, `1:9: rule "Ident": token exceeds the maximum length of 8 bytes`)
+
+	lex, err = def.LexString("", "abcdefg abcdefg")
+	require.NoError(t, err)
+	tokens, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(tokens))
+
+	// A token of exactly the maximum length is accepted.
+	lex, err = def.LexString("", "abcdefgh xyz")
+	require.NoError(t, err)
+	tokens, err = lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	require.Equal(t, "abcdefgh", tokens[0].Value)
+}
+
+func TestMaxTokenLengthActions(t *testing.T) {
+	def, err := lexer.New(lexer.Rules{"Root": {
+		{"Raw", `r"`, lexer.Until(`"`)},
+		{"Block", `\{`, lexer.Balanced("{", "}")},
+		{"whitespace", `\s+`, nil},
+	}}, lexer.MaxTokenLength(8))
+	require.NoError(t, err)
+	lex, err := def.LexString("", `r"abcde" {abcdef}`)
+	require.NoError(t, err)
+	tokens, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+	require.Equal(t, `r"abcde"`, tokens[0].Value)
+	require.Equal(t, `{abcdef}`, tokens[1].Value)
+
+	lex, err = def.LexString("", `r"abcdef"`)
+	require.NoError(t, err)
+	_, err = lexer.ConsumeAll(lex)
+	require.EqualError(t, err, `1:1: rule "Raw": token exceeds the maximum length of 8 bytes`)
+
+	lex, err = def.LexString("", `{abcdefg}`)
+	require.NoError(t, err)
+	_, err = lexer.ConsumeAll(lex)
+	require.EqualError(t, err, `1:1: rule "Block": token exceeds the maximum length of 8 bytes`)
+}
+
 func BenchmarkStateful(b *testing.B) {
 	source := strings.Repeat(`"hello ${user + "${last}"}"`, 100)
 	def := lexer.Must(lexer.New(interpolatedRules))
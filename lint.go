@@ -0,0 +1,569 @@
+package participle
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// LintCheck identifies a static check performed by Lint.
+type LintCheck string
+
+// Checks performed by Lint.
+const (
+	// LintUnreachableAlternative is an alternative that can never match because an earlier one always matches first.
+	LintUnreachableAlternative LintCheck = "unreachable-alternative"
+	// LintEmptyRepetition is a repeated expression that can match without consuming any input.
+	LintEmptyRepetition LintCheck = "empty-repetition"
+	// LintUnreachableProduction is a production that can not be reached from the root of the grammar.
+	LintUnreachableProduction LintCheck = "unreachable-production"
+	// LintUncapturedField is a field with a grammar that is never captured into.
+	LintUncapturedField LintCheck = "uncaptured-field"
+)
+
+// Checks reported as warnings by BuildWithDiagnostics, in addition to those performed by Lint.
+const (
+	// LintLookahead is a set of alternatives that can start with the same tokens for longer than the lookahead.
+	LintLookahead LintCheck = "lookahead"
+	// LintUnmatchedLiteral is a literal that is not lexed as a single token by the lexer.
+	LintUnmatchedLiteral LintCheck = "unmatched-literal"
+	// LintUnusedToken is a token type of the lexer that is not used by the grammar.
+	LintUnusedToken LintCheck = "unused-token"
+)
+
+// LintFinding is a potential problem with a grammar found by Lint.
+type LintFinding struct {
+	Check      LintCheck
+	Production string
+	Message    string
+}
+
+func (l LintFinding) String() string {
+	if l.Production == "" {
+		return fmt.Sprintf("%s (%s)", l.Message, l.Check)
+	}
+	return fmt.Sprintf("%s: %s (%s)", l.Production, l.Message, l.Check)
+}
+
+// LintError is returned by Build when the Lint option is used and problems are found.
+type LintError struct {
+	Findings []LintFinding
+}
+
+func (l *LintError) Error() string {
+	lines := make([]string, 0, len(l.Findings))
+	for _, finding := range l.Findings {
+		lines = append(lines, finding.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type linter struct {
+	findings []LintFinding
+	seen     map[node]bool
+	empty    map[node]bool // Memoised results of matchesEmpty.
+
+	// Only set when diagnosing warnings.
+	def       lexer.Definition
+	lookahead int
+	literals  map[*literal]lexer.TokenType // Type each literal is lexed as, or EOF if it is not.
+	used      map[lexer.TokenType]bool
+}
+
+func newLinter() *linter {
+	return &linter{seen: map[node]bool{}, empty: map[node]bool{}}
+}
+
+// Perform static checks on the grammar reachable from root, and on the
+// unions, custom and expression types defined by options in typeNodes.
+func lint(root node, typeNodes map[reflect.Type]node) []LintFinding {
+	return newLinter().lint(root, typeNodes)
+}
+
+// Perform the checks of lint, and additionally report warnings about the use of
+// the lexer "def". Tokens of the "ignored" types need not be used by the grammar.
+func diagnose(root node, typeNodes map[reflect.Type]node, def lexer.Definition, lookahead int, ignored []string) []LintFinding {
+	l := newLinter()
+	l.def = def
+	l.lookahead = lookahead
+	l.literals = map[*literal]lexer.TokenType{}
+	l.used = map[lexer.TokenType]bool{}
+	findings := l.lint(root, typeNodes)
+	symbols := def.Symbols()
+	for _, sym := range ignored {
+		l.used[symbols[sym]] = true
+	}
+	unused := []string{}
+	for sym, tt := range symbols {
+		if tt != lexer.EOF && !l.used[tt] {
+			unused = append(unused, sym)
+		}
+	}
+	sort.Strings(unused)
+	for _, sym := range unused {
+		findings = append(findings, LintFinding{Check: LintUnusedToken, Message: fmt.Sprintf("token type %q is not used by the grammar", sym)})
+	}
+	return findings
+}
+
+func (l *linter) lint(root node, typeNodes map[reflect.Type]node) []LintFinding {
+	l.walk("", nil, root)
+	unreachable := []string{}
+	for t, n := range typeNodes {
+		switch n.(type) {
+		case *union, *custom, *expression:
+			if !l.seen[n] {
+				unreachable = append(unreachable, productionName(t))
+			}
+		}
+	}
+	sort.Strings(unreachable)
+	for _, name := range unreachable {
+		l.report(LintUnreachableProduction, name, "production is not reachable from the root of the grammar")
+	}
+	return l.findings
+}
+
+func (l *linter) report(check LintCheck, production string, format string, args ...interface{}) {
+	l.findings = append(l.findings, LintFinding{Check: check, Production: production, Message: fmt.Sprintf(format, args...)})
+}
+
+// Walk n, in "production", recording captured fields of the current struct in "captured".
+func (l *linter) walk(production string, captured map[string]bool, n node) {
+	switch n := n.(type) {
+	case *strct:
+		if l.seen[n] {
+			return
+		}
+		l.seen[n] = true
+		captured := map[string]bool{}
+		l.walk(n.name, captured, n.expr)
+		if slexer, err := lexStruct(n.typ); err == nil {
+			for i := 0; i < slexer.NumField(); i++ {
+				if field := slexer.GetField(i); !captured[field.Name] {
+					l.report(LintUncapturedField, n.name, "field %s is never captured into", field.Name)
+				}
+			}
+		}
+
+	case *union:
+		if l.seen[n] {
+			return
+		}
+		l.seen[n] = true
+		name := productionName(n.typ)
+		l.alternatives(name, n.disjunction.nodes)
+		for _, member := range n.disjunction.nodes {
+			l.walk(name, nil, member)
+		}
+		l.overlapping(name, n.disjunction.nodes)
+
+	case *expression:
+		if l.seen[n] {
+			return
+		}
+		l.seen[n] = true
+		l.walk(productionName(n.typ), nil, n.operandNode)
+
+	case *rule:
+		if l.seen[n] {
+			return
+		}
+		l.seen[n] = true
+		l.walk(n.name, nil, n.expr)
+
+	case *custom:
+		l.seen[n] = true
+
+	case *disjunction:
+		l.alternatives(production, n.nodes)
+		for _, alternative := range n.nodes {
+			l.walk(production, captured, alternative)
+		}
+		l.overlapping(production, n.nodes)
+
+	case *sequence:
+		for ; n != nil; n = n.next {
+			l.walk(production, captured, n.node)
+		}
+
+	case *capture:
+		if captured != nil {
+			captured[n.field.Name] = true
+		}
+		l.walk(production, captured, n.node)
+
+	case *group:
+		repeated := n.mode == groupMatchZeroOrMore || n.mode == groupMatchOneOrMore || (n.mode == groupMatchRange && n.max != 1)
+		if repeated && l.matchesEmpty(n.expr) {
+			l.report(LintEmptyRepetition, production, "repeated expression %s can match without consuming input", n)
+		}
+		l.walk(production, captured, n.expr)
+
+	case *lookaheadGroup:
+		l.walk(production, captured, n.expr)
+
+	case *negation:
+		l.walk(production, captured, n.node)
+
+	case *adjacent:
+		l.walk(production, captured, n.node)
+
+	case *reference:
+		if l.used != nil {
+			l.used[n.typ] = true
+		}
+
+	case *literal:
+		if l.def != nil {
+			l.literal(production, n)
+		}
+	}
+}
+
+// Report literals that are not lexed as a single token of the expected type.
+func (l *linter) literal(production string, n *literal) {
+	if _, ok := l.literals[n]; ok {
+		return
+	}
+	l.literals[n] = lexer.EOF
+	lex, err := l.def.Lex("", strings.NewReader(n.s))
+	if err == nil {
+		var tokens []lexer.Token
+		if tokens, err = lexer.ConsumeAll(lex); err == nil && len(tokens) == 2 && tokens[0].Value == n.s &&
+			(n.t == lexer.EOF || n.t == tokens[0].Type) {
+			l.literals[n] = tokens[0].Type
+			l.used[tokens[0].Type] = true
+			return
+		}
+	}
+	l.report(LintUnmatchedLiteral, production, "literal %s is not matched by any lexer rule", n)
+}
+
+// A token that an expression can start with.
+type firstToken struct {
+	literal *literal // Nil for references.
+	typ     lexer.TokenType
+	name    string // Symbol of references.
+}
+
+func (f firstToken) overlaps(o firstToken) bool {
+	switch {
+	case f.literal != nil && o.literal != nil:
+		return f.literal.s == o.literal.s
+	case f.literal != nil:
+		return f.typ == o.typ
+	default:
+		return f.typ == o.typ && (o.literal == nil || o.typ != lexer.EOF)
+	}
+}
+
+func (f firstToken) String() string {
+	if f.literal != nil {
+		return f.literal.String()
+	}
+	return "<" + strings.ToLower(f.name) + ">"
+}
+
+// Report alternatives that can start with the same tokens for longer than the
+// lookahead, as a partial match of the first then prevents the second from
+// being tried.
+func (l *linter) overlapping(production string, alternatives []node) {
+	if l.def == nil || l.lookahead < 0 {
+		return
+	}
+	// A failing branch is abandoned if it consumed more than the lookahead.
+	k := l.lookahead + 1
+	prefixes := make([][][]firstToken, len(alternatives))
+	for i, alternative := range alternatives {
+		alternativePrefixes, ok := l.prefixes(alternative, k, map[prefixKey]bool{})
+		if !ok {
+			return
+		}
+		prefixes[i] = alternativePrefixes
+	}
+	for j := range alternatives {
+	next:
+		for i := 0; i < j; i++ {
+			for _, a := range prefixes[i] {
+				for _, b := range prefixes[j] {
+					if overlapping(a, b, k) {
+						l.report(LintLookahead, production, "alternatives %s and %s can both start with %s, which may require more lookahead", alternatives[i], alternatives[j], tokenSequence(a))
+						break next
+					}
+				}
+			}
+		}
+	}
+}
+
+// Whether the token sequences a and b both have length k and can match the same input.
+func overlapping(a, b []firstToken, k int) bool {
+	if len(a) != k || len(b) != k {
+		return false
+	}
+	for i := range a {
+		if !a[i].overlaps(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func tokenSequence(tokens []firstToken) string {
+	out := make([]string, len(tokens))
+	for i, token := range tokens {
+		out[i] = token.String()
+	}
+	return strings.Join(out, " ")
+}
+
+// Limits the number of token sequences considered for each alternative.
+const maxLintPrefixes = 1024
+
+type prefixKey struct {
+	node node
+	k    int
+}
+
+// The sequences of up to k tokens that n can start with, or false if they are
+// not known. Sequences shorter than k are matched by n in their entirety.
+func (l *linter) prefixes(n node, k int, visiting map[prefixKey]bool) (out [][]firstToken, ok bool) {
+	if k == 0 {
+		return [][]firstToken{{}}, true
+	}
+	key := prefixKey{n, k}
+	if visiting[key] {
+		// Recursion without consuming input.
+		return nil, false
+	}
+	visiting[key] = true
+	defer delete(visiting, key)
+	switch n := n.(type) {
+	case *literal:
+		l.literal("", n)
+		return [][]firstToken{{{literal: n, typ: l.literals[n]}}}, true
+	case *reference:
+		return [][]firstToken{{{typ: n.typ, name: n.identifier}}}, true
+	case *disjunction:
+		return l.prefixesOfAlternatives(n.nodes, k, visiting)
+	case *union:
+		return l.prefixesOfAlternatives(n.disjunction.nodes, k, visiting)
+	case *sequence:
+		head, ok := l.prefixes(n.node, k, visiting)
+		if !ok || n.next == nil {
+			return head, ok
+		}
+		return l.concatPrefixes(head, k, func(k int) ([][]firstToken, bool) { return l.prefixes(n.next, k, visiting) })
+	case *group:
+		min, max := 1, 1
+		switch n.mode {
+		case groupMatchZeroOrOne:
+			min = 0
+		case groupMatchZeroOrMore:
+			min, max = 0, -1
+		case groupMatchOneOrMore:
+			max = -1
+		case groupMatchRange:
+			min, max = n.min, n.max
+		}
+		return l.repeatedPrefixes(n.expr, min, max, k, visiting)
+	case *capture:
+		return l.prefixes(n.node, k, visiting)
+	case *adjacent:
+		return l.prefixes(n.node, k, visiting)
+	case *strct:
+		return l.prefixes(n.expr, k, visiting)
+	case *rule:
+		return l.prefixes(n.expr, k, visiting)
+	case *expression:
+		// Operators may follow the operand, so only complete sequences are known.
+		out, ok := l.prefixes(n.operandNode, k, visiting)
+		for _, prefix := range out {
+			if len(prefix) < k {
+				return nil, false
+			}
+		}
+		return out, ok
+	case *lookaheadGroup, *cut, *recoverDirective:
+		return [][]firstToken{{}}, true
+	default:
+		return nil, false
+	}
+}
+
+func (l *linter) prefixesOfAlternatives(alternatives []node, k int, visiting map[prefixKey]bool) (out [][]firstToken, ok bool) {
+	for _, alternative := range alternatives {
+		prefixes, ok := l.prefixes(alternative, k, visiting)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, prefixes...)
+	}
+	return out, len(out) <= maxLintPrefixes
+}
+
+// Extend the sequences in head that are shorter than k with those returned by "tail".
+func (l *linter) concatPrefixes(head [][]firstToken, k int, tail func(k int) ([][]firstToken, bool)) (out [][]firstToken, ok bool) {
+	for _, prefix := range head {
+		if len(prefix) == k {
+			out = append(out, prefix)
+			continue
+		}
+		rest, ok := tail(k - len(prefix))
+		if !ok {
+			return nil, false
+		}
+		for _, suffix := range rest {
+			out = append(out, append(prefix[:len(prefix):len(prefix)], suffix...))
+		}
+		if len(out) > maxLintPrefixes {
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// The prefixes of between min and max repetitions of n, where max is -1 if unbounded.
+func (l *linter) repeatedPrefixes(n node, min, max, k int, visiting map[prefixKey]bool) (out [][]firstToken, ok bool) {
+	if min == 0 {
+		out = append(out, []firstToken{})
+	}
+	if max == 0 {
+		return out, true
+	}
+	next := func(min, max int) (int, int) {
+		if min > 0 {
+			min--
+		}
+		if max > 0 {
+			max--
+		}
+		return min, max
+	}
+	head, ok := l.prefixes(n, k, visiting)
+	if !ok {
+		return nil, false
+	}
+	nonEmpty := [][]firstToken{}
+	for _, prefix := range head {
+		if len(prefix) > 0 {
+			nonEmpty = append(nonEmpty, prefix)
+		} else if min > 0 {
+			// An empty repetition satisfies the minimum without consuming input.
+			min, max := next(min, max)
+			rest, ok := l.repeatedPrefixes(n, min, max, k, visiting)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, rest...)
+		}
+	}
+	rest, ok := l.concatPrefixes(nonEmpty, k, func(k int) ([][]firstToken, bool) {
+		min, max := next(min, max)
+		return l.repeatedPrefixes(n, min, max, k, visiting)
+	})
+	if !ok {
+		return nil, false
+	}
+	return append(out, rest...), true
+}
+
+// Report alternatives that are preceded by one that always matches before them.
+func (l *linter) alternatives(production string, alternatives []node) {
+	terms := make([][]string, len(alternatives))
+	for i, alternative := range alternatives {
+		terms[i] = sequenceTerms(alternative)
+	}
+	for j := range alternatives {
+		for i := 0; i < j; i++ {
+			if l.matchesEmpty(alternatives[i]) {
+				l.report(LintUnreachableAlternative, production, "alternative %s can never match because %s can match without consuming input", alternatives[j], alternatives[i])
+				break
+			}
+			if isPrefix(terms[i], terms[j]) {
+				l.report(LintUnreachableAlternative, production, "alternative %s can never match because %s always matches first", alternatives[j], alternatives[i])
+				break
+			}
+		}
+	}
+}
+
+// The EBNF of each term in a sequence.
+func sequenceTerms(n node) []string {
+	seq, ok := n.(*sequence)
+	if !ok {
+		return []string{ebnf(n)}
+	}
+	out := []string{}
+	for ; seq != nil; seq = seq.next {
+		if _, ok := seq.node.(*recoverDirective); !ok {
+			out = append(out, ebnf(seq.node))
+		}
+	}
+	return out
+}
+
+func isPrefix(prefix, terms []string) bool {
+	if len(prefix) > len(terms) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != terms[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether n can match without consuming any input.
+func (l *linter) matchesEmpty(n node) bool {
+	if empty, ok := l.empty[n]; ok {
+		return empty
+	}
+	l.empty[n] = false // Assume recursive references consume input.
+	empty := false
+	switch n := n.(type) {
+	case *disjunction:
+		for _, alternative := range n.nodes {
+			empty = empty || l.matchesEmpty(alternative)
+		}
+	case *union:
+		for _, member := range n.disjunction.nodes {
+			empty = empty || l.matchesEmpty(member)
+		}
+	case *sequence:
+		empty = true
+		for ; n != nil && empty; n = n.next {
+			empty = l.matchesEmpty(n.node)
+		}
+	case *group:
+		switch n.mode {
+		case groupMatchZeroOrOne, groupMatchZeroOrMore:
+			empty = true
+		case groupMatchRange:
+			empty = n.min == 0 || l.matchesEmpty(n.expr)
+		case groupMatchNonEmpty:
+			empty = false
+		default:
+			empty = l.matchesEmpty(n.expr)
+		}
+	case *strct:
+		empty = l.matchesEmpty(n.expr)
+	case *rule:
+		empty = l.matchesEmpty(n.expr)
+	case *expression:
+		empty = l.matchesEmpty(n.operandNode)
+	case *capture:
+		empty = l.matchesEmpty(n.node)
+	case *adjacent:
+		empty = l.matchesEmpty(n.node)
+	case *lookaheadGroup, *cut, *recoverDirective:
+		empty = true
+	}
+	l.empty[n] = empty
+	return empty
+}
@@ -0,0 +1,93 @@
+package participle_test
+
+import (
+	"errors"
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+type lintUnused interface{ lintUnused() }
+
+type lintUnusedMember struct {
+	Value string `@Ident`
+}
+
+func (lintUnusedMember) lintUnused() {}
+
+func TestLint(t *testing.T) {
+	type grammar struct {
+		Keyword string   `(  "a"`
+		Value   string   ` | "a" @Ident`
+		Empty   string   ` | @Ident? )`
+		Items   []string `( @Int? )*`
+	}
+	_, err := participle.Build[grammar](participle.Lint(), participle.Union[lintUnused](lintUnusedMember{}))
+	var lerr *participle.LintError
+	require.True(t, errors.As(err, &lerr))
+	require.Equal(t, []participle.LintFinding{
+		{Check: participle.LintUnreachableAlternative, Production: "Grammar", Message: `alternative "a" <ident> can never match because "a" always matches first`},
+		{Check: participle.LintEmptyRepetition, Production: "Grammar", Message: `repeated expression <int>?* can match without consuming input`},
+		{Check: participle.LintUncapturedField, Production: "Grammar", Message: `field Keyword is never captured into`},
+		{Check: participle.LintUnreachableProduction, Production: "LintUnused", Message: `production is not reachable from the root of the grammar`},
+	}, lerr.Findings)
+	require.EqualError(t, err, `Grammar: alternative "a" <ident> can never match because "a" always matches first (unreachable-alternative)
+Grammar: repeated expression <int>?* can match without consuming input (empty-repetition)
+Grammar: field Keyword is never captured into (uncaptured-field)
+LintUnused: production is not reachable from the root of the grammar (unreachable-production)`)
+}
+
+func TestLintEmptyAlternative(t *testing.T) {
+	type grammar struct {
+		A string `@Ident? | @Int`
+	}
+	_, err := participle.Build[grammar](participle.Lint())
+	require.EqualError(t, err, `Grammar: alternative <int> can never match because <ident>? can match without consuming input (unreachable-alternative)`)
+}
+
+func TestLintClean(t *testing.T) {
+	type grammar struct {
+		Key   string   `@Ident "="`
+		Value []string `( @Int | @String )+`
+	}
+	_, err := participle.Build[grammar](participle.Lint())
+	require.NoError(t, err)
+}
+
+func TestBuildWithDiagnostics(t *testing.T) {
+	type grammar struct {
+		Assign string `  @Ident "=" @Int`
+		Alias  string `| @Ident "=" @Ident`
+		Call   string `| @Ident "(" ")"`
+		Arrow  string `| "->" @Ident`
+	}
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Ident", `\w+`},
+		{"Int", `\d+`},
+		{"Float", `\d+\.\d+`},
+		{"Punct", `[=()]`},
+		{"Whitespace", `\s+`},
+	})
+	p, warnings, err := participle.BuildWithDiagnostics[grammar](participle.Lexer(def), participle.Elide("Whitespace"))
+	require.NoError(t, err)
+	require.NotZero(t, p)
+	require.Equal(t, []participle.LintFinding{
+		{Check: participle.LintUnmatchedLiteral, Production: "Grammar", Message: `literal "->" is not matched by any lexer rule`},
+		{Check: participle.LintLookahead, Production: "Grammar", Message: `alternatives <ident> "=" <int> and <ident> "=" <ident> can both start with <ident> "=", which may require more lookahead`},
+		{Check: participle.LintUnusedToken, Message: `token type "Float" is not used by the grammar`},
+	}, warnings)
+
+	_, warnings, err = participle.BuildWithDiagnostics[grammar](participle.Lexer(def), participle.Elide("Whitespace"), participle.UseLookahead(2))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(warnings))
+
+	// The options of the caller are not modified.
+	options := make([]participle.Option, 2, 3)
+	options[0], options[1] = participle.Lexer(def), participle.Elide("Whitespace")
+	_, _, err = participle.BuildWithDiagnostics[grammar](options...)
+	require.NoError(t, err)
+	require.Zero(t, options[:3][2])
+}
@@ -2,6 +2,7 @@ package participle
 
 import (
 	"io"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -41,7 +42,7 @@ func Unquote(types ...string) Option {
 	return Map(func(t lexer.Token) (lexer.Token, error) {
 		value, err := unquote(t.Value)
 		if err != nil {
-			return t, Errorf(t.Pos, "invalid quoted string %q: %s", t.Value, err.Error())
+			return t, codedErrorf(CodeInvalidValue, t.Pos, "invalid quoted string %q: %s", t.Value, err.Error())
 		}
 		t.Value = value
 		return t, nil
@@ -63,6 +64,52 @@ func unquote(s string) (string, error) {
 	return out, nil
 }
 
+// Decoder converts the raw value of a token into the value to be captured.
+type Decoder func(value string) (string, error)
+
+// Decode is an Option that applies a Decoder to each token of the corresponding type.
+//
+// This allows values to be cooked once when lexing, eg. unescaping strings or
+// stripping digit separators from numbers, rather than in Capture methods
+// throughout the grammar. Errors are reported at the position of the token.
+func Decode(decoders map[string]Decoder) Option {
+	symbols := make([]string, 0, len(decoders))
+	for symbol := range decoders {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return func(p *parserOptions) error {
+		for _, symbol := range symbols {
+			decoder := decoders[symbol]
+			err := Map(func(t lexer.Token) (lexer.Token, error) {
+				value, err := decoder(t.Value)
+				if err != nil {
+					return t, codedErrorf(CodeInvalidValue, t.Pos, "invalid %s %q: %s", symbol, t.Value, err.Error())
+				}
+				t.Value = value
+				return t, nil
+			}, symbol)(p)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// StripUnderscores removes digit separators from tokens of the given types, eg. "1_000_000".
+//
+// Tokens of type "Number" will be stripped if no other types are provided.
+func StripUnderscores(types ...string) Option {
+	if len(types) == 0 {
+		types = []string{"Number"}
+	}
+	return Map(func(t lexer.Token) (lexer.Token, error) {
+		t.Value = strings.ReplaceAll(t.Value, "_", "")
+		return t, nil
+	}, types...)
+}
+
 // Upper is an Option that upper-cases all tokens of the given type. Useful for case normalisation.
 func Upper(types ...string) Option {
 	return Map(func(token lexer.Token) (lexer.Token, error) {
@@ -71,7 +118,11 @@ func Upper(types ...string) Option {
 	}, types...)
 }
 
-// Elide drops tokens of the specified types.
+// Elide skips tokens of the specified types when matching the grammar.
+//
+// Elided tokens are still recorded, and are included in "Tokens []lexer.Token"
+// fields, PeekingLexer.Range() and may be matched explicitly. Use Drop() to
+// remove tokens entirely.
 func Elide(types ...string) Option {
 	return func(p *parserOptions) error {
 		p.elide = append(p.elide, types...)
@@ -79,6 +130,31 @@ func Elide(types ...string) Option {
 	}
 }
 
+// Drop removes tokens of the specified types from the token stream entirely.
+//
+// Unlike elided tokens, dropped tokens are never seen by the parser, so they
+// can not be matched and are not recorded in "Tokens []lexer.Token" fields.
+func Drop(types ...string) Option {
+	return func(p *parserOptions) error {
+		p.drop = append(p.drop, types...)
+		return nil
+	}
+}
+
+// AttachTrivia elides tokens of the specified types, such as comments, and
+// attaches them to the nearest struct node with a "Comments []lexer.Token" field.
+//
+// Trivia preceding a node is attached to the outermost node starting at the
+// following token, while trivia following a node on the same line as its last
+// token is attached to the innermost node ending there.
+func AttachTrivia(types ...string) Option {
+	return func(p *parserOptions) error {
+		p.elide = append(p.elide, types...)
+		p.trivia = append(p.trivia, types...)
+		return nil
+	}
+}
+
 // Apply a Mapping to all tokens coming out of a Lexer.
 type mappingLexerDef struct {
 	l      lexer.Definition
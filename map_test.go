@@ -1,6 +1,7 @@
 package participle_test
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -53,3 +54,142 @@ func TestUnquote(t *testing.T) {
 	}
 	require.Equal(t, expected, actual)
 }
+
+func TestDecode(t *testing.T) {
+	type grammar struct {
+		Strings []string  `( @String`
+		Numbers []float64 `| @Number )*`
+	}
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"whitespace", `\s+`},
+		{"Number", `[\d_]+(\.[\d_]+)?`},
+		{"String", `'[^']*'`},
+	})
+	p := mustTestParser[grammar](t, participle.Lexer(def),
+		participle.Decode(map[string]participle.Decoder{
+			"String": func(value string) (string, error) {
+				if strings.Contains(value, "!") {
+					return "", errors.New("unexpected !")
+				}
+				return strings.ToUpper(value[1 : len(value)-1]), nil
+			},
+		}),
+		participle.StripUnderscores())
+	actual, err := p.ParseString("", `'hello' 1_000_000 'world' 1_0.2_5`)
+	require.NoError(t, err)
+	require.Equal(t, &grammar{Strings: []string{"HELLO", "WORLD"}, Numbers: []float64{1000000, 10.25}}, actual)
+
+	_, err = p.ParseString("", `'hi' 'bad!'`)
+	require.EqualError(t, err, `1:6: invalid String "'bad!'": unexpected !`)
+}
+
+func TestElideAndDrop(t *testing.T) {
+	type grammar struct {
+		Tokens []lexer.Token
+		Idents []string `@Ident*`
+	}
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Comment", `#[^\n]*`},
+		{"Ident", `\w+`},
+		{"Whitespace", `\s+`},
+	})
+	values := func(tokens []lexer.Token) []string {
+		out := make([]string, 0, len(tokens))
+		for _, token := range tokens {
+			out = append(out, token.Value)
+		}
+		return out
+	}
+
+	// Elided tokens are skipped when matching but recorded.
+	p := mustTestParser[grammar](t, participle.Lexer(def), participle.Elide("Comment", "Whitespace"))
+	actual, err := p.ParseString("", "a #comment\nb")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, actual.Idents)
+	require.Equal(t, []string{"a", " ", "#comment", "\n", "b"}, values(actual.Tokens))
+
+	// Dropped tokens are not.
+	p = mustTestParser[grammar](t, participle.Lexer(def), participle.Elide("Whitespace"), participle.Drop("Comment"))
+	actual, err = p.ParseString("", "a #comment\nb")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, actual.Idents)
+	require.Equal(t, []string{"a", " ", "\n", "b"}, values(actual.Tokens))
+
+	_, err = participle.Build[grammar](participle.Lexer(def), participle.Drop("Remark"))
+	require.EqualError(t, err, `Drop(): lexer does not support symbol "Remark"`)
+}
+
+func TestAttachTrivia(t *testing.T) {
+	type Value struct {
+		Comments []lexer.Token
+		Ident    string `@Ident`
+	}
+	type Entry struct {
+		Comments []lexer.Token
+		Key      string `@Ident "="`
+		Value    *Value `@@ ";"`
+	}
+	type grammar struct {
+		Entries []*Entry `@@*`
+	}
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Comment", `//[^\n]*`},
+		{"Ident", `\w+`},
+		{"Punct", `[=;]`},
+		{"whitespace", `\s+`},
+	})
+	p := mustTestParser[grammar](t, participle.Lexer(def), participle.AttachTrivia("Comment"))
+	actual, err := p.ParseString("", `
+		// Leading a
+		// More a
+		a = b; // Trailing a
+		c = // Trailing c
+			d // Trailing d
+		;
+		// Dangling
+	`)
+	require.NoError(t, err)
+	values := func(tokens []lexer.Token) (out []string) {
+		for _, token := range tokens {
+			out = append(out, token.Value)
+		}
+		return
+	}
+	require.Equal(t, []string{"// Leading a", "// More a", "// Trailing a"}, values(actual.Entries[0].Comments))
+	require.Equal(t, []string(nil), values(actual.Entries[0].Value.Comments))
+	require.Equal(t, []string(nil), values(actual.Entries[1].Comments))
+	require.Equal(t, []string{"// Trailing c", "// Trailing d"}, values(actual.Entries[1].Value.Comments))
+}
+
+func TestAttachTriviaUnknownToken(t *testing.T) {
+	type grammar struct {
+		Ident string `@Ident`
+	}
+	_, err := participle.Build[grammar](participle.AttachTrivia("Remark"))
+	require.EqualError(t, err, `AttachTrivia(): lexer does not support symbol "Remark"`)
+}
+
+func TestParseElide(t *testing.T) {
+	type grammar struct {
+		Items []string `(@Ident | @Comment)*`
+	}
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Comment", `#[^\n]*`},
+		{"Ident", `\w+`},
+		{"Whitespace", `\s+`},
+	})
+	p := mustTestParser[grammar](t, participle.Lexer(def), participle.Elide("Comment", "Whitespace"))
+	actual, err := p.ParseString("", "a #comment\nb")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, actual.Items)
+
+	actual, err = p.ParseString("", "a #comment\nb", participle.ParseElide("Whitespace"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "#comment", "b"}, actual.Items)
+
+	_, err = p.ParseString("", "a b", participle.ParseElide())
+	require.EqualError(t, err, `1:2: unexpected token " "`)
+
+	_, err = p.ParseString("", "a", participle.ParseElide("Invalid"))
+	require.EqualError(t, err, `ParseElide() uses unknown token "Invalid"`)
+}
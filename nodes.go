@@ -4,6 +4,7 @@ import (
 	"encoding"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"strconv"
 	"strings"
@@ -18,9 +19,15 @@ var (
 	positionType        = reflect.TypeOf(lexer.Position{})
 	tokenType           = reflect.TypeOf(lexer.Token{})
 	tokensType          = reflect.TypeOf([]lexer.Token{})
+	tokenTypeType       = reflect.TypeOf(lexer.TokenType(0))
+	spanType            = reflect.TypeOf(lexer.Span{})
 	captureType         = reflect.TypeOf((*Capture)(nil)).Elem()
 	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
 	parseableType       = reflect.TypeOf((*Parseable)(nil)).Elem()
+	predicateType       = reflect.TypeOf((*Predicate)(nil)).Elem()
+	parsedHookType      = reflect.TypeOf((*ParsedHook)(nil)).Elem()
+	grammarNamerType    = reflect.TypeOf((*GrammarNamer)(nil)).Elem()
+	warningHookType     = reflect.TypeOf((*WarningHook)(nil)).Elem()
 
 	// NextMatch should be returned by Parseable.Parse() method implementations to indicate
 	// that the node did not match and that other matches should be attempted, if appropriate.
@@ -45,9 +52,15 @@ func decorate(err *error, name func() string) {
 		return
 	}
 	if perr, ok := (*err).(Error); ok {
-		*err = Errorf(perr.Position(), "%s: %s", name(), perr.Message())
+		// Keep the format of the message undecorated, so that it can still be translated.
+		format, args, prefix := messageFormat(perr)
+		decorated := codedErrorf(ErrorCodeOf(perr), perr.Position(), "%s: %s", name(), perr.Message())
+		if format != "" {
+			decorated.format, decorated.args, decorated.prefix = format, args, name()+": "+prefix
+		}
+		*err = decorated
 	} else {
-		*err = &ParseError{Msg: fmt.Sprintf("%s: %s", name(), *err)}
+		*err = &ParseError{Msg: fmt.Sprintf("%s: %s", name(), *err), Code: ErrorCodeOf(*err)}
 	}
 }
 
@@ -115,14 +128,104 @@ func (u *union) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Va
 	return vals, nil
 }
 
+// @@ (for an operator-precedence expression)
+type expression struct {
+	expressionDef
+	operandNode node
+}
+
+func (e *expression) String() string   { return ebnf(e) }
+func (e *expression) GoString() string { return e.typ.Name() }
+
+func (e *expression) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Value, err error) {
+	defer ctx.printTrace(e)()
+	return e.parse(ctx, parent, math.MinInt)
+}
+
+// Parse an expression containing operators of at least the given precedence, by precedence climbing.
+func (e *expression) parse(ctx *parseContext, parent reflect.Value, precedence int) (out []reflect.Value, err error) {
+	out, err = e.operandNode.Parse(ctx, parent)
+	if err != nil || out == nil {
+		return out, err
+	}
+	left := maybeRef(e.operand, out[0]).Convert(e.typ)
+	for {
+		token := *ctx.Peek()
+		op, ok := e.operators[token.Value]
+		if !ok || token.EOF() || op.Precedence < precedence {
+			return []reflect.Value{left}, nil
+		}
+		ctx.Next()
+		next := op.Precedence + 1
+		if op.RightAssociative {
+			next = op.Precedence
+		}
+		right, err := e.parse(ctx, parent, next)
+		if err != nil {
+			return right, err
+		}
+		if right == nil {
+			return []reflect.Value{left}, &UnexpectedTokenError{Unexpected: *ctx.Peek(), expectNode: e.operandNode, stack: ctx.RuleStack()}
+		}
+		left = e.build.Call([]reflect.Value{left, reflect.ValueOf(token), right[0]})[0]
+	}
+}
+
 // @@
 type strct struct {
-	typ              reflect.Type
-	expr             node
-	tokensFieldIndex []int
-	posFieldIndex    []int
-	endPosFieldIndex []int
-	usages           int
+	typ                reflect.Type
+	name               string // Production name.
+	grammarName        string // Optional description of the production for use in errors.
+	expr               node
+	tokensFieldIndex   []int
+	posFieldIndex      []int
+	endPosFieldIndex   []int
+	commentsFieldIndex []int
+	usages             int
+	leftRecursive      bool
+	predicate          bool
+	parsedHook         bool
+	warningHook        bool
+	recover            map[string]bool // Tokens to resume parsing after, on error.
+	defaults           []fieldDefault  // Values of fields with a `default` tag.
+}
+
+// The name from a GrammarNamer implementation or a `parser_name` tag of typ, if any.
+func grammarNameOf(typ reflect.Type) string {
+	if reflect.PtrTo(typ).Implements(grammarNamerType) {
+		return reflect.New(typ).Interface().(GrammarNamer).GrammarName()
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		if name, ok := typ.Field(i).Tag.Lookup("parser_name"); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// The name of the struct in a RuleFrame.
+func (s *strct) frameName() string {
+	if s.grammarName != "" {
+		return s.grammarName
+	}
+	return s.name
+}
+
+// The grammar name of the struct that n matches, if any.
+func grammarNameOfNode(n node) string {
+	switch n := n.(type) {
+	case *capture:
+		return grammarNameOfNode(n.node)
+	case *strct:
+		return n.grammarName
+	}
+	return ""
+}
+
+// The value of a field to set if it is not captured.
+type fieldDefault struct {
+	field structLexerField
+	value string
 }
 
 func newStrct(typ reflect.Type) *strct {
@@ -130,6 +233,13 @@ func newStrct(typ reflect.Type) *strct {
 		typ:    typ,
 		usages: 1,
 	}
+	if typ.Name() != "" {
+		s.name = productionName(typ)
+	}
+	s.predicate = reflect.PtrTo(typ).Implements(predicateType)
+	s.parsedHook = reflect.PtrTo(typ).Implements(parsedHookType)
+	s.warningHook = reflect.PtrTo(typ).Implements(warningHookType)
+	s.grammarName = grammarNameOf(typ)
 	field, ok := typ.FieldByName("Pos")
 	if ok && field.Type == positionType {
 		s.posFieldIndex = field.Index
@@ -142,30 +252,232 @@ func newStrct(typ reflect.Type) *strct {
 	if ok && field.Type == tokensType {
 		s.tokensFieldIndex = field.Index
 	}
+	field, ok = typ.FieldByName("Comments")
+	if ok && field.Type == tokensType {
+		s.commentsFieldIndex = field.Index
+	}
 	return s
 }
 
 func (s *strct) String() string   { return ebnf(s) }
-func (s *strct) GoString() string { return s.typ.Name() }
+func (s *strct) GoString() string { return s.name }
 
 func (s *strct) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Value, err error) {
+	if s.predicate {
+		lex := ctx.PeekingLexer
+		if !reflect.New(s.typ).Interface().(Predicate).Predicate(&lex) {
+			return nil, nil
+		}
+	}
+	if ctx.maxRecursion > 0 {
+		if ctx.recursion >= ctx.maxRecursion {
+			*ctx.aborted = codedErrorf(CodeMaxRecursion, ctx.Peek().Pos, "maximum recursion depth of %d exceeded", ctx.maxRecursion)
+			return nil, *ctx.aborted
+		}
+		ctx.recursion++
+		defer func() { ctx.recursion-- }()
+	}
+	if s.leftRecursive {
+		return s.parseLeftRecursive(ctx, parent)
+	}
+	return s.parse(ctx, parent)
+}
+
+// Parse a left recursive struct by growing a seed match.
+//
+// Recursive calls at the same position initially fail, so that the first
+// match is of a non-recursive alternative. The struct is then repeatedly
+// reparsed with recursive calls returning the previous match, until the match
+// no longer grows.
+func (s *strct) parseLeftRecursive(ctx *parseContext, parent reflect.Value) (out []reflect.Value, err error) {
+	key := leftRecursionKey{s, ctx.RawCursor()}
+	if memo, ok := ctx.leftRecursion[key]; ok {
+		if memo.value == nil {
+			return nil, nil
+		}
+		ctx.LoadCheckpoint(memo.checkpoint)
+		ctx.triviaCursor = memo.triviaCursor
+		return []reflect.Value{*memo.value}, nil
+	}
+	if ctx.leftRecursion == nil {
+		ctx.leftRecursion = map[leftRecursionKey]*leftRecursionMemo{}
+	}
+	memo := &leftRecursionMemo{}
+	ctx.leftRecursion[key] = memo
+	defer delete(ctx.leftRecursion, key)
+	var result *parseContext
+	for {
+		if err := ctx.CheckDone(); err != nil {
+			return nil, err
+		}
+		branch := ctx.Branch()
+		value, err := s.parse(branch, parent)
+		if err != nil && result == nil {
+			ctx.Accept(branch)
+			return value, err
+		}
+		if err != nil || value == nil || (result != nil && branch.RawCursor() <= result.RawCursor()) {
+			// Retain the deepest error of the failed attempt to grow the match.
+			if branch.deepestErrorDepth >= ctx.deepestErrorDepth {
+				ctx.deepestError = branch.deepestError
+				ctx.deepestErrorDepth = branch.deepestErrorDepth
+			}
+			break
+		}
+		result = branch
+		memo.value = &value[0]
+		memo.checkpoint = branch.MakeCheckpoint()
+		memo.triviaCursor = branch.triviaCursor
+	}
+	if result == nil {
+		return nil, nil
+	}
+	ctx.Accept(result)
+	return []reflect.Value{*memo.value}, nil
+}
+
+func (s *strct) parse(ctx *parseContext, parent reflect.Value) (out []reflect.Value, err error) {
 	defer ctx.printTrace(s)()
 	sv := reflect.New(s.typ).Elem()
 	start := ctx.RawCursor()
 	t := ctx.Peek()
+	pos := t.Pos
+	ctx.PushRule(s.frameName(), pos)
+	defer ctx.PopRule()
 	s.maybeInjectStartToken(t, sv)
+	cursor, triviaCursor := ctx.Cursor(), ctx.triviaCursor
+	leading := s.claimLeadingTrivia(ctx)
 	if out, err = s.expr.Parse(ctx, sv); err != nil {
 		_ = ctx.Apply() // Best effort to give partial AST.
 		ctx.MaybeUpdateError(err)
-		return []reflect.Value{sv}, err
+		if !s.recoverFrom(ctx, err, cursor) {
+			return []reflect.Value{sv}, err
+		}
 	} else if out == nil {
+		ctx.triviaCursor = triviaCursor
 		return nil, nil
 	}
 	end := ctx.RawCursor()
-	t = ctx.RawPeek()
-	s.maybeInjectEndToken(t, sv)
+	s.maybeInjectEndPos(ctx, start, sv)
 	s.maybeInjectTokens(ctx.Range(start, end), sv)
-	return []reflect.Value{sv}, ctx.Apply()
+	if ctx.Cursor() == cursor {
+		// Nothing was consumed, so there is nothing to attach trivia to.
+		ctx.triviaCursor = triviaCursor
+	} else {
+		s.maybeInjectComments(append(leading, s.claimTrailingTrivia(ctx, start, end)...), sv)
+	}
+	if err != nil {
+		return []reflect.Value{sv}, ctx.Apply()
+	}
+	s.maybeInjectDefaults(ctx, sv)
+	if err = ctx.Apply(); err != nil {
+		return []reflect.Value{sv}, err
+	}
+	if !s.parsedHook && !s.warningHook {
+		return []reflect.Value{sv}, nil
+	}
+	span := lexer.Span{Start: pos, End: endPos(ctx, start, true)}
+	if err = s.maybeCallParsedHook(ctx, sv, span); err != nil {
+		return []reflect.Value{sv}, err
+	}
+	s.maybeCallWarningHook(ctx, sv, span)
+	return []reflect.Value{sv}, nil
+}
+
+// Record the diagnostics of the struct's WarningHook, if it has one and they are being collected.
+func (s *strct) maybeCallWarningHook(ctx *parseContext, sv reflect.Value, span lexer.Span) {
+	if !s.warningHook || ctx.diagnostics == nil {
+		return
+	}
+	ctx.Warn(sv.Addr().Interface().(WarningHook).Warnings(span)...)
+}
+
+// Call the ParsedHook of the struct, positioning errors at "span" if necessary.
+func (s *strct) maybeCallParsedHook(ctx *parseContext, sv reflect.Value, span lexer.Span) error {
+	if !s.parsedHook {
+		return nil
+	}
+	lex := ctx.PeekingLexer
+	err := sv.Addr().Interface().(ParsedHook).OnParsed(&lex)
+	if err == nil {
+		return nil
+	}
+	if perr, ok := err.(Error); ok {
+		return perr
+	}
+	return &wrappingParseError{err: err, ParseError: ParseError{Msg: err.Error(), Pos: span.Start, Range: span, stack: ctx.RuleStack()}}
+}
+
+// Defer setting fields with defaults that have no pending captures.
+func (s *strct) maybeInjectDefaults(ctx *parseContext, sv reflect.Value) {
+next:
+	for _, def := range s.defaults {
+		for _, apply := range ctx.apply {
+			if apply.strct.UnsafeAddr() == sv.UnsafeAddr() && apply.field.Name == def.field.Name {
+				continue next
+			}
+		}
+		ctx.Defer(nil, sv, def.field, []reflect.Value{reflect.ValueOf(def.value)})
+	}
+}
+
+// Recover from an error if the struct declares recovery tokens and the parse
+// has progressed far enough that the error would not be backtracked from.
+func (s *strct) recoverFrom(ctx *parseContext, err error, cursor int) bool {
+	if s.recover == nil || !ctx.recovering {
+		return false
+	}
+	if !ctx.cut && (ctx.hasInfiniteLookahead() || ctx.Cursor() <= cursor+ctx.lookahead) {
+		return false
+	}
+	return ctx.Recover(err, s.recover)
+}
+
+// Claim trivia preceding the next token that has not already been attached to another node.
+//
+// As parent nodes are parsed first, leading trivia is attached to the outermost node.
+func (s *strct) claimLeadingTrivia(ctx *parseContext) []lexer.Token {
+	if s.commentsFieldIndex == nil || len(ctx.trivia) == 0 {
+		return nil
+	}
+	start := ctx.RawCursor()
+	if ctx.triviaCursor > start {
+		start = ctx.triviaCursor
+	}
+	_, next := ctx.PeekAny(func(lexer.Token) bool { return false })
+	var out []lexer.Token
+	for _, token := range ctx.Range(start, next) {
+		if ctx.trivia[token.Type] {
+			out = append(out, token)
+		}
+	}
+	ctx.triviaCursor = next
+	return out
+}
+
+// Claim trivia following the node on the same line as its last token.
+//
+// As child nodes complete first, trailing trivia is attached to the innermost node.
+func (s *strct) claimTrailingTrivia(ctx *parseContext, start, end lexer.RawCursor) []lexer.Token {
+	if s.commentsFieldIndex == nil || len(ctx.trivia) == 0 || end == start || ctx.triviaCursor > end {
+		return nil
+	}
+	last := ctx.Range(start, end)[end-start-1]
+	line := last.Pos.Line + strings.Count(last.Value, "\n")
+	_, next := ctx.PeekAny(func(lexer.Token) bool { return false })
+	var out []lexer.Token
+	cursor := end
+	for _, token := range ctx.Range(end, next) {
+		if token.Pos.Line != line {
+			break
+		}
+		cursor++
+		if ctx.trivia[token.Type] {
+			out = append(out, token)
+		}
+	}
+	ctx.triviaCursor = cursor
+	return out
 }
 
 func (s *strct) maybeInjectStartToken(token *lexer.Token, v reflect.Value) {
@@ -175,11 +487,27 @@ func (s *strct) maybeInjectStartToken(token *lexer.Token, v reflect.Value) {
 	v.FieldByIndex(s.posFieldIndex).Set(reflect.ValueOf(token.Pos))
 }
 
-func (s *strct) maybeInjectEndToken(token *lexer.Token, v reflect.Value) {
+func (s *strct) maybeInjectEndPos(ctx *parseContext, start lexer.RawCursor, v reflect.Value) {
 	if s.endPosFieldIndex == nil {
 		return
 	}
-	v.FieldByIndex(s.endPosFieldIndex).Set(reflect.ValueOf(token.Pos))
+	v.FieldByIndex(s.endPosFieldIndex).Set(reflect.ValueOf(endPos(ctx, start, ctx.trimEndPos)))
+}
+
+// The end of a node that started at "start", which is either the position of
+// the next token or, if "trim" is true, the end of the last token of the node.
+func endPos(ctx *parseContext, start lexer.RawCursor, trim bool) lexer.Position {
+	pos := ctx.RawPeek().Pos
+	if trim {
+		lex := ctx.PeekingLexer
+		if checkpoint, ok := lex.CheckpointBefore(1); ok && checkpoint.RawCursor() >= start {
+			lex.LoadCheckpoint(checkpoint)
+			last := lex.Peek()
+			pos = last.Pos
+			lexer.AdvancePosition(ctx.def, &pos, last.Value)
+		}
+	}
+	return pos
 }
 
 func (s *strct) maybeInjectTokens(tokens []lexer.Token, v reflect.Value) {
@@ -189,6 +517,13 @@ func (s *strct) maybeInjectTokens(tokens []lexer.Token, v reflect.Value) {
 	v.FieldByIndex(s.tokensFieldIndex).Set(reflect.ValueOf(tokens))
 }
 
+func (s *strct) maybeInjectComments(tokens []lexer.Token, v reflect.Value) {
+	if s.commentsFieldIndex == nil || tokens == nil {
+		return
+	}
+	v.FieldByIndex(s.commentsFieldIndex).Set(reflect.ValueOf(tokens))
+}
+
 type groupMatchMode int
 
 func (g groupMatchMode) String() string {
@@ -203,6 +538,8 @@ func (g groupMatchMode) String() string {
 		return "n+"
 	case groupMatchNonEmpty:
 		return "n!"
+	case groupMatchRange:
+		return "n{m,n}"
 	}
 	panic("??")
 }
@@ -213,6 +550,7 @@ const (
 	groupMatchZeroOrMore                = iota
 	groupMatchOneOrMore                 = iota
 	groupMatchNonEmpty                  = iota
+	groupMatchRange                     = iota
 )
 
 // ( <expr> ) - match once
@@ -220,11 +558,14 @@ const (
 // ( <expr> )+ - match one or more times
 // ( <expr> )? - match zero or once
 // ( <expr> )! - must be a non-empty match
+// ( <expr> ){m,n} - match between m and n times
 //
 // The additional modifier "!" forces the content of the group to be non-empty if it does match.
 type group struct {
 	expr node
 	mode groupMatchMode
+	min  int // Bounds for groupMatchRange, where max is -1 if unbounded.
+	max  int
 }
 
 func (g *group) String() string   { return ebnf(g) }
@@ -242,7 +583,9 @@ func (g *group) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Va
 		}
 		if len(out) == 0 {
 			t := ctx.Peek()
-			return out, Errorf(t.Pos, "sub-expression %s cannot be empty", g)
+			err := codedErrorf(CodeEmptyMatch, t.Pos, "sub-expression %s cannot be empty", g)
+			err.stack = ctx.RuleStack()
+			return out, err
 		}
 		return out, nil
 	case groupMatchOnce:
@@ -255,9 +598,19 @@ func (g *group) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Va
 	case groupMatchOneOrMore:
 		min = 1
 		max = MaxIterations
+	case groupMatchRange:
+		min = g.min
+		max = g.max
+		if max < 0 {
+			max = MaxIterations
+		}
 	}
+	start := ctx.Peek().Pos
 	matches := 0
 	for ; matches < max; matches++ {
+		if err := ctx.CheckDone(); err != nil {
+			return out, err
+		}
 		branch := ctx.Branch()
 		v, err := g.expr.Parse(branch, parent)
 		if err != nil {
@@ -265,6 +618,9 @@ func (g *group) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Va
 			// Optional part failed to match.
 			if ctx.Stop(err, branch) {
 				out = append(out, v...) // Try to return as much of the parse tree as possible
+				if max > 1 && ctx.recovering && ctx.Recover(err, ctx.recoverSync) {
+					continue
+				}
 				return out, err
 			}
 			break
@@ -278,10 +634,23 @@ func (g *group) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Va
 	// fmt.Printf("%d < %d < %d: out == nil? %v\n", min, matches, max, out == nil)
 	t := ctx.Peek()
 	if matches >= MaxIterations {
-		return nil, Errorf(t.Pos, "too many iterations of %s (> %d)", g, MaxIterations)
+		err := codedErrorf(CodeTooManyIterations, t.Pos, "too many iterations of %s (> %d)", g, MaxIterations)
+		err.stack = ctx.RuleStack()
+		return nil, err
 	}
 	if matches < min {
-		return out, Errorf(t.Pos, "sub-expression %s must match at least once", g)
+		var err *ParseError
+		if min > 1 {
+			err = codedErrorf(CodeTooFewMatches, t.Pos, "sub-expression %s must match at least %d times", g, min)
+		} else {
+			err = codedErrorf(CodeTooFewMatches, t.Pos, "sub-expression %s must match at least once", g)
+		}
+		if matches > 0 {
+			// Cover the partial match.
+			err.Range = lexer.Span{Start: start, End: t.Pos}
+		}
+		err.stack = ctx.RuleStack()
+		return out, err
 	}
 	// The idea here is that something like "a"? is a successful match and that parsing should proceed.
 	if min == 0 && out == nil {
@@ -291,9 +660,13 @@ func (g *group) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Va
 }
 
 // (?= <expr> ) for positive lookahead, (?! <expr> ) for negative lookahead; neither consumes input
+//
+// (?<= <expr> ) and (?<! <expr> ) are the equivalent lookbehind assertions.
 type lookaheadGroup struct {
 	expr     node
 	negative bool
+	behind   bool
+	maxWidth int // The maximum number of tokens a lookbehind expression can match.
 }
 
 func (l *lookaheadGroup) String() string   { return ebnf(l) }
@@ -301,10 +674,15 @@ func (l *lookaheadGroup) GoString() string { return "lookaheadGroup{}" }
 
 func (l *lookaheadGroup) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Value, err error) {
 	defer ctx.printTrace(l)()
-	// Create a branch to avoid advancing the parser as any match will be discarded
-	branch := ctx.Branch()
-	out, err = l.expr.Parse(branch, parent)
-	matchedLookahead := err == nil && out != nil
+	var matchedLookahead bool
+	if l.behind {
+		matchedLookahead = l.matchBehind(ctx, parent)
+	} else {
+		// Create a branch to avoid advancing the parser as any match will be discarded
+		branch := ctx.Branch()
+		out, err = l.expr.Parse(branch, parent)
+		matchedLookahead = err == nil && out != nil
+	}
 	expectingMatch := !l.negative
 	if matchedLookahead != expectingMatch {
 		return nil, &UnexpectedTokenError{Unexpected: *ctx.Peek()}
@@ -312,9 +690,30 @@ func (l *lookaheadGroup) Parse(ctx *parseContext, parent reflect.Value) (out []r
 	return []reflect.Value{}, nil // Empty match slice means a match, unlike nil
 }
 
+// Match the expression against runs of increasing length, up to its maximum
+// width, of the tokens preceding the current position.
+//
+// The expression must match the run exactly, ending at the current position.
+func (l *lookaheadGroup) matchBehind(ctx *parseContext, parent reflect.Value) bool {
+	for n := 0; n <= l.maxWidth; n++ {
+		checkpoint, ok := ctx.CheckpointBefore(n)
+		if !ok {
+			return false
+		}
+		branch := ctx.Branch()
+		branch.LoadCheckpoint(checkpoint)
+		out, err := l.expr.Parse(branch, parent)
+		if err == nil && out != nil && branch.Cursor() == ctx.Cursor() {
+			return true
+		}
+	}
+	return false
+}
+
 // <expr> {"|" <expr>}
 type disjunction struct {
-	nodes []node
+	nodes  []node
+	firsts []*firstSet // FIRST sets of nodes, if any are known.
 }
 
 func (d *disjunction) String() string   { return ebnf(d) }
@@ -327,7 +726,13 @@ func (d *disjunction) Parse(ctx *parseContext, parent reflect.Value) (out []refl
 		firstError   error
 		firstValues  []reflect.Value
 	)
-	for _, a := range d.nodes {
+	for i, a := range d.nodes {
+		if err := ctx.CheckDone(); err != nil {
+			return nil, err
+		}
+		if d.firsts != nil && d.firsts[i] != nil && !d.firsts[i].accepts(ctx) {
+			continue
+		}
 		branch := ctx.Branch()
 		if value, err := a.Parse(branch, parent); err != nil {
 			// If this branch progressed too far and still didn't match, error out.
@@ -336,10 +741,15 @@ func (d *disjunction) Parse(ctx *parseContext, parent reflect.Value) (out []refl
 			}
 			// Show the closest error returned. The idea here is that the further the parser progresses
 			// without error, the more difficult it is to trace the error back to its root.
-			if branch.Cursor() >= deepestError {
+			if branch.Cursor() > deepestError || firstError == nil {
 				firstError = err
 				firstValues = value
 				deepestError = branch.Cursor()
+			} else if branch.Cursor() == deepestError {
+				firstError = ctx.breakTie(firstError, err)
+				if ctx.tieBreak != TieBreakFirst {
+					firstValues = value
+				}
 			}
 		} else if value != nil {
 			bt := branch.RawPeek()
@@ -347,6 +757,9 @@ func (d *disjunction) Parse(ctx *parseContext, parent reflect.Value) (out []refl
 			if bt == ct && bt.Type != lexer.EOF {
 				panic(Errorf(bt.Pos, "branch %s was accepted but did not progress the lexer at %s (%q)", a, bt.Pos, bt.Value))
 			}
+			if ctx.ambiguityOut != nil {
+				d.detectAmbiguity(ctx, branch, parent, i)
+			}
 			ctx.Accept(branch)
 			return value, nil
 		}
@@ -358,6 +771,21 @@ func (d *disjunction) Parse(ctx *parseContext, parent reflect.Value) (out []refl
 	return nil, nil
 }
 
+// Record an ambiguity in "branch" if any alternative after the matching alternative "matched" would also match.
+func (d *disjunction) detectAmbiguity(ctx, branch *parseContext, parent reflect.Value, matched int) {
+	ambiguity := Ambiguity{Pos: ctx.Peek().Pos, Alternatives: []string{d.nodes[matched].String()}}
+	for _, a := range d.nodes[matched+1:] {
+		trial := ctx.Branch()
+		trial.ambiguityOut = nil // Ambiguities within alternatives are reported when they are parsed.
+		if value, err := a.Parse(trial, parent); err == nil && value != nil {
+			ambiguity.Alternatives = append(ambiguity.Alternatives, a.String())
+		}
+	}
+	if len(ambiguity.Alternatives) > 1 {
+		branch.ambiguities = append(branch.ambiguities[:len(branch.ambiguities):len(branch.ambiguities)], ambiguity)
+	}
+}
+
 // <node> ...
 type sequence struct {
 	head bool // True if this is the head node.
@@ -370,7 +798,12 @@ func (s *sequence) GoString() string { return "sequence{}" }
 
 func (s *sequence) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Value, err error) {
 	defer ctx.printTrace(s)()
+	var (
+		empty    *sequence // The first of the preceding nodes that matched without consuming any input.
+		consumed node      // The last of the preceding nodes that consumed input.
+	)
 	for n := s; n != nil; n = n.next {
+		cursor := ctx.Cursor()
 		child, err := n.node.Parse(ctx, parent)
 		out = append(out, child...)
 		if err != nil {
@@ -382,7 +815,19 @@ func (s *sequence) Parse(ctx *parseContext, parent reflect.Value) (out []reflect
 				return nil, nil
 			}
 			token := ctx.Peek()
-			return out, &UnexpectedTokenError{Unexpected: *token, expectNode: n}
+			if name := grammarNameOfNode(n.node); name != "" && empty == nil {
+				return out, &UnexpectedTokenError{Unexpected: *token, Expect: name, expectedFrom: n, continues: consumed, stack: ctx.RuleStack()}
+			}
+			expected := n
+			if empty != nil {
+				expected = empty
+			}
+			return out, &UnexpectedTokenError{Unexpected: *token, expectNode: n, expectedFrom: expected, continues: consumed, stack: ctx.RuleStack()}
+		}
+		if ctx.Cursor() != cursor {
+			empty, consumed = nil, n.node
+		} else if empty == nil {
+			empty = n
 		}
 		// Special-case for when children return an empty match.
 		// Appending an empty, non-nil slice to a nil slice returns a nil slice.
@@ -403,12 +848,22 @@ type capture struct {
 func (c *capture) String() string   { return ebnf(c) }
 func (c *capture) GoString() string { return "capture{}" }
 
+// Whether the field receives the metadata of the captured tokens, which excludes elided tokens.
+func (c *capture) capturesMetadata() bool {
+	t := indirectType(c.field.Type)
+	return t == tokenTypeType || t == spanType
+}
+
 func (c *capture) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Value, err error) {
 	defer ctx.printTrace(c)()
-	start := ctx.RawCursor()
+	checkpoint := ctx.MakeCheckpoint()
 	v, err := c.node.Parse(ctx, parent)
 	if v != nil {
-		ctx.Defer(ctx.Range(start, ctx.RawCursor()), parent, c.field, v)
+		tokens := ctx.Range(checkpoint.RawCursor(), ctx.RawCursor())
+		if c.capturesMetadata() {
+			tokens = ctx.consumedSince(checkpoint)
+		}
+		ctx.Defer(tokens, parent, c.field, v)
 	}
 	if err != nil {
 		return []reflect.Value{parent}, err
@@ -452,15 +907,7 @@ func (l *literal) GoString() string { return fmt.Sprintf("literal{%q, %q}", l.s,
 
 func (l *literal) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Value, err error) {
 	defer ctx.printTrace(l)()
-	match := func(t lexer.Token) bool {
-		var equal bool
-		if ctx.caseInsensitive[t.Type] {
-			equal = l.s == "" || strings.EqualFold(t.Value, l.s)
-		} else {
-			equal = l.s == "" || t.Value == l.s
-		}
-		return (l.t == lexer.EOF || l.t == t.Type) && equal
-	}
+	match := func(t lexer.Token) bool { return l.matches(ctx, t) }
 	token, cursor := ctx.PeekAny(match)
 	if match(token) {
 		ctx.FastForward(cursor)
@@ -469,6 +916,57 @@ func (l *literal) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.
 	return nil, nil
 }
 
+func (l *literal) matches(ctx *parseContext, t lexer.Token) bool {
+	var equal bool
+	if ctx.caseInsensitive[t.Type] {
+		equal = l.s == "" || strings.EqualFold(t.Value, l.s)
+	} else {
+		equal = l.s == "" || t.Value == l.s
+	}
+	return (l.t == lexer.EOF || l.t == t.Type) && equal
+}
+
+// =>
+type cut struct{}
+
+func (c *cut) String() string   { return ebnf(c) }
+func (c *cut) GoString() string { return "cut{}" }
+
+func (c *cut) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Value, err error) {
+	defer ctx.printTrace(c)()
+	ctx.cut = true
+	return []reflect.Value{}, nil
+}
+
+// recover("<literal>", ...)
+type recoverDirective struct {
+	sync []string
+}
+
+func (r *recoverDirective) String() string   { return ebnf(r) }
+func (r *recoverDirective) GoString() string { return "recover{}" }
+
+func (r *recoverDirective) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Value, err error) {
+	return []reflect.Value{}, nil
+}
+
+// ^<expr>
+type adjacent struct {
+	node node
+}
+
+func (a *adjacent) String() string   { return ebnf(a) }
+func (a *adjacent) GoString() string { return "adjacent{}" }
+
+func (a *adjacent) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Value, err error) {
+	defer ctx.printTrace(a)()
+	// Elided tokens between the previous and next tokens are skipped over by Peek.
+	if ctx.RawPeek() != ctx.Peek() {
+		return nil, nil
+	}
+	return a.node.Parse(ctx, parent)
+}
+
 type negation struct {
 	node node
 }
@@ -493,9 +991,31 @@ func (n *negation) Parse(ctx *parseContext, parent reflect.Value) (out []reflect
 		return nil, &UnexpectedTokenError{Unexpected: *notEOF}
 	}
 
-	// Just give the next token
+	// Give the next token itself, so that typed captures receive exactly the skipped token.
 	next := ctx.Next()
-	return []reflect.Value{reflect.ValueOf(next.Value)}, nil
+	return []reflect.Value{reflect.ValueOf(*next)}, nil
+}
+
+// Replace tokens matched by negations in "values" with their values.
+//
+// If every value was a token, the tokens are also returned.
+func tokenValues(values []reflect.Value) (out []reflect.Value, tokens []lexer.Token) {
+	out = values
+	for i, v := range values {
+		if v.Type() != tokenType {
+			continue
+		}
+		if tokens == nil {
+			out = append([]reflect.Value(nil), values...)
+		}
+		token := v.Interface().(lexer.Token)
+		tokens = append(tokens, token)
+		out[i] = reflect.ValueOf(token.Value)
+	}
+	if len(tokens) != len(values) {
+		tokens = nil
+	}
+	return out, tokens
 }
 
 // Attempt to transform values to given type.
@@ -555,6 +1075,20 @@ func conform(t reflect.Type, values []reflect.Value) (out []reflect.Value, err e
 	return out, nil
 }
 
+// Parse a single captured value that is exactly "true" or "false".
+func literalBool(values []reflect.Value) (value bool, ok bool) {
+	if len(values) != 1 || values[0].Kind() != reflect.String {
+		return false, false
+	}
+	switch values[0].String() {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return false, false
+}
+
 func sizeOfKind(kind reflect.Kind) int {
 	switch kind { // nolint: exhaustive
 	case reflect.Int8, reflect.Uint8:
@@ -593,13 +1127,25 @@ func maybeRef(tmpl reflect.Type, strct reflect.Value) reflect.Value {
 //
 // For all other types, an attempt will be made to convert the string to the corresponding
 // type (int, float32, etc.).
-func setField(tokens []lexer.Token, strct reflect.Value, field structLexerField, fieldValue []reflect.Value) (err error) { // nolint: gocognit
-	defer decorate(&err, func() string { return strct.Type().Name() + "." + field.Name })
+func setField(def lexer.Definition, tokens []lexer.Token, strct reflect.Value, field structLexerField, fieldValue []reflect.Value) (err error) { // nolint: gocognit
+	defer func() {
+		decorate(&err, func() string { return strct.Type().Name() + "." + field.Name })
+		if perr, ok := err.(*ParseError); ok && perr.Code == "" {
+			perr.Code = CodeInvalidValue
+		}
+	}()
 
 	f := strct.FieldByIndex(field.Index)
 
+	// Negations match exactly one token, which is more precise than the captured range.
+	fieldValue, matched := tokenValues(fieldValue)
+	if matched != nil {
+		tokens = matched
+	}
+
 	// Any kind of pointer, hydrate it first.
-	if f.Kind() == reflect.Ptr {
+	optional := f.Kind() == reflect.Ptr
+	if optional {
 		if f.IsNil() {
 			fv := reflect.New(f.Type().Elem()).Elem()
 			f.Set(fv.Addr())
@@ -619,6 +1165,20 @@ func setField(tokens []lexer.Token, strct reflect.Value, field structLexerField,
 		return nil
 	}
 
+	if f.Type() == tokenTypeType {
+		if len(tokens) > 0 {
+			f.Set(reflect.ValueOf(tokens[0].Type))
+		}
+		return nil
+	}
+
+	if f.Type() == spanType {
+		if len(tokens) > 0 {
+			f.Set(reflect.ValueOf(lexer.DefinitionSpanOf(def, tokens)))
+		}
+		return nil
+	}
+
 	if f.CanAddr() {
 		if d, ok := f.Addr().Interface().(Capture); ok {
 			ifv := make([]string, 0, len(fieldValue))
@@ -638,6 +1198,18 @@ func setField(tokens []lexer.Token, strct reflect.Value, field structLexerField,
 
 	if f.Kind() == reflect.Slice {
 		sliceElemType := f.Type().Elem()
+		switch sliceElemType {
+		case tokenTypeType:
+			for _, token := range tokens {
+				f.Set(reflect.Append(f, reflect.ValueOf(token.Type)))
+			}
+			return nil
+		case spanType:
+			for i := range tokens {
+				f.Set(reflect.Append(f, reflect.ValueOf(lexer.DefinitionSpanOf(def, tokens[i:i+1]))))
+			}
+			return nil
+		}
 		if sliceElemType.Implements(captureType) || reflect.PtrTo(sliceElemType).Implements(captureType) {
 			if sliceElemType.Kind() == reflect.Ptr {
 				sliceElemType = sliceElemType.Elem()
@@ -680,6 +1252,15 @@ func setField(tokens []lexer.Token, strct reflect.Value, field structLexerField,
 		return nil
 	}
 
+	// Optional booleans take the value of a literal "true" or "false" capture, so
+	// that a false value can be distinguished from absence.
+	if optional && f.Kind() == reflect.Bool {
+		if value, ok := literalBool(fieldValue); ok {
+			f.SetBool(value)
+			return nil
+		}
+	}
+
 	// Coalesce multiple tokens into one. This allows eg. ["-", "10"] to be captured as separate tokens but
 	// parsed as a single string "-10".
 	if len(fieldValue) > 1 {
@@ -1,9 +1,12 @@
 package participle
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"reflect"
+	"strings"
+	"sync"
 
 	"github.com/alecthomas/participle/v2/lexer"
 )
@@ -45,10 +48,132 @@ func UseLookahead(n int) Option {
 	}
 }
 
+// MaxRecursion limits the depth to which grammar structs may be nested while parsing to "n".
+//
+// Parsing deeply nested input, such as thousands of nested parentheses, fails
+// with a positioned error rather than overflowing the stack. A value of 0, the
+// default, means no limit.
+func MaxRecursion(n int) Option {
+	return func(p *parserOptions) error {
+		p.maxRecursion = n
+		return nil
+	}
+}
+
+// TrimEndPos sets EndPos fields to the end of the last token consumed by their
+// node, rather than to the position of the next token.
+//
+// By default the span from Pos to EndPos includes any elided or dropped tokens,
+// such as whitespace and comments, following the node. The end is computed from
+// the value of the last token, so it may not be exact if the value was
+// transformed, eg. by Unquote().
+func TrimEndPos() Option {
+	return func(p *parserOptions) error {
+		p.trimEndPos = true
+		return nil
+	}
+}
+
+// FormatErrors replaces the messages of errors returned by the parser with
+// those produced by "formatter".
+//
+// This allows the tone, language or verbosity of messages to be customised,
+// eg. to list Failure.Expected in a friendlier form. The original errors are
+// still available through errors.Unwrap() and errors.As().
+func FormatErrors(formatter ErrorFormatter) Option {
+	return func(p *parserOptions) error {
+		p.errorFormatter = formatter
+		return nil
+	}
+}
+
+// Messages translates or rephrases the messages of errors generated by the
+// parser, such as "unexpected token %q", with "catalog".
+//
+// Errors from the lexer, such as "invalid input text %q", are translated with
+// CodeLexer. Messages that the parser prefixed with the name of a field keep
+// the prefix, only the original message is translated.
+//
+// Messages are translated before being passed to any ErrorFormatter.
+func Messages(catalog MessageCatalog) Option {
+	return func(p *parserOptions) error {
+		p.messages = catalog
+		return nil
+	}
+}
+
+// ErrorContext adds up to "frames" of the productions that were being parsed
+// to error messages, innermost first, eg.
+//
+//	1:9: unexpected token ";" (expected ")"), while parsing Args at 1:3 in Call at 1:1
+//
+// The full stack is available with RuleStack regardless of this option.
+func ErrorContext(frames int) Option {
+	return func(p *parserOptions) error {
+		p.errorContext = frames
+		return nil
+	}
+}
+
+// PropagatePanics disables the conversion of panics during parsing to errors.
+//
+// By default, panics from within the parser, eg. due to a grammar that matches
+// without consuming input or a panicking Capture implementation, are returned
+// as an Error with the code CodeInternal, positioned at the start of the
+// innermost production being parsed. With this option they propagate to the
+// caller of Parse, which may be preferable while debugging.
+func PropagatePanics() Option {
+	return func(p *parserOptions) error {
+		p.propagatePanics = true
+		return nil
+	}
+}
+
+// TieBreak is a policy for choosing between errors from alternatives that
+// failed at the same depth. See ErrorTieBreak.
+type TieBreak int
+
+const (
+	// TieBreakMerge merges the expectations of unexpected token errors at the
+	// same position, and otherwise uses the error of the last alternative. This is the default.
+	TieBreakMerge TieBreak = iota
+	// TieBreakFirst uses the error of the first alternative, in declaration order.
+	TieBreakFirst
+	// TieBreakLast uses the error of the last alternative, in declaration order.
+	TieBreakLast
+)
+
+// ErrorTieBreak sets the policy for choosing the error reported when several
+// alternatives fail at the same depth.
+//
+// Errors from deeper in the input always take precedence, as they are usually
+// the most useful.
+func ErrorTieBreak(policy TieBreak) Option {
+	return func(p *parserOptions) error {
+		p.tieBreak = policy
+		return nil
+	}
+}
+
+// Lint the grammar while building the parser.
+//
+// If any potential problems are found, such as alternatives that can never
+// match or repeated expressions that can match without consuming input, Build
+// returns a *LintError listing them.
+func Lint() Option {
+	return func(p *parserOptions) error {
+		p.lint = true
+		return nil
+	}
+}
+
 // CaseInsensitive allows the specified token types to be matched case-insensitively.
 //
 // Note that the lexer itself will also have to be case-insensitive; this option
 // just controls whether literals in the grammar are matched case insensitively.
+//
+// Symbols reported by lexers implementing lexer.CaseInsensitiveDefinition, such
+// as rules marked with lexer.CaseInsensitive(), are included automatically.
 func CaseInsensitive(tokens ...string) Option {
 	return func(p *parserOptions) error {
 		for _, token := range tokens {
@@ -110,6 +235,95 @@ func Union[T any](members ...T) Option {
 	}
 }
 
+var (
+	unionMembersLock sync.Mutex
+	unionMembers     = map[reflect.Type][]reflect.Type{}
+)
+
+// RegisterUnionMembers registers additional members for the union type T.
+//
+// Registered members are appended, in registration order, to the members of
+// any union declared for T with Union[T] in parsers built afterwards. This
+// allows packages such as plugins to extend a host grammar, typically by
+// calling RegisterUnionMembers from an init() function.
+func RegisterUnionMembers[T any](members ...T) {
+	unionType := reflect.TypeOf((*T)(nil)).Elem()
+	unionMembersLock.Lock()
+	defer unionMembersLock.Unlock()
+	for _, m := range members {
+		unionMembers[unionType] = append(unionMembers[unionType], reflect.TypeOf(m))
+	}
+}
+
+// Adds registered members to union definitions, skipping any already present.
+func withRegisteredUnionMembers(defs []unionDef) []unionDef {
+	unionMembersLock.Lock()
+	defer unionMembersLock.Unlock()
+	out := make([]unionDef, 0, len(defs))
+	for _, def := range defs {
+		members := def.members
+	next:
+		for _, registered := range unionMembers[def.typ] {
+			for _, member := range members {
+				if member == registered {
+					continue next
+				}
+			}
+			members = append(members[:len(members):len(members)], registered)
+		}
+		out = append(out, unionDef{def.typ, members})
+	}
+	return out
+}
+
+// Operator defines a binary operator for Expression.
+type Operator struct {
+	// Token is the value of the operator token, eg. "+".
+	Token string
+	// Precedence of the operator, where operators with higher precedence bind more tightly.
+	Precedence int
+	// RightAssociative operators group from the right, eg. "a ^ b ^ c" parses as "a ^ (b ^ c)".
+	RightAssociative bool
+}
+
+// Expression associates an operator-precedence expression parser with some interface type T.
+//
+// Operands are parsed as O, which must implement T and is typically a union of
+// literals, unary and parenthesised expressions. Operands are combined with
+// the given binary operators according to their precedence and associativity,
+// calling build to construct each binary expression. That is, the EBNF rule is:
+//
+//	T = O (<operator> O)* .
+//
+// This avoids the usual ladder of productions for each level of precedence.
+func Expression[T, O any](build func(left T, op lexer.Token, right T) T, operators ...Operator) Option {
+	return func(p *parserOptions) error {
+		exprType := reflect.TypeOf(&build).Elem().Out(0)
+		if exprType.Kind() != reflect.Interface {
+			return fmt.Errorf("Expression: T must be an interface type (got %s)", exprType)
+		}
+		operandType := reflect.TypeOf((*O)(nil)).Elem()
+		if !operandType.Implements(exprType) {
+			return fmt.Errorf("Expression: operand type %s does not implement %s", operandType, exprType)
+		}
+		def := expressionDef{
+			typ:       exprType,
+			operand:   operandType,
+			operators: map[string]Operator{},
+			build:     reflect.ValueOf(build),
+		}
+		for _, op := range operators {
+			if _, ok := def.operators[op.Token]; ok {
+				return fmt.Errorf("Expression: duplicate operator %q", op.Token)
+			}
+			def.operators[op.Token] = op
+			def.tokens = append(def.tokens, op.Token)
+		}
+		p.expressionDefs = append(p.expressionDefs, def)
+		return nil
+	}
+}
+
 // ParseOption modifies how an individual parse is applied.
 type ParseOption func(p *parseContext)
 
@@ -128,3 +342,110 @@ func AllowTrailing(ok bool) ParseOption {
 		p.allowTrailing = ok
 	}
 }
+
+// Prefix parses only a prefix of the input, storing the position at which parsing stopped in "stop".
+//
+// Like AllowTrailing(true), the parse succeeds once the root of the grammar
+// has matched even if input remains. "stop" is set to the position of the
+// first token that was not consumed, or of the end of the input, which allows
+// a participle grammar to be embedded in a larger hand-written scanner.
+func Prefix(stop *lexer.Position) ParseOption {
+	return func(p *parseContext) {
+		p.allowTrailing = true
+		p.stop = stop
+	}
+}
+
+// Resumable stores a copy of the lexer in "lex" if the parse fails, advanced to the token at which the error occurred.
+//
+// Along with the partial AST returned with the error, this allows callers to
+// implement their own error recovery, by skipping tokens from the lexer and
+// resuming with ParseFromLexer.
+func Resumable(lex *lexer.PeekingLexer) ParseOption {
+	return func(p *parseContext) {
+		p.resume = lex
+	}
+}
+
+// CollectDiagnostics appends the non-fatal diagnostics reported by grammar
+// structs implementing WarningHook to "diagnostics".
+//
+// Only diagnostics from structs that are part of the resulting AST are
+// collected, including when the parse fails.
+func CollectDiagnostics(diagnostics *[]Diagnostic) ParseOption {
+	return func(p *parseContext) {
+		p.diagnostics = diagnostics
+	}
+}
+
+// Ambiguity is a position at which more than one alternative of a disjunction
+// matched the input. See DetectAmbiguity.
+type Ambiguity struct {
+	Pos lexer.Position
+	// The EBNF of the alternative that was used, followed by the alternatives
+	// after it that would also have matched.
+	Alternatives []string
+}
+
+func (a Ambiguity) String() string {
+	return fmt.Sprintf("%s: ambiguous alternatives %s", a.Pos, strings.Join(a.Alternatives, ", "))
+}
+
+// DetectAmbiguity appends the positions at which more than one alternative of
+// a disjunction matched to "ambiguities".
+//
+// After an alternative matches, the remaining alternatives are also attempted.
+// This helps to find grammars whose behaviour depends on the order of their
+// alternatives, but is slow, so it is intended for debugging only.
+func DetectAmbiguity(ambiguities *[]Ambiguity) ParseOption {
+	return func(p *parseContext) {
+		p.ambiguityOut = ambiguities
+	}
+}
+
+// ParseElide overrides the token types elided by the parser for a single parse.
+//
+// This allows the same parser to be used, for example, both to preserve and to
+// ignore comments. ParseElide() with no types elides nothing. It has no effect
+// on ParseFromLexer, as the PeekingLexer has already elided tokens.
+func ParseElide(types ...string) ParseOption {
+	return func(p *parseContext) {
+		p.elide = &types
+	}
+}
+
+// Recover from errors so that several errors can be reported from a single parse.
+//
+// When an iteration of a repeated expression, such as a list of statements,
+// fails, the error is recorded and tokens are skipped up to and including the
+// next token whose value is one of "sync", eg. ";" or "}", after which parsing
+// continues. Structs may declare their own synchronisation tokens with the
+// recover("<literal>", ...) directive, which take precedence. If any errors
+// were recorded the parse returns Errors along with as much of the AST as possible.
+func Recover(sync ...string) ParseOption {
+	return func(p *parseContext) {
+		p.recovering = true
+		p.recoverSync = map[string]bool{}
+		for _, token := range sync {
+			p.recoverSync[token] = true
+		}
+	}
+}
+
+// MaxErrors limits the number of errors reported when parsing with Recover().
+//
+// Once "n" errors have occurred the parse stops, returning those errors, so
+// that pathological input does not produce a flood of cascading errors.
+func MaxErrors(n int) ParseOption {
+	return func(p *parseContext) {
+		p.maxErrors = n
+	}
+}
+
+// Abort the parse once ctx is done.
+func withContext(ctx context.Context) ParseOption {
+	return func(p *parseContext) {
+		p.context = ctx
+		p.done = ctx.Done()
+	}
+}
@@ -2,6 +2,7 @@ package participle
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"reflect"
@@ -15,6 +16,14 @@ type unionDef struct {
 	members []reflect.Type
 }
 
+type expressionDef struct {
+	typ       reflect.Type
+	operand   reflect.Type
+	operators map[string]Operator
+	tokens    []string // Operator tokens in the order they were defined.
+	build     reflect.Value
+}
+
 type customDef struct {
 	typ     reflect.Type
 	parseFn reflect.Value
@@ -24,13 +33,28 @@ type parserOptions struct {
 	lex                   lexer.Definition
 	rootType              reflect.Type
 	typeNodes             map[reflect.Type]node
+	walkFields            map[reflect.Type][][]int // The `@@` fields of each struct, for Walk.
 	useLookahead          int
 	caseInsensitive       map[string]bool
 	caseInsensitiveTokens map[lexer.TokenType]bool
 	mappers               []mapperByToken
 	unionDefs             []unionDef
 	customDefs            []customDef
+	expressionDefs        []expressionDef
 	elide                 []string
+	drop                  []string
+	trivia                []string
+	triviaTokens          map[lexer.TokenType]bool
+	maxRecursion          int
+	rules                 *RuleBuilder
+	lint                  bool
+	diagnostics           *[]LintFinding // Set by BuildWithDiagnostics.
+	trimEndPos            bool
+	errorFormatter        ErrorFormatter
+	messages              MessageCatalog
+	tieBreak              TieBreak
+	errorContext          int
+	propagatePanics       bool
 }
 
 // A Parser for a particular grammar and lexer.
@@ -57,6 +81,25 @@ func MustBuild[G any](options ...Option) *Parser[G] {
 	return parser
 }
 
+// BuildWithDiagnostics is like Build, but also returns non-fatal warnings about the grammar.
+//
+// In addition to the checks performed by the Lint option, which are reported
+// as warnings rather than errors, these include alternatives that may require
+// more lookahead, literals that are not matched by any lexer rule, and token
+// types of the lexer that are not used by the grammar.
+func BuildWithDiagnostics[G any](options ...Option) (*Parser[G], []LintFinding, error) {
+	var warnings []LintFinding
+	options = append(options[:len(options):len(options)], func(p *parserOptions) error {
+		p.diagnostics = &warnings
+		return nil
+	})
+	parser, err := Build[G](options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parser, warnings, nil
+}
+
 // Build constructs a parser for the given grammar.
 //
 // If "Lexer()" is not provided as an option, a default lexer based on text/scanner will be used. This scans typical Go-
@@ -78,6 +121,11 @@ func Build[G any](options ...Option) (parser *Parser[G], err error) {
 		}
 	}
 
+	if ci, ok := p.lex.(lexer.CaseInsensitiveDefinition); ok {
+		for _, symbol := range ci.CaseInsensitiveSymbols() {
+			p.caseInsensitive[symbol] = true
+		}
+	}
 	symbols := p.lex.Symbols()
 	if len(p.mappers) > 0 {
 		mappers := map[lexer.TokenType][]Mapper{}
@@ -110,11 +158,32 @@ func Build[G any](options ...Option) (parser *Parser[G], err error) {
 		}}
 	}
 
+	if len(p.drop) > 0 {
+		drop, err := lexer.MakeSymbolTable(p.lex, p.drop...)
+		if err != nil {
+			return nil, fmt.Errorf("Drop(): %w", err)
+		}
+		p.lex = lexer.Filter(p.lex, func() lexer.FilterFunc {
+			return func(t lexer.Token) ([]lexer.Token, error) {
+				if drop[t.Type] {
+					return nil, nil
+				}
+				return []lexer.Token{t}, nil
+			}
+		})
+	}
+
 	context := newGeneratorContext(p.lex)
 	if err := context.addCustomDefs(p.customDefs); err != nil {
 		return nil, err
 	}
-	if err := context.addUnionDefs(p.unionDefs); err != nil {
+	if err := context.addExpressionDefs(p.expressionDefs); err != nil {
+		return nil, err
+	}
+	if err := context.addUnionDefs(withRegisteredUnionMembers(p.unionDefs)); err != nil {
+		return nil, err
+	}
+	if err := context.addExpressionOperands(p.expressionDefs); err != nil {
 		return nil, err
 	}
 
@@ -124,16 +193,39 @@ func Build[G any](options ...Option) (parser *Parser[G], err error) {
 		v = v.Elem()
 	}
 	p.rootType = v.Type()
-	rootNode, err := context.parseType(p.rootType)
+	var rootNode node
+	if p.rules != nil {
+		if p.rootType.Elem() != ruleNodeType {
+			return nil, fmt.Errorf("Rules() requires a Parser[RuleNode] but got Parser[%s]", p.rootType.Elem())
+		}
+		rootNode, err = p.rules.build(&ruleGenerator{context, map[*RuleBuilder]*rule{}})
+		context.typeNodes[ruleNodeType] = rootNode
+	} else {
+		rootNode, err = context.parseType(p.rootType)
+	}
 	if err != nil {
 		return nil, err
 	}
 	if err := validate(rootNode); err != nil {
 		return nil, err
 	}
+	computeFirstSets(rootNode)
+	if p.diagnostics != nil {
+		ignored := append(append(append([]string{}, p.elide...), p.drop...), p.trivia...)
+		*p.diagnostics = diagnose(rootNode, context.typeNodes, p.lex, p.useLookahead, ignored)
+	} else if p.lint {
+		if findings := lint(rootNode, context.typeNodes); len(findings) > 0 {
+			return nil, &LintError{Findings: findings}
+		}
+	}
 	p.typeNodes = context.typeNodes
 	p.typeNodes[p.rootType] = rootNode
+	p.walkFields = collectWalkFields(p.typeNodes)
+	registerWalkFields(p.walkFields)
 	p.setCaseInsensitiveTokens()
+	if p.triviaTokens, err = lexer.MakeSymbolTable(p.lex, p.trivia...); err != nil {
+		return nil, fmt.Errorf("AttachTrivia(): %w", err)
+	}
 	return p, nil
 }
 
@@ -159,21 +251,85 @@ func (p *Parser[G]) Lex(filename string, r io.Reader) ([]lexer.Token, error) {
 // This may return a Error.
 func (p *Parser[G]) ParseFromLexer(lex *lexer.PeekingLexer, options ...ParseOption) (*G, error) {
 	v := new(G)
+	return v, p.parseFromLexerInto(lex, v, options...)
+}
+
+func (p *Parser[G]) parseFromLexerInto(lex *lexer.PeekingLexer, v *G, options ...ParseOption) (err error) {
 	rv := reflect.ValueOf(v)
 	parseNode, err := p.parseNodeFor(rv)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	ctx := newParseContext(lex, p.useLookahead, p.caseInsensitiveTokens)
+	ctx.trivia = p.triviaTokens
+	ctx.trimEndPos = p.trimEndPos
+	ctx.def = p.lex
+	ctx.tieBreak = p.tieBreak
+	ctx.recoverPanics = !p.propagatePanics
+	if ctx.recoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				err = p.finishErrors(panicError(r, ctx.Peek().Pos, nil))
+			}
+		}()
+	}
+	if p.maxRecursion > 0 {
+		ctx.maxRecursion = p.maxRecursion
+		ctx.aborted = new(error)
+	}
 	defer func() { *lex = ctx.PeekingLexer }()
+	defer func() { err = p.finishErrors(err) }()
 	for _, option := range options {
 		option(&ctx)
 	}
+	if ctx.stop != nil {
+		defer func() { *ctx.stop = ctx.RawPeek().Pos }()
+	}
+	if ctx.diagnostics != nil {
+		defer func() { *ctx.diagnostics = append(*ctx.diagnostics, ctx.warnings...) }()
+	}
+	if ctx.ambiguityOut != nil {
+		defer func() { *ctx.ambiguityOut = append(*ctx.ambiguityOut, ctx.ambiguities...) }()
+	}
+	if ctx.resume != nil {
+		defer func() {
+			if err != nil {
+				*ctx.resume = ctx.lexerAt(err)
+			}
+		}()
+	}
 	// If the grammar implements Parseable, use it.
 	if parseable, ok := any(v).(Parseable); ok {
-		return v, p.rootParseable(&ctx, parseable)
+		return p.rootParseable(&ctx, parseable)
+	}
+	err = p.parseOne(&ctx, parseNode, rv)
+	if done := ctx.CheckDone(); done != nil {
+		return done
+	}
+	if len(ctx.errors) > 0 {
+		if err != nil {
+			ctx.errors = append(ctx.errors, err)
+		}
+		return Errors(ctx.errors)
 	}
-	return v, p.parseOne(&ctx, parseNode, rv)
+	return err
+}
+
+// Apply the MessageCatalog, ErrorContext and ErrorFormatter, if any, to errors returned by the parser.
+func (p *Parser[G]) finishErrors(err error) error {
+	if err == nil {
+		return nil
+	}
+	if p.messages != nil {
+		err = translateErrors(p.messages, err)
+	}
+	if p.errorContext > 0 {
+		err = addErrorContext(p.errorContext, err)
+	}
+	if p.errorFormatter != nil {
+		err = formatErrors(p.errorFormatter, err)
+	}
+	return err
 }
 
 func (p *Parser[G]) setCaseInsensitiveTokens() {
@@ -185,12 +341,29 @@ func (p *Parser[G]) setCaseInsensitiveTokens() {
 	}
 }
 
-func (p *Parser[G]) parse(lex lexer.Lexer, options ...ParseOption) (v *G, err error) {
-	peeker, err := lexer.Upgrade(lex, p.getElidedTypes()...)
+func (p *Parser[G]) parse(lex lexer.Lexer, v *G, options ...ParseOption) (*G, error) {
+	elide := p.getElidedTypes()
+	// Check for per-parse overrides of the elided types.
+	overrides := parseContext{}
+	for _, option := range options {
+		option(&overrides)
+	}
+	if overrides.elide != nil {
+		symbols := p.lex.Symbols()
+		elide = make([]lexer.TokenType, 0, len(*overrides.elide))
+		for _, name := range *overrides.elide {
+			rn, ok := symbols[name]
+			if !ok {
+				return nil, fmt.Errorf("ParseElide() uses unknown token %q", name)
+			}
+			elide = append(elide, rn)
+		}
+	}
+	peeker, err := lexer.Upgrade(lex, elide...)
 	if err != nil {
-		return nil, err
+		return nil, p.finishErrors(err)
 	}
-	return p.ParseFromLexer(peeker, options...)
+	return v, p.parseFromLexerInto(peeker, v, options...)
 }
 
 // Parse from r into grammar v which must be of the same type as the grammar passed to
@@ -205,7 +378,7 @@ func (p *Parser[G]) Parse(filename string, r io.Reader, options ...ParseOption)
 	if err != nil {
 		return nil, err
 	}
-	return p.parse(lex, options...)
+	return p.parse(lex, new(G), options...)
 }
 
 // ParseString from s into grammar v which must be of the same type as the grammar passed to
@@ -222,12 +395,39 @@ func (p *Parser[G]) ParseString(filename string, s string, options ...ParseOptio
 	if err != nil {
 		return nil, err
 	}
-	return p.parse(lex, options...)
+	return p.parse(lex, new(G), options...)
+}
+
+// ParseInto parses s into "dst", rather than into a newly allocated value.
+//
+// This allows values to be reused, eg. from a sync.Pool, to reduce allocations
+// when parsing at a high rate. Fields are only assigned when they are captured,
+// so "dst" should be reset before parsing into it.
+//
+// This may return an Error.
+func (p *Parser[G]) ParseInto(filename string, s string, dst *G, options ...ParseOption) error {
+	var lex lexer.Lexer
+	var err error
+	if sl, ok := p.lex.(lexer.StringDefinition); ok {
+		lex, err = sl.LexString(filename, s)
+	} else {
+		lex, err = p.lex.Lex(filename, strings.NewReader(s))
+	}
+	if err != nil {
+		return err
+	}
+	_, err = p.parse(lex, dst, options...)
+	return err
 }
 
 // ParseBytes from b into grammar v which must be of the same type as the grammar passed to
 // Build(). Parameter filename is used as an opaque prefix in error messages.
 //
+// Lexers that implement lexer.BytesDefinition may return tokens that share
+// memory with b, such as the stateful lexer with the lexer.ZeroCopy() option,
+// in which case captured strings also do and b must not be modified while the
+// AST is in use.
+//
 // This may return an Error.
 func (p *Parser[G]) ParseBytes(filename string, b []byte, options ...ParseOption) (v *G, err error) {
 	var lex lexer.Lexer
@@ -239,21 +439,60 @@ func (p *Parser[G]) ParseBytes(filename string, b []byte, options ...ParseOption
 	if err != nil {
 		return nil, err
 	}
-	return p.parse(lex, options...)
+	return p.parse(lex, new(G), options...)
+}
+
+// ParseContext is like Parse, but aborts with an error wrapping ctx.Err() once ctx is done.
+//
+// This can be used to bound the time spent parsing hostile input.
+func (p *Parser[G]) ParseContext(ctx context.Context, filename string, r io.Reader, options ...ParseOption) (v *G, err error) {
+	return p.Parse(filename, r, append([]ParseOption{withContext(ctx)}, options...)...)
+}
+
+// ParseStringContext is like ParseString, but aborts with an error wrapping ctx.Err() once ctx is done.
+func (p *Parser[G]) ParseStringContext(ctx context.Context, filename string, s string, options ...ParseOption) (v *G, err error) {
+	return p.ParseString(filename, s, append([]ParseOption{withContext(ctx)}, options...)...)
+}
+
+// ParseBytesContext is like ParseBytes, but aborts with an error wrapping ctx.Err() once ctx is done.
+func (p *Parser[G]) ParseBytesContext(ctx context.Context, filename string, b []byte, options ...ParseOption) (v *G, err error) {
+	return p.ParseBytes(filename, b, append([]ParseOption{withContext(ctx)}, options...)...)
 }
 
 func (p *Parser[G]) parseOne(ctx *parseContext, parseNode node, rv reflect.Value) error {
 	err := p.parseInto(ctx, parseNode, rv)
 	if err != nil {
+		// An abandoned attempt that ran out of input means that more input might succeed.
+		if ctx.deepestError != nil && IsIncomplete(ctx.deepestError) {
+			markIncomplete(err)
+		}
 		return err
 	}
 	token := ctx.Peek()
 	if !token.EOF() && !ctx.allowTrailing {
 		return ctx.DeepestError(&UnexpectedTokenError{Unexpected: *token})
 	}
+	if token.EOF() {
+		p.maybeExtendRootTokens(ctx, rv)
+	}
 	return nil
 }
 
+// Extend the Tokens of the root node over any elided tokens preceding EOF, so
+// that they cover the remainder of the input. See Unparse.
+func (p *Parser[G]) maybeExtendRootTokens(ctx *parseContext, rv reflect.Value) {
+	s, ok := p.typeNodes[rv.Type().Elem()].(*strct)
+	if !ok || s.tokensFieldIndex == nil {
+		return
+	}
+	field := rv.Elem().FieldByIndex(s.tokensFieldIndex)
+	start := ctx.RawCursor() - lexer.RawCursor(field.Len())
+	_, eof := ctx.PeekAny(func(lexer.Token) bool { return false })
+	if eof > ctx.RawCursor() {
+		field.Set(reflect.ValueOf(ctx.Range(start, eof)))
+	}
+}
+
 func (p *Parser[G]) parseInto(ctx *parseContext, parseNode node, rv reflect.Value) error {
 	if rv.IsNil() {
 		return fmt.Errorf("target must be a non-nil pointer to a struct or interface, but is a nil %s", rv.Type())
@@ -267,7 +506,7 @@ func (p *Parser[G]) parseInto(ctx *parseContext, parseNode node, rv reflect.Valu
 	}
 	if pv == nil {
 		token := ctx.Peek()
-		return ctx.DeepestError(&UnexpectedTokenError{Unexpected: *token})
+		return ctx.DeepestError(&UnexpectedTokenError{Unexpected: *token, Expect: grammarNameOfNode(parseNode), expectedFrom: parseNode})
 	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package participle_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -1092,6 +1093,85 @@ func TestAllowTrailing(t *testing.T) {
 	require.Equal(t, &G{"hello"}, g)
 }
 
+func TestParseInto(t *testing.T) {
+	type G struct {
+		Names []string `@Ident*`
+	}
+	p := mustTestParser[G](t)
+	dst := &G{}
+	err := p.ParseInto("", "a b c", dst)
+	require.NoError(t, err)
+	require.Equal(t, &G{Names: []string{"a", "b", "c"}}, dst)
+
+	*dst = G{}
+	err = p.ParseInto("", "d e", dst)
+	require.NoError(t, err)
+	require.Equal(t, &G{Names: []string{"d", "e"}}, dst)
+
+	err = p.ParseInto("", "f 1", dst)
+	require.Error(t, err)
+}
+
+func TestPrefix(t *testing.T) {
+	type G struct {
+		Name string `@Ident`
+	}
+	p := mustTestParser[G](t)
+	var stop lexer.Position
+	g, err := p.ParseString("", "hello  world", participle.Prefix(&stop))
+	require.NoError(t, err)
+	require.Equal(t, &G{"hello"}, g)
+	require.Equal(t, lexer.Position{Offset: 7, Line: 1, Column: 8}, stop)
+
+	_, err = p.ParseString("", "hello", participle.Prefix(&stop))
+	require.NoError(t, err)
+	require.Equal(t, 5, stop.Offset)
+}
+
+func TestResumable(t *testing.T) {
+	type stmt struct {
+		Key   string `@Ident "="`
+		Value int    `@Int ";"`
+	}
+	type grammar struct {
+		Stmts []*stmt `@@*`
+	}
+	p := mustTestParser[grammar](t)
+	var lex lexer.PeekingLexer
+	actual, err := p.ParseString("", "a = 1; b = ; c = 3;", participle.Resumable(&lex))
+	require.EqualError(t, err, `1:12: unexpected token ";" (expected <int> ";")`)
+	require.Equal(t, []*stmt{{Key: "a", Value: 1}, {Key: "b"}}, actual.Stmts)
+	require.Equal(t, ";", lex.Peek().Value)
+
+	// Skip past the erroneous statement and resume.
+	lex.Next()
+	rest, err := p.ParseFromLexer(&lex)
+	require.NoError(t, err)
+	require.Equal(t, []*stmt{{Key: "c", Value: 3}}, rest.Stmts)
+
+	// Errors reported behind the cursor rewind the lexer.
+	hp := mustTestParser[resumableGrammar](t)
+	_, err = hp.ParseString("", "a = 1; b = 2; c = 3;", participle.Resumable(&lex))
+	require.EqualError(t, err, `1:8: invalid key "b"`)
+	require.Equal(t, "b", lex.Peek().Value)
+}
+
+type resumableStmt struct {
+	Key   string `@Ident "="`
+	Value int    `@Int ";"`
+}
+
+func (s *resumableStmt) OnParsed(lex *lexer.PeekingLexer) error {
+	if s.Key == "b" {
+		return fmt.Errorf("invalid key %q", s.Key)
+	}
+	return nil
+}
+
+type resumableGrammar struct {
+	Stmts []*resumableStmt `@@*`
+}
+
 func TestDisjunctionErrorReporting(t *testing.T) {
 	type statement struct {
 		Add    bool `  @"add"`
@@ -1153,6 +1233,84 @@ func TestCustomBoolIfSet(t *testing.T) {
 	require.Equal(t, &G{false}, g)
 }
 
+func TestOptionalBool(t *testing.T) {
+	type G struct {
+		Flag    *bool `@"flag"?`
+		Enabled *bool `("enabled" "=" @("true" | "false"))?`
+		Force   *bool `("-" @"f")?`
+	}
+
+	p := mustTestParser[G](t)
+	yes, no := true, false
+
+	g, err := p.ParseString("", ``)
+	require.NoError(t, err)
+	require.Equal(t, &G{}, g)
+
+	g, err = p.ParseString("", `flag`)
+	require.NoError(t, err)
+	require.Equal(t, &G{Flag: &yes}, g)
+
+	// Literal "true" and "false" captures set the value, anything else presence.
+	g, err = p.ParseString("", `enabled = false - f`)
+	require.NoError(t, err)
+	require.Equal(t, &G{Enabled: &no, Force: &yes}, g)
+
+	g, err = p.ParseString("", `flag enabled = true`)
+	require.NoError(t, err)
+	require.Equal(t, &G{Flag: &yes, Enabled: &yes}, g)
+}
+
+func TestMaybe(t *testing.T) {
+	type G struct {
+		Flag    participle.Maybe[bool]   `@"flag"?`
+		Enabled participle.Maybe[bool]   `("enabled" "=" @("true" | "false"))?`
+		Level   participle.Maybe[int]    `("level" @Int)?`
+		Name    participle.Maybe[string] `("name" @Ident)?`
+	}
+
+	p := mustTestParser[G](t)
+
+	g, err := p.ParseString("", ``)
+	require.NoError(t, err)
+	require.Equal(t, &G{}, g)
+
+	g, err = p.ParseString("", `flag enabled = false level 0 name x`)
+	require.NoError(t, err)
+	require.Equal(t, &G{
+		Flag:    participle.Maybe[bool]{Present: true, Value: true},
+		Enabled: participle.Maybe[bool]{Present: true, Value: false},
+		Level:   participle.Maybe[int]{Present: true, Value: 0},
+		Name:    participle.Maybe[string]{Present: true, Value: "x"},
+	}, g)
+}
+
+func TestDefaultTag(t *testing.T) {
+	type G struct {
+		Name  string   `parser:"@Ident" default:"unnamed"`
+		Limit int      `parser:"('limit' @Int)?" default:"100"`
+		Ratio *string  `parser:"('ratio' @Float)?" default:"0.5"`
+		Tags  []string `parser:"('tags' @Ident+)?"`
+	}
+
+	p := mustTestParser[G](t)
+	ratio := "0.5"
+
+	g, err := p.ParseString("", `query`)
+	require.NoError(t, err)
+	require.Equal(t, &G{Name: "query", Limit: 100, Ratio: &ratio}, g)
+
+	g, err = p.ParseString("", `query limit 0`)
+	require.NoError(t, err)
+	require.Equal(t, &G{Name: "query", Limit: 0, Ratio: &ratio}, g)
+
+	type Bad struct {
+		Limit int `parser:"('limit' @Int)?" default:"lots"`
+	}
+	_, err = participle.Build[Bad]()
+	require.EqualError(t, err, `invalid default "lots": Bad.Limit: strconv.ParseInt: parsing "lots": invalid syntax`)
+}
+
 func TestPointerToList(t *testing.T) {
 	type grammar struct {
 		List *[]string `@Ident*`
@@ -1241,6 +1399,65 @@ func TestNegationLookaheadError(t *testing.T) {
 	require.EqualError(t, err, `1:7: unexpected token "."`)
 }
 
+func TestNegationTypedCapture(t *testing.T) {
+	type grammar struct {
+		Name  string          `@Ident`
+		Token lexer.Token     `@~";"`
+		Type  lexer.TokenType `@~";"`
+		Span  *lexer.Span     `@~";"`
+		Count int             `@~";" ";"`
+	}
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Ident", `\w+`},
+		{"Punct", `[;,]`},
+		{"Whitespace", `\s+`},
+	})
+	p := mustTestParser[grammar](t, participle.Lexer(def), participle.Elide("Whitespace"))
+	ast, err := p.ParseString("", `x , y z 42;`)
+	require.NoError(t, err)
+	punct := def.Symbols()["Punct"]
+	expected := &grammar{
+		Name:  "x",
+		Token: lexer.Token{Type: punct, Value: ",", Pos: lexer.Position{Offset: 2, Line: 1, Column: 3}},
+		Type:  def.Symbols()["Ident"],
+		Span: &lexer.Span{
+			Start: lexer.Position{Offset: 6, Line: 1, Column: 7},
+			End:   lexer.Position{Offset: 7, Line: 1, Column: 8},
+		},
+		Count: 42,
+	}
+	require.Equal(t, expected, ast)
+}
+
+func TestCut(t *testing.T) {
+	type withoutCut struct {
+		If     string   `  "if" @Ident ";"`
+		Idents []string `| @Ident+ ";"`
+	}
+	p := mustTestParser[withoutCut](t)
+	ast, err := p.ParseString("", `if ;`)
+	require.NoError(t, err)
+	require.Equal(t, &withoutCut{Idents: []string{"if"}}, ast)
+
+	type withCut struct {
+		If     string   `  "if" => @Ident ";"`
+		Idents []string `| @Ident+ ";"`
+	}
+	p2 := mustTestParser[withCut](t)
+	_, err = p2.ParseString("", `if ;`)
+	require.EqualError(t, err, `1:4: unexpected token ";" (expected <ident> ";")`)
+	ast2, err := p2.ParseString("", `if x ;`)
+	require.NoError(t, err)
+	require.Equal(t, &withCut{If: "x"}, ast2)
+	require.Equal(t, `WithCut = ("if" => <ident> ";") | (<ident>+ ";") .`, p2.String())
+
+	type badCut struct {
+		If string `"if" =< @Ident`
+	}
+	_, err = participle.Build[badCut]()
+	require.EqualError(t, err, `If: expected => but got "=<"`)
+}
+
 func TestLookaheadGroup_Positive_SingleToken(t *testing.T) {
 	type val struct {
 		Str string `  @String`
@@ -1328,6 +1545,46 @@ func TestLookaheadGroup_Negative_MultipleTokens(t *testing.T) {
 	require.EqualError(t, err, `1:9: unexpected token "."`)
 }
 
+func TestLookbehindGroup(t *testing.T) {
+	type part struct {
+		Unary  bool   `  (?<! Int | ")") @"-"`
+		Binary bool   `| (?<= Int | ")") @"-"`
+		Other  string `| @(Int | "(" | ")")`
+	}
+	type grammar struct {
+		Parts []part `@@*`
+	}
+	p := mustTestParser[grammar](t)
+	require.Equal(t, `Grammar = Part* .
+Part = ((?<! <int> | ")") "-") | ((?<= <int> | ")") "-") | (<int> | "(" | ")") .`, p.String())
+
+	ast, err := p.ParseString("", `-1 - (2 - -3)`)
+	require.NoError(t, err)
+	require.Equal(t, []part{
+		{Unary: true}, {Other: "1"}, {Binary: true}, {Other: "("}, {Other: "2"},
+		{Binary: true}, {Unary: true}, {Other: "3"}, {Other: ")"},
+	}, ast.Parts)
+
+	// Only as many preceding tokens as the expression can match are considered.
+	ast, err = p.ParseString("", strings.Repeat("( - ", 4000))
+	require.NoError(t, err)
+	require.Equal(t, 8000, len(ast.Parts))
+}
+
+func TestLookbehindGroupMustBeBounded(t *testing.T) {
+	type grammar struct {
+		Value string `(?<= "(" Int*) @Int`
+	}
+	_, err := participle.Build[grammar]()
+	require.EqualError(t, err, "lookbehind must match a bounded number of tokens in\n\n  (?<= \"(\" <int>*)")
+
+	type bounded struct {
+		Value string `(?<= "(" Int{0,2} ("," | ";")?) @Int`
+	}
+	_, err = participle.Build[bounded]()
+	require.NoError(t, err)
+}
+
 func TestASTTokens(t *testing.T) {
 	type subject struct {
 		Tokens []lexer.Token
@@ -1383,6 +1640,91 @@ func TestCaptureIntoToken(t *testing.T) {
 	require.Equal(t, expected, actual)
 }
 
+func TestCaptureTokenMetadata(t *testing.T) {
+	type ast struct {
+		Kind  lexer.TokenType `@(Ident | Int)`
+		Span  lexer.Span      `@(Ident+)`
+		Value *lexer.Span     `@String?`
+	}
+
+	p := mustTestParser[ast](t)
+	actual, err := p.ParseString("", "123 hello\nworld")
+	require.NoError(t, err)
+	expected := &ast{
+		Kind: scanner.Int,
+		Span: lexer.Span{
+			Start: lexer.Position{Offset: 4, Line: 1, Column: 5},
+			End:   lexer.Position{Offset: 15, Line: 2, Column: 6},
+		},
+	}
+	require.Equal(t, expected, actual)
+	require.Equal(t, "1:5-2:6", actual.Span.String())
+}
+
+func TestCaptureTokenMetadataSlices(t *testing.T) {
+	type ast struct {
+		Kinds []lexer.TokenType `@(Ident | Int)*`
+		Spans []lexer.Span      `";" @(Ident | Int)*`
+	}
+
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Ident", `[a-z]+`},
+		{"Int", `\d+`},
+		{"Punct", `;`},
+		{"Whitespace", `\s+`},
+	})
+	p := mustTestParser[ast](t, participle.Lexer(def), participle.Elide("Whitespace"))
+	actual, err := p.ParseString("", "a 1  b; c 22")
+	require.NoError(t, err)
+	symbols := def.Symbols()
+	require.Equal(t, []lexer.TokenType{symbols["Ident"], symbols["Int"], symbols["Ident"]}, actual.Kinds)
+	spans := []string{}
+	for _, span := range actual.Spans {
+		spans = append(spans, span.String())
+	}
+	require.Equal(t, []string{"1:9-1:10", "1:11-1:13"}, spans)
+}
+
+func TestCaptureTokenMetadataElided(t *testing.T) {
+	type ast struct {
+		Name string          `@Ident`
+		Kind lexer.TokenType `@(Ident | Int)`
+		Span *lexer.Span     `@Ident`
+	}
+
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Ident", `[a-z]+`},
+		{"Int", `\d+`},
+		{"Whitespace", `\s+`},
+	})
+	p := mustTestParser[ast](t, participle.Lexer(def), participle.Elide("Whitespace"))
+	actual, err := p.ParseString("", "a   1   b")
+	require.NoError(t, err)
+	require.Equal(t, def.Symbols()["Int"], actual.Kind)
+	require.Equal(t, "1:9-1:10", actual.Span.String())
+}
+
+func TestSpanColumns(t *testing.T) {
+	type word struct {
+		EndPos lexer.Position
+		Span   lexer.Span `@String`
+	}
+	type ast struct {
+		Words []*word `@@*`
+	}
+
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"String", `"[^"]*"`},
+		{"Whitespace", `\s+`},
+	}, lexer.Columns(lexer.ColumnUTF16), lexer.TabWidth(4))
+	p := mustTestParser[ast](t, participle.Lexer(def), participle.Elide("Whitespace"), participle.TrimEndPos())
+	actual, err := p.ParseString("", "\t\"\U0001F600\"\t\"x\"")
+	require.NoError(t, err)
+	require.Equal(t, "1:5-1:9", actual.Words[0].Span.String())
+	require.Equal(t, 9, actual.Words[0].EndPos.Column)
+	require.Equal(t, "1:13-1:16", actual.Words[1].Span.String())
+}
+
 func TestEndPos(t *testing.T) {
 	type Ident struct {
 		Pos    lexer.Position
@@ -1415,6 +1757,36 @@ func TestEndPos(t *testing.T) {
 	require.Equal(t, 3, mod.First.EndPos.Offset)
 }
 
+func TestTrimEndPos(t *testing.T) {
+	type Ident struct {
+		Pos    lexer.Position
+		EndPos lexer.Position
+		Text   string `parser:"@Ident"`
+	}
+
+	type AST struct {
+		Idents []*Ident `parser:"@@*"`
+	}
+
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Ident", `\w+`},
+		{"Comment", `#[^\n]*`},
+		{"whitespace", `\s+`},
+	})
+	input := "foo  # comment\nbar "
+
+	p := mustTestParser[AST](t, participle.Lexer(def), participle.Elide("Comment"))
+	ast, err := p.ParseString("", input)
+	require.NoError(t, err)
+	require.Equal(t, 5, ast.Idents[0].EndPos.Offset)
+
+	p = mustTestParser[AST](t, participle.Lexer(def), participle.Elide("Comment"), participle.TrimEndPos())
+	ast, err = p.ParseString("", input)
+	require.NoError(t, err)
+	require.Equal(t, lexer.Position{Offset: 3, Line: 1, Column: 4}, ast.Idents[0].EndPos)
+	require.Equal(t, lexer.Position{Offset: 18, Line: 2, Column: 4}, ast.Idents[1].EndPos)
+}
+
 func TestBug(t *testing.T) {
 	type A struct {
 		Shared string `parser:"@'1'"`
@@ -1903,3 +2275,468 @@ func TestParseNumbers(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, grammar{Int: -30, Uint: 3000, Float: math.Inf(1)}, *result)
 }
+
+type predicateCall struct {
+	Name string   `@Ident "("`
+	Args []string `@Ident* ")"`
+}
+
+// Calls are only attempted if the next token is an identifier followed by "(",
+// and never for the reserved word "print".
+func (predicateCall) Predicate(lex *lexer.PeekingLexer) bool {
+	name := lex.Next()
+	return name.Value != "print" && lex.Peek().Value == "("
+}
+
+type predicatePrint struct {
+	Args []string `"print" @Ident*`
+}
+
+type predicateStatement struct {
+	Call  *predicateCall  `  @@`
+	Print *predicatePrint `| @@`
+	Ident string          `| @Ident`
+}
+
+func TestPredicate(t *testing.T) {
+	type grammar struct {
+		Statements []*predicateStatement `(@@ ";")*`
+	}
+	p := mustTestParser[grammar](t)
+	_, err := p.ParseString("", `print();`)
+	require.EqualError(t, err, `1:6: unexpected token "(" (expected ";")`)
+	actual, err := p.ParseString("", `f(a b); print a; x;`)
+	require.NoError(t, err)
+	expected := &grammar{Statements: []*predicateStatement{
+		{Call: &predicateCall{Name: "f", Args: []string{"a", "b"}}},
+		{Print: &predicatePrint{Args: []string{"a"}}},
+		{Ident: "x"},
+	}}
+	require.Equal(t, expected, actual)
+}
+
+type firstCounted struct {
+	Value string `"b" @Ident`
+}
+
+var firstCountedAttempts int
+
+func (firstCounted) Predicate(lex *lexer.PeekingLexer) bool {
+	firstCountedAttempts++
+	return true
+}
+
+func TestFirstSetsSkipAlternatives(t *testing.T) {
+	type item struct {
+		Counted *firstCounted `  @@`
+		Other   string        `| "a" @Ident`
+	}
+	type grammar struct {
+		Items []item `@@*`
+	}
+	p := mustTestParser[grammar](t)
+	firstCountedAttempts = 0
+	actual, err := p.ParseString("", `a x a y b z`)
+	require.NoError(t, err)
+	require.Equal(t, &grammar{Items: []item{{Other: "x"}, {Other: "y"}, {Counted: &firstCounted{"z"}}}}, actual)
+	// The struct is only attempted where the next token is "b".
+	require.Equal(t, 1, firstCountedAttempts)
+}
+
+type parsedRange struct {
+	Low  int `@Int ":"`
+	High int `@Int`
+	Size int
+}
+
+func (r *parsedRange) OnParsed(lex *lexer.PeekingLexer) error {
+	if r.High < r.Low {
+		return fmt.Errorf("range %d:%d is empty", r.Low, r.High)
+	}
+	r.Size = r.High - r.Low + 1
+	return nil
+}
+
+func TestParsedHook(t *testing.T) {
+	type grammar struct {
+		Ranges []*parsedRange `@@ ("," @@)*`
+	}
+	p := mustTestParser[grammar](t)
+	actual, err := p.ParseString("", `1:3, 5:5`)
+	require.NoError(t, err)
+	require.Equal(t, &grammar{Ranges: []*parsedRange{{1, 3, 3}, {5, 5, 1}}}, actual)
+
+	_, err = p.ParseString("", `1:3, 5:4`)
+	require.EqualError(t, err, `1:6: range 5:4 is empty`)
+	require.Equal(t, lexer.Span{
+		Start: lexer.Position{Offset: 5, Line: 1, Column: 6},
+		End:   lexer.Position{Offset: 8, Line: 1, Column: 9},
+	}, participle.ErrorRange(err))
+}
+
+type genericComma struct {
+	Sep string `@","`
+}
+
+type genericSemicolon struct {
+	Sep string `@";"`
+}
+
+type genericIdent struct {
+	Name string `@Ident`
+}
+
+type genericSeparated[T, S any] struct {
+	Sep  S `@@`
+	Item T `@@`
+}
+
+// A non-empty list of T separated by S.
+type genericList[T, S any] struct {
+	Head T                        `@@`
+	Tail []genericSeparated[T, S] `@@*`
+}
+
+func TestGenericProductions(t *testing.T) {
+	type grammar struct {
+		Args  genericList[genericIdent, genericComma]     `"(" @@ ")"`
+		Stmts genericList[genericIdent, genericSemicolon] `"{" @@ "}"`
+	}
+	p := mustTestParser[grammar](t)
+	actual, err := p.ParseString("", `(a, b) {c; d}`)
+	require.NoError(t, err)
+	expected := &grammar{
+		Args: genericList[genericIdent, genericComma]{
+			Head: genericIdent{"a"},
+			Tail: []genericSeparated[genericIdent, genericComma]{{genericComma{","}, genericIdent{"b"}}},
+		},
+		Stmts: genericList[genericIdent, genericSemicolon]{
+			Head: genericIdent{"c"},
+			Tail: []genericSeparated[genericIdent, genericSemicolon]{{genericSemicolon{";"}, genericIdent{"d"}}},
+		},
+	}
+	require.Equal(t, expected, actual)
+
+	_, err = p.ParseString("", `(a; b) {}`)
+	require.EqualError(t, err, `1:3: unexpected token ";" (expected ")" "{" GenericList[genericIdent,genericSemicolon] "}")`)
+
+	require.Equal(t, `Grammar = "(" GenericList[genericIdent,genericComma] ")" "{" GenericList[genericIdent,genericSemicolon] "}" .
+GenericList[genericIdent,genericComma] = GenericIdent GenericSeparated[genericIdent,genericComma]* .
+GenericIdent = <ident> .
+GenericSeparated[genericIdent,genericComma] = GenericComma GenericIdent .
+GenericComma = "," .
+GenericList[genericIdent,genericSemicolon] = GenericIdent GenericSeparated[genericIdent,genericSemicolon]* .
+GenericSeparated[genericIdent,genericSemicolon] = GenericSemicolon GenericIdent .
+GenericSemicolon = ";" .`, p.String())
+}
+
+func TestRecover(t *testing.T) {
+	type statement struct {
+		Key   string `@Ident "="`
+		Value int    `@Int ";"`
+	}
+	type block struct {
+		Name       string       `@Ident "{"`
+		Statements []*statement `@@* "}"`
+	}
+	type grammar struct {
+		Blocks []*block `@@*`
+	}
+	p := mustTestParser[grammar](t)
+	input := `
+		a {
+			x = 1;
+			y = ;
+			z = 3;
+		}
+		b {
+			w = "str";
+		}
+	`
+	_, err := p.ParseString("", input)
+	require.EqualError(t, err, `4:8: unexpected token ";" (expected <int> ";")`)
+
+	actual, err := p.ParseString("", input, participle.Recover(";", "}"))
+	var errs participle.Errors
+	require.True(t, errors.As(err, &errs))
+	require.Equal(t, 2, len(errs))
+	require.EqualError(t, err, `4:8: unexpected token ";" (expected <int> ";")
+8:8: unexpected token "\"str\"" (expected <int> ";")`)
+	require.Equal(t, &grammar{Blocks: []*block{
+		{Name: "a", Statements: []*statement{{Key: "x", Value: 1}, {Key: "y"}, {Key: "z", Value: 3}}},
+		{Name: "b", Statements: []*statement{{Key: "w"}}},
+	}}, actual)
+}
+
+func TestMaxErrors(t *testing.T) {
+	type statement struct {
+		Key   string `@Ident "="`
+		Value int    `@Int ";"`
+	}
+	type grammar struct {
+		Statements []*statement `@@*`
+	}
+	p := mustTestParser[grammar](t)
+	input := `a = ; b = ; c = ; d = 4;`
+
+	_, err := p.ParseString("", input, participle.Recover(";"))
+	var errs participle.Errors
+	require.True(t, errors.As(err, &errs))
+	require.Equal(t, 3, len(errs))
+
+	_, err = p.ParseString("", input, participle.Recover(";"), participle.MaxErrors(2))
+	require.EqualError(t, err, `1:5: unexpected token ";" (expected <int> ";")
+1:11: unexpected token ";" (expected <int> ";")`)
+}
+
+func TestRecoverDirective(t *testing.T) {
+	type statement struct {
+		Key   string `@Ident "=" recover(";")`
+		Value int    `@Int ";"`
+	}
+	type block struct {
+		Name       string       `@Ident "{" recover("}")`
+		Statements []*statement `@@* "}"`
+	}
+	type grammar struct {
+		Blocks []*block `@@*`
+	}
+	p := mustTestParser[grammar](t)
+	require.Equal(t, `Grammar = Block* .
+Block = <ident> "{" Statement* "}" .
+Statement = <ident> "=" <int> ";" .`, p.String())
+	input := `
+		a {
+			x = 1;
+			y = "str";
+			z = 3;
+		}
+		b {
+			w 2;
+			v = 4;
+		}
+		c {}
+	`
+	// Without Recover(), directives have no effect.
+	_, err := p.ParseString("", input)
+	require.EqualError(t, err, `4:8: unexpected token "\"str\"" (expected <int> ";")`)
+
+	actual, err := p.ParseString("", input, participle.Recover())
+	require.EqualError(t, err, `4:8: unexpected token "\"str\"" (expected <int> ";")
+8:6: unexpected token "2" (expected "=" <int> ";")`)
+	require.Equal(t, &grammar{Blocks: []*block{
+		{Name: "a", Statements: []*statement{{Key: "x", Value: 1}, {Key: "y"}, {Key: "z", Value: 3}}},
+		{Name: "b"},
+		{Name: "c"},
+	}}, actual)
+}
+
+func TestParseContext(t *testing.T) {
+	type grammar struct {
+		Idents []string `(@Ident | @Int)*`
+	}
+	p := mustTestParser[grammar](t)
+	actual, err := p.ParseStringContext(context.Background(), "", "a 1 b")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "1", "b"}, actual.Idents)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = p.ParseStringContext(ctx, "", "a 1 b")
+	require.EqualError(t, err, `1:1: parse aborted: context canceled`)
+	require.Equal(t, participle.CodeAborted, participle.ErrorCodeOf(err))
+	require.True(t, errors.Is(err, context.Canceled))
+
+	_, err = p.ParseBytesContext(ctx, "", []byte("a"), participle.Recover(";"))
+	require.True(t, errors.Is(err, context.Canceled))
+	_, err = p.ParseContext(ctx, "", strings.NewReader("a"))
+	require.True(t, errors.Is(err, context.Canceled))
+}
+
+type maxRecursionExpr struct {
+	Ident string            `  @Ident`
+	Group *maxRecursionExpr `| "(" @@ ")"`
+}
+
+func TestMaxRecursion(t *testing.T) {
+	p := mustTestParser[maxRecursionExpr](t, participle.MaxRecursion(10))
+	actual, err := p.ParseString("", "((a))")
+	require.NoError(t, err)
+	require.Equal(t, "a", actual.Group.Group.Ident)
+
+	_, err = p.ParseString("", strings.Repeat("(", 20)+"a"+strings.Repeat(")", 20))
+	require.EqualError(t, err, `1:11: maximum recursion depth of 10 exceeded`)
+	require.Equal(t, participle.CodeMaxRecursion, participle.ErrorCodeOf(err))
+	var perr *participle.ParseError
+	require.True(t, errors.As(err, &perr))
+}
+
+func TestBoundedRepetition(t *testing.T) {
+	type grammar struct {
+		Octets    []string `@Int (":" @Int){3}`
+		Modifiers []string `"[" @Ident{0,2} "]"`
+		Rest      []string `@Ident{1,}`
+	}
+	p := mustTestParser[grammar](t)
+	require.Equal(t, `Grammar = <int> (":" <int>){3} "[" <ident>{0,2} "]" <ident>{1,} .`, p.String())
+
+	actual, err := p.ParseString("", "10:0:0:1 [a b] c d")
+	require.NoError(t, err)
+	require.Equal(t, &grammar{
+		Octets:    []string{"10", "0", "0", "1"},
+		Modifiers: []string{"a", "b"},
+		Rest:      []string{"c", "d"},
+	}, actual)
+
+	_, err = p.ParseString("", "10:0:1 [] c")
+	require.EqualError(t, err, `1:8: sub-expression (":" <int>){3} must match at least 3 times`)
+	_, err = p.ParseString("", "10:0:0:1 [a b c] d")
+	require.EqualError(t, err, `1:15: unexpected token "c" (expected "]" <ident>{1,})`)
+	_, err = p.ParseString("", "10:0:0:1 []")
+	require.EqualError(t, err, `1:12: sub-expression <ident>{1,} must match at least once`)
+}
+
+func TestBoundedRepetitionInvalid(t *testing.T) {
+	type grammar struct {
+		A []string `@Ident{2,1}`
+	}
+	_, err := participle.Build[grammar]()
+	require.EqualError(t, err, `A: invalid repetition bounds {2,1}`)
+
+	type tooMany struct {
+		A []string `@Ident{0,1000000}`
+	}
+	_, err = participle.Build[tooMany]()
+	require.EqualError(t, err, `A: invalid repetition bound "1000000"`)
+}
+
+func TestBoundedRepetitionFollowedByRepetition(t *testing.T) {
+	type grammar struct {
+		A []string `@Ident { @Int }`
+	}
+	p := mustTestParser[grammar](t)
+	actual, err := p.ParseString("", "a 1 2")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "1", "2"}, actual.A)
+}
+
+func TestAnonymousStructs(t *testing.T) {
+	type grammar struct {
+		Pairs []struct {
+			Key   string `@Ident "="`
+			Value *struct {
+				Int    *int    `  @Int`
+				String *string `| @String`
+			} `@@`
+		} `@@*`
+	}
+	p := mustTestParser[grammar](t)
+	require.Equal(t, strings.TrimSpace(`
+Grammar = GrammarPairs* .
+GrammarPairs = <ident> "=" GrammarPairsValue .
+GrammarPairsValue = <int> | <string> .
+`), p.String())
+	actual, err := p.ParseString("", `a = 1 b = "two"`)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(actual.Pairs))
+	require.Equal(t, "a", actual.Pairs[0].Key)
+	require.Equal(t, 1, *actual.Pairs[0].Value.Int)
+	require.Equal(t, `"two"`, *actual.Pairs[1].Value.String)
+}
+
+type registeredStmt interface{ stmt() }
+
+type registeredPrint struct {
+	Value string `"print" @String`
+}
+
+func (registeredPrint) stmt() {}
+
+type registeredPluginStmt struct {
+	Name string `"plugin" @Ident`
+}
+
+func (registeredPluginStmt) stmt() {}
+
+func TestRegisterUnionMembers(t *testing.T) {
+	type grammar struct {
+		Stmts []registeredStmt `@@*`
+	}
+	participle.RegisterUnionMembers[registeredStmt](registeredPluginStmt{}, registeredPrint{})
+	p := mustTestParser[grammar](t, participle.Union[registeredStmt](registeredPrint{}))
+	require.Equal(t, strings.TrimSpace(`
+Grammar = RegisteredStmt* .
+RegisteredStmt = RegisteredPrint | RegisteredPluginStmt .
+RegisteredPrint = "print" <string> .
+RegisteredPluginStmt = "plugin" <ident> .
+`), p.String())
+	actual, err := p.ParseString("", `print "a" plugin b`)
+	require.NoError(t, err)
+	require.Equal(t, &grammar{Stmts: []registeredStmt{
+		registeredPrint{Value: `"a"`},
+		registeredPluginStmt{Name: "b"},
+	}}, actual)
+}
+
+func TestAdjacent(t *testing.T) {
+	type flag struct {
+		Name  string `"-" ^"-" ^@Ident`
+		Value string `(^"=" ^@Ident)?`
+	}
+	type grammar struct {
+		Flags []flag   `@@*`
+		Args  []string `@Ident*`
+	}
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Ident", `\w+`},
+		{"Punct", `[-=]`},
+		{"Whitespace", `\s+`},
+	})
+	p := mustTestParser[grammar](t, participle.Lexer(def), participle.Elide("Whitespace"))
+	require.Equal(t, `Grammar = Flag* <ident>* .
+Flag = "-" ^"-" ^<ident> (^"=" ^<ident>)? .`, p.String())
+	actual, err := p.ParseString("", "--a=b --c d")
+	require.NoError(t, err)
+	require.Equal(t, &grammar{
+		Flags: []flag{{Name: "a", Value: "b"}, {Name: "c"}},
+		Args:  []string{"d"},
+	}, actual)
+
+	_, err = p.ParseString("", "- -a")
+	require.EqualError(t, err, `1:3: unexpected token "-" (expected ^"-" ^<ident> (^"=" ^<ident>)?)`)
+	_, err = p.ParseString("", "--a =b")
+	require.EqualError(t, err, `1:5: unexpected token "="`)
+}
+
+func TestDetectAmbiguity(t *testing.T) {
+	type value struct {
+		Ident   string `  @Ident`
+		Call    string `| @Ident "(" ")"`
+		Number  int    `| @Int`
+		Keyword string `| @"true"`
+	}
+	type grammar struct {
+		Values []*value `@@*`
+	}
+	p := mustTestParser[grammar](t)
+
+	var ambiguities []participle.Ambiguity
+	_, err := p.ParseString("", `a 1 true`, participle.DetectAmbiguity(&ambiguities))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`1:5: ambiguous alternatives <ident>, "true"`,
+	}, ambiguityStrings(ambiguities))
+
+	ambiguities = nil
+	_, err = p.ParseString("", `1 2`, participle.DetectAmbiguity(&ambiguities))
+	require.NoError(t, err)
+	require.Zero(t, ambiguities)
+}
+
+func ambiguityStrings(ambiguities []participle.Ambiguity) []string {
+	out := make([]string, 0, len(ambiguities))
+	for _, ambiguity := range ambiguities {
+		out = append(out, ambiguity.String())
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+package participle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiDim   = "\x1b[2m"
+	ansiRed   = "\x1b[31m"
+)
+
+// PrintError writes "err" to "w", one line per error for Errors, in the form
+// of FormatError.
+//
+// If "w" is a terminal and the NO_COLOR environment variable is not set, errors
+// are highlighted as by FormatErrorColor.
+func PrintError(w io.Writer, err error) error {
+	color := isTerminal(w) && os.Getenv("NO_COLOR") == ""
+	var errs Errors
+	if !errors.As(err, &errs) {
+		errs = Errors{err}
+	}
+	for _, err := range errs {
+		msg := err.Error()
+		if perr, ok := err.(Error); ok && color {
+			msg = FormatErrorColor(perr)
+		}
+		if _, err := fmt.Fprintln(w, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FormatErrorColor formats an error like FormatError, highlighted with ANSI
+// escape codes: the position is dimmed and, for an UnexpectedTokenError, the
+// unexpected token is red and the expected tokens are bold.
+func FormatErrorColor(err Error) string {
+	msg := ""
+	if prefix := positionPrefix(err.Position()); prefix != "" {
+		msg = ansiDim + prefix + ansiReset + " "
+	}
+	u, ok := err.(*UnexpectedTokenError)
+	if !ok {
+		return msg + err.Message()
+	}
+	msg += "unexpected token " + ansiRed + fmt.Sprintf("%q", u.Unexpected) + ansiReset
+	if expected := u.expectation(); expected != "" {
+		msg += " (expected " + ansiBold + expected + ansiReset + ")"
+	}
+	return msg
+}
+
+// Reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
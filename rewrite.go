@@ -0,0 +1,286 @@
+package participle
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+var tokenSize = reflect.TypeOf(lexer.Token{}).Size()
+
+// ReplaceNode replaces the node "old" in the AST "root" with "node", eg. as
+// parsed from a snippet of source, and updates the `Tokens []lexer.Token`
+// fields of the AST to match.
+//
+// Unparse(root) then reproduces the original source with the tokens of "old"
+// replaced by those of "node". The elided tokens preceding "old", such as
+// whitespace and comments, are preserved, while those preceding "node" are
+// discarded. All three nodes must have a Tokens
+// field, "old" must be held by a pointer or interface field or slice element,
+// and Pos and EndPos fields are not updated.
+func (p *Parser[G]) ReplaceNode(root *G, old, node any) error {
+	return rewriteNode(p.walkFields, root, old, node, true, func(r, inserted *rewrite) (int, int, error) {
+		if err := r.holder.set(reflect.ValueOf(node)); err != nil {
+			return 0, 0, err
+		}
+		// Keep the elided tokens preceding "old" in place of those preceding "node".
+		inserted.from = p.skipElided(inserted.base, 0, len(inserted.base))
+		inserted.prefix = r.base[r.target.start:p.skipElided(r.base, r.target.start, r.target.end)]
+		return r.target.start, r.target.end, nil
+	})
+}
+
+// InsertNodeBefore inserts "node" into the AST "root" before "sibling", which
+// must be held by a slice, and updates the `Tokens []lexer.Token` fields of
+// the AST to match.
+//
+// The tokens of "node" are inserted before the elided tokens preceding
+// "sibling", so eg. a comment documenting "sibling" remains attached to it.
+// See ReplaceNode for details.
+func (p *Parser[G]) InsertNodeBefore(root *G, sibling, node any) error {
+	return rewriteNode(p.walkFields, root, sibling, node, false, func(r, inserted *rewrite) (int, int, error) {
+		if err := r.holder.insert(0, reflect.ValueOf(node)); err != nil {
+			return 0, 0, err
+		}
+		return r.target.start, r.target.start, nil
+	})
+}
+
+// InsertNodeAfter inserts "node" into the AST "root" after "sibling", which
+// must be held by a slice, and updates the `Tokens []lexer.Token` fields of
+// the AST to match. See ReplaceNode for details.
+func (p *Parser[G]) InsertNodeAfter(root *G, sibling, node any) error {
+	return rewriteNode(p.walkFields, root, sibling, node, false, func(r, inserted *rewrite) (int, int, error) {
+		if err := r.holder.insert(1, reflect.ValueOf(node)); err != nil {
+			return 0, 0, err
+		}
+		return r.target.end, r.target.end, nil
+	})
+}
+
+// Return the index of the first token in tokens[start:end] that is not elided, or end.
+func (p *Parser[G]) skipElided(tokens []lexer.Token, start, end int) int {
+	elided := map[lexer.TokenType]bool{}
+	for _, typ := range p.getElidedTypes() {
+		elided[typ] = true
+	}
+	for start < end && elided[tokens[start].Type] {
+		start++
+	}
+	return start
+}
+
+// Locate "target" in "root", apply "edit" to the AST, then splice the tokens
+// of "node" into the tokens of the root over the range returned by "edit".
+func rewriteNode(fields map[reflect.Type][][]int, root, target, node any, replace bool, edit func(r, inserted *rewrite) (start, end int, err error)) error {
+	rootValue, err := nodePointer(root)
+	if err != nil {
+		return err
+	}
+	targetValue, err := nodePointer(target)
+	if err != nil {
+		return err
+	}
+	nodeValue, err := nodePointer(node)
+	if err != nil {
+		return err
+	}
+	if targetValue.Pointer() == rootValue.Pointer() {
+		return fmt.Errorf("cannot rewrite the root node")
+	}
+	r, err := newRewrite(fields, rootValue, targetValue)
+	if err != nil {
+		return err
+	}
+	r.replace = replace
+	r.visit(rootValue, nodeHolder{})
+	if r.target == nil {
+		return fmt.Errorf("%s is not a node of %s with tokens", targetValue.Type(), rootValue.Type())
+	}
+	inserted, err := newRewrite(fields, nodeValue, reflect.Value{})
+	if err != nil {
+		return err
+	}
+	inserted.visit(nodeValue, nodeHolder{})
+	start, end, err := edit(r, inserted)
+	if err != nil {
+		return err
+	}
+	r.splice(start, end, inserted)
+	return nil
+}
+
+func nodePointer(node any) (reflect.Value, error) {
+	v := reflect.ValueOf(node)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("expected a non-nil pointer to a struct but got %T", node)
+	}
+	return v, nil
+}
+
+// An in-progress rewrite of the AST rooted at a node.
+type rewrite struct {
+	fields      map[reflect.Type][][]int // The `@@` fields of each struct.
+	base        []lexer.Token            // The tokens of the root node.
+	targetValue reflect.Value
+	target      *rewriteSpan
+	holder      nodeHolder // The location of the target node.
+	replace     bool       // Whether the target is being replaced.
+	spans       []*rewriteSpan
+	// When splicing the tokens of the root into another AST, the index of the
+	// first token to splice and the tokens to splice before it.
+	from   int
+	prefix []lexer.Token
+}
+
+// The extent of a node within the tokens of the root node.
+type rewriteSpan struct {
+	tokens     reflect.Value // The Tokens field of the node.
+	start, end int
+	ancestor   bool // Of the target node.
+}
+
+func newRewrite(fields map[reflect.Type][][]int, root, target reflect.Value) (*rewrite, error) {
+	base, err := nodeTokens(root.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return &rewrite{fields: fields, base: base, targetValue: target}, nil
+}
+
+// Collect the spans of the nodes under "v", returning true if it contains the target node.
+func (r *rewrite) visit(v reflect.Value, holder nodeHolder) bool {
+	switch v.Kind() {
+	case reflect.Interface:
+		return !v.IsNil() && r.visit(v.Elem(), holder)
+	case reflect.Slice, reflect.Array:
+		found := false
+		for i := 0; i < v.Len(); i++ {
+			if r.visit(v.Index(i), nodeHolder{value: v.Index(i), slice: v, index: i}) {
+				found = true
+			}
+		}
+		return found
+	case reflect.Ptr:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct {
+			return false
+		}
+	case reflect.Struct:
+		v = v.Addr()
+	default:
+		return false
+	}
+	span := r.span(v)
+	isTarget := r.targetValue.IsValid() && v.Pointer() == r.targetValue.Pointer() && v.Type() == r.targetValue.Type()
+	if isTarget {
+		r.target, r.holder = span, holder
+		if r.replace {
+			// The target and its descendants are removed from the AST.
+			return true
+		}
+	}
+	contains := false
+	strct := v.Elem()
+	for _, index := range r.fields[strct.Type()] {
+		field, err := strct.FieldByIndexErr(index)
+		if err != nil { // Nil embedded pointer.
+			continue
+		}
+		if r.visit(field, nodeHolder{value: field}) {
+			contains = true
+		}
+	}
+	if span != nil {
+		span.ancestor = contains
+		r.spans = append(r.spans, span)
+	}
+	return isTarget || contains
+}
+
+// Return the extent of the Tokens of "node" within the tokens of the root, or nil.
+func (r *rewrite) span(node reflect.Value) *rewriteSpan {
+	field, ok := node.Elem().Type().FieldByName("Tokens")
+	if !ok || field.Type != tokensType {
+		return nil
+	}
+	tokens := node.Elem().FieldByIndex(field.Index)
+	if tokens.Len() == 0 || len(r.base) == 0 {
+		return nil
+	}
+	base, ptr := reflect.ValueOf(r.base).Pointer(), tokens.Pointer()
+	if ptr < base || (ptr-base)%tokenSize != 0 {
+		return nil
+	}
+	start := int((ptr - base) / tokenSize)
+	end := start + tokens.Len()
+	if end > len(r.base) {
+		return nil
+	}
+	return &rewriteSpan{tokens: tokens, start: start, end: end}
+}
+
+// Replace the root tokens in the range [start, end) with those of the root of
+// "inserted", and update the Tokens of all nodes to match.
+func (r *rewrite) splice(start, end int, inserted *rewrite) {
+	tokens := append(inserted.prefix[:len(inserted.prefix):len(inserted.prefix)], inserted.base[inserted.from:]...)
+	out := make([]lexer.Token, 0, len(r.base)-(end-start)+len(tokens))
+	out = append(out, r.base[:start]...)
+	out = append(out, tokens...)
+	out = append(out, r.base[end:]...)
+	delta := len(tokens) - (end - start)
+	for _, span := range r.spans {
+		switch {
+		case span.ancestor:
+			span.end += delta
+		case span.start >= end:
+			span.start += delta
+			span.end += delta
+		}
+		span.tokens.Set(reflect.ValueOf(out[span.start:span.end]))
+	}
+	// Nodes starting at the first spliced token also include the prefix.
+	offset := start + len(inserted.prefix) - inserted.from
+	for _, span := range inserted.spans {
+		from, to := span.start+offset, span.end+offset
+		if span.start <= inserted.from {
+			from = start
+		}
+		span.tokens.Set(reflect.ValueOf(out[from:to]))
+	}
+}
+
+// The location of a node within its parent.
+type nodeHolder struct {
+	value reflect.Value // The field or slice element holding the node.
+	slice reflect.Value // The slice holding the node, if any.
+	index int
+}
+
+func (h nodeHolder) set(node reflect.Value) error {
+	if !h.value.CanSet() || h.value.Kind() == reflect.Struct {
+		return fmt.Errorf("node must be held by a pointer or interface field or slice element")
+	}
+	if !node.Type().AssignableTo(h.value.Type()) {
+		return fmt.Errorf("cannot replace %s with %s", h.value.Type(), node.Type())
+	}
+	h.value.Set(node)
+	return nil
+}
+
+// Insert "node" into the slice holding the node, "offset" elements after it.
+func (h nodeHolder) insert(offset int, node reflect.Value) error {
+	if !h.slice.IsValid() || h.slice.Kind() != reflect.Slice || !h.slice.CanSet() {
+		return fmt.Errorf("node must be held by a slice")
+	}
+	if !node.Type().AssignableTo(h.slice.Type().Elem()) {
+		return fmt.Errorf("cannot insert %s into %s", node.Type(), h.slice.Type())
+	}
+	i := h.index + offset
+	out := reflect.MakeSlice(h.slice.Type(), 0, h.slice.Len()+1)
+	out = reflect.AppendSlice(out, h.slice.Slice(0, i))
+	out = reflect.Append(out, node)
+	out = reflect.AppendSlice(out, h.slice.Slice(i, h.slice.Len()))
+	h.slice.Set(out)
+	return nil
+}
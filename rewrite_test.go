@@ -0,0 +1,100 @@
+package participle_test
+
+import (
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+type rewriteValue struct {
+	Tokens []lexer.Token
+
+	Ident string `@Ident`
+}
+
+type rewriteAssignment struct {
+	Tokens []lexer.Token
+
+	Name  string        `@Ident "="`
+	Value *rewriteValue `@@ ";"`
+}
+
+type rewriteProgram struct {
+	Tokens []lexer.Token
+
+	Assignments []*rewriteAssignment `@@*`
+}
+
+const rewriteSource = "// Header.\na = b;\n\n// Doc for c.\nc = d; // Trailing.\n"
+
+func newRewriteParser(t *testing.T) *participle.Parser[rewriteProgram] {
+	t.Helper()
+	return mustTestParser[rewriteProgram](t,
+		participle.Elide("Whitespace", "Comment"),
+		participle.Lexer(lexer.MustSimple([]lexer.SimpleRule{
+			{"Comment", `//[^\n]*`},
+			{"Ident", `\w+`},
+			{"Punct", `[=;]`},
+			{"Whitespace", `\s+`},
+		})))
+}
+
+func parseRewriteSnippet(t *testing.T, p *participle.Parser[rewriteProgram], source string) *rewriteAssignment {
+	t.Helper()
+	snippet, err := p.ParseString("", source)
+	require.NoError(t, err)
+	return snippet.Assignments[0]
+}
+
+func TestReplaceNode(t *testing.T) {
+	p := newRewriteParser(t)
+	ast, err := p.ParseString("", rewriteSource)
+	require.NoError(t, err)
+
+	replacement := parseRewriteSnippet(t, p, "  c = e;\n")
+	err = p.ReplaceNode(ast, ast.Assignments[1], replacement)
+	require.NoError(t, err)
+	require.Equal(t, "// Header.\na = b;\n\n// Doc for c.\nc = e; // Trailing.\n", unparse(t, ast))
+	require.True(t, replacement == ast.Assignments[1])
+	require.Equal(t, "\n\n// Doc for c.\nc = e;", unparse(t, ast.Assignments[1]))
+	require.Equal(t, " e", unparse(t, ast.Assignments[1].Value))
+
+	// Nodes are rewritten in place, so earlier edits are retained.
+	value := parseRewriteSnippet(t, p, "x = long_name;").Value
+	err = p.ReplaceNode(ast, ast.Assignments[0].Value, value)
+	require.NoError(t, err)
+	require.Equal(t, "// Header.\na = long_name;\n\n// Doc for c.\nc = e; // Trailing.\n", unparse(t, ast))
+	require.Equal(t, "\n\n// Doc for c.\nc = e;", unparse(t, ast.Assignments[1]))
+
+	err = p.ReplaceNode(ast, ast, replacement)
+	require.EqualError(t, err, "cannot rewrite the root node")
+	err = p.ReplaceNode(ast, &rewriteValue{}, value)
+	require.EqualError(t, err, "*participle_test.rewriteValue is not a node of *participle_test.rewriteProgram with tokens")
+	err = p.ReplaceNode(ast, ast.Assignments[0], value)
+	require.EqualError(t, err, "cannot replace *participle_test.rewriteAssignment with *participle_test.rewriteValue")
+}
+
+func TestInsertNode(t *testing.T) {
+	p := newRewriteParser(t)
+	ast, err := p.ParseString("", rewriteSource)
+	require.NoError(t, err)
+
+	err = p.InsertNodeBefore(ast, ast.Assignments[1], parseRewriteSnippet(t, p, "\nx = y;"))
+	require.NoError(t, err)
+	err = p.InsertNodeAfter(ast, ast.Assignments[2], parseRewriteSnippet(t, p, "\nz = w;"))
+	require.NoError(t, err)
+	require.Equal(t, "// Header.\na = b;\nx = y;\n\n// Doc for c.\nc = d;\nz = w; // Trailing.\n", unparse(t, ast))
+
+	names := []string{}
+	for _, assignment := range ast.Assignments {
+		names = append(names, assignment.Name)
+	}
+	require.Equal(t, []string{"a", "x", "c", "z"}, names)
+	require.Equal(t, "\n\n// Doc for c.\nc = d;", unparse(t, ast.Assignments[2]))
+	require.Equal(t, " d", unparse(t, ast.Assignments[2].Value))
+
+	err = p.InsertNodeAfter(ast, ast.Assignments[0].Value, parseRewriteSnippet(t, p, "a = b;"))
+	require.EqualError(t, err, "node must be held by a slice")
+}
@@ -0,0 +1,233 @@
+package participle
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// RuleNode is a node in the tree produced by parsers built with Rules().
+type RuleNode struct {
+	Rule string
+	Pos  lexer.Position
+	// Children are the values of matched tokens as strings, and the *RuleNode of matched rules.
+	Children []any
+}
+
+var ruleNodeType = reflect.TypeOf(RuleNode{})
+
+// Expr is an expression in a grammar constructed programmatically.
+//
+// Expressions are created with Literal, Token, Seq, OneOf, Optional,
+// ZeroOrMore, OneOrMore and Not, and a *RuleBuilder is an expression that
+// matches its rule.
+type Expr interface {
+	build(g *ruleGenerator) (node, error)
+}
+
+// RuleBuilder constructs a named production of a grammar without struct tags.
+//
+// This is useful when the grammar is computed, eg. generated from a schema,
+// rather than hand-written. For example the following:
+//
+//	value := participle.Rule("Value")
+//	value.Seq(participle.Token("Int")).
+//		Alt(participle.Literal("["), participle.ZeroOrMore(value), participle.Literal("]"))
+//
+// is equivalent to the EBNF:
+//
+//	Value = <int> | "[" Value* "]" .
+//
+// Left recursive rules are not supported, and are rejected when the parser is built.
+type RuleBuilder struct {
+	name         string
+	alternatives [][]Expr
+}
+
+// Rule starts a new named rule.
+func Rule(name string) *RuleBuilder {
+	return &RuleBuilder{name: name, alternatives: [][]Expr{nil}}
+}
+
+// Seq appends a sequence of expressions to the rule's current alternative.
+func (r *RuleBuilder) Seq(exprs ...Expr) *RuleBuilder {
+	last := len(r.alternatives) - 1
+	r.alternatives[last] = append(r.alternatives[last], exprs...)
+	return r
+}
+
+// Alt starts a new alternative for the rule consisting of a sequence of expressions.
+func (r *RuleBuilder) Alt(exprs ...Expr) *RuleBuilder {
+	if len(r.alternatives[len(r.alternatives)-1]) == 0 {
+		return r.Seq(exprs...)
+	}
+	r.alternatives = append(r.alternatives, exprs)
+	return r
+}
+
+func (r *RuleBuilder) build(g *ruleGenerator) (node, error) {
+	if n, ok := g.rules[r]; ok {
+		return n, nil
+	}
+	out := &rule{name: r.name}
+	g.rules[r] = out
+	alternatives := make([]Expr, 0, len(r.alternatives))
+	for _, alternative := range r.alternatives {
+		alternatives = append(alternatives, Seq(alternative...))
+	}
+	expr, err := OneOf(alternatives...).build(g)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", r.name, err)
+	}
+	out.expr = expr
+	return out, nil
+}
+
+type exprFunc func(g *ruleGenerator) (node, error)
+
+func (e exprFunc) build(g *ruleGenerator) (node, error) { return e(g) }
+
+// Literal matches a token with the value "s".
+func Literal(s string) Expr {
+	return exprFunc(func(g *ruleGenerator) (node, error) {
+		return &literal{s: s, t: -1}, nil
+	})
+}
+
+// Token matches a token of the lexer symbol "typ".
+func Token(typ string) Expr {
+	return exprFunc(func(g *ruleGenerator) (node, error) {
+		tt, ok := g.Symbols()[typ]
+		if !ok {
+			return nil, fmt.Errorf("unknown token type %q", typ)
+		}
+		return &reference{typ: tt, identifier: typ}, nil
+	})
+}
+
+// Seq matches a sequence of expressions.
+func Seq(exprs ...Expr) Expr {
+	return exprFunc(func(g *ruleGenerator) (node, error) {
+		if len(exprs) == 0 {
+			return nil, fmt.Errorf("sequence cannot be empty")
+		}
+		head := &sequence{head: true}
+		cursor := head
+		for i, expr := range exprs {
+			n, err := expr.build(g)
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				cursor.node = n
+			} else {
+				cursor.next = &sequence{node: n}
+				cursor = cursor.next
+			}
+		}
+		if head.next == nil {
+			return head.node, nil
+		}
+		return head, nil
+	})
+}
+
+// OneOf matches the first of several alternative expressions to match.
+func OneOf(alternatives ...Expr) Expr {
+	return exprFunc(func(g *ruleGenerator) (node, error) {
+		out := &disjunction{}
+		for i, alternative := range alternatives {
+			n, err := alternative.build(g)
+			if err != nil && len(alternatives) > 1 {
+				return nil, fmt.Errorf("alternative %d: %w", i+1, err)
+			} else if err != nil {
+				return nil, err
+			}
+			out.nodes = append(out.nodes, n)
+		}
+		switch len(out.nodes) {
+		case 0:
+			return nil, fmt.Errorf("alternatives cannot be empty")
+		case 1:
+			return out.nodes[0], nil
+		}
+		return out, nil
+	})
+}
+
+// Optional matches a sequence of expressions zero or one times.
+func Optional(exprs ...Expr) Expr { return repeat(groupMatchZeroOrOne, exprs) }
+
+// ZeroOrMore matches a sequence of expressions zero or more times.
+func ZeroOrMore(exprs ...Expr) Expr { return repeat(groupMatchZeroOrMore, exprs) }
+
+// OneOrMore matches a sequence of expressions one or more times.
+func OneOrMore(exprs ...Expr) Expr { return repeat(groupMatchOneOrMore, exprs) }
+
+func repeat(mode groupMatchMode, exprs []Expr) Expr {
+	return exprFunc(func(g *ruleGenerator) (node, error) {
+		expr, err := Seq(exprs...).build(g)
+		if err != nil {
+			return nil, err
+		}
+		return &group{expr: expr, mode: mode}, nil
+	})
+}
+
+// Not matches any single token that does not start a match of expr.
+func Not(expr Expr) Expr {
+	return exprFunc(func(g *ruleGenerator) (node, error) {
+		n, err := expr.build(g)
+		if err != nil {
+			return nil, err
+		}
+		return &negation{n}, nil
+	})
+}
+
+// Rules builds the grammar of a Parser[RuleNode] from programmatically constructed rules, starting at root.
+//
+//	parser, err := participle.Build[participle.RuleNode](participle.Rules(value))
+func Rules(root *RuleBuilder) Option {
+	return func(p *parserOptions) error {
+		p.rules = root
+		return nil
+	}
+}
+
+type ruleGenerator struct {
+	*generatorContext
+	rules map[*RuleBuilder]*rule
+}
+
+// A rule constructed with RuleBuilder.
+type rule struct {
+	name string
+	expr node
+}
+
+func (r *rule) String() string   { return ebnf(r) }
+func (r *rule) GoString() string { return r.name }
+
+func (r *rule) Parse(ctx *parseContext, parent reflect.Value) (out []reflect.Value, err error) {
+	defer ctx.printTrace(r)()
+	pos := ctx.Peek().Pos
+	ctx.PushRule(r.name, pos)
+	defer ctx.PopRule()
+	values, err := r.expr.Parse(ctx, parent)
+	if values == nil && err == nil {
+		return nil, nil
+	}
+	node := &RuleNode{Rule: r.name, Pos: pos, Children: make([]any, 0, len(values))}
+	for _, v := range values {
+		if v.Type() == ruleNodeType {
+			node.Children = append(node.Children, v.Addr().Interface())
+		} else if v.Type() == tokenType {
+			node.Children = append(node.Children, v.Interface().(lexer.Token).Value)
+		} else {
+			node.Children = append(node.Children, v.Interface())
+		}
+	}
+	return []reflect.Value{reflect.ValueOf(node).Elem()}, err
+}
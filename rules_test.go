@@ -0,0 +1,76 @@
+package participle_test
+
+import (
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+func TestRules(t *testing.T) {
+	value := participle.Rule("Value")
+	entry := participle.Rule("Entry").Seq(participle.Token("Ident"), participle.Literal("="), value)
+	value.Alt(participle.Token("Int")).
+		Alt(participle.Token("String")).
+		Alt(participle.Literal("["), participle.Optional(value, participle.ZeroOrMore(participle.Literal(","), value)), participle.Literal("]"))
+	config := participle.Rule("Config").Seq(participle.ZeroOrMore(entry))
+
+	p, err := participle.Build[participle.RuleNode](participle.Rules(config))
+	require.NoError(t, err)
+	require.Equal(t, `Config = Entry* .
+Entry = <ident> "=" Value .
+Value = <int> | <string> | ("[" (Value ("," Value)*)? "]") .`, p.String())
+
+	actual, err := p.ParseString("", `a = 1 b = [2, "c"]`)
+	require.NoError(t, err)
+	pos := func(offset, column int) lexer.Position {
+		return lexer.Position{Offset: offset, Line: 1, Column: column}
+	}
+	require.Equal(t, &participle.RuleNode{Rule: "Config", Pos: pos(0, 1), Children: []any{
+		&participle.RuleNode{Rule: "Entry", Pos: pos(0, 1), Children: []any{
+			"a", "=", &participle.RuleNode{Rule: "Value", Pos: pos(4, 5), Children: []any{"1"}},
+		}},
+		&participle.RuleNode{Rule: "Entry", Pos: pos(6, 7), Children: []any{
+			"b", "=", &participle.RuleNode{Rule: "Value", Pos: pos(10, 11), Children: []any{
+				"[",
+				&participle.RuleNode{Rule: "Value", Pos: pos(11, 12), Children: []any{"2"}},
+				",",
+				&participle.RuleNode{Rule: "Value", Pos: pos(14, 15), Children: []any{`"c"`}},
+				"]",
+			}},
+		}},
+	}}, actual)
+
+	_, err = p.ParseString("", `a = [1 2]`)
+	require.EqualError(t, err, `1:8: unexpected token "2" (expected "]")`)
+}
+
+func TestRulesErrors(t *testing.T) {
+	_, err := participle.Build[participle.RuleNode](participle.Rules(participle.Rule("A").Seq(participle.Token("Number"))))
+	require.EqualError(t, err, `A: unknown token type "Number"`)
+
+	type grammar struct {
+		A string `@Ident`
+	}
+	_, err = participle.Build[grammar](participle.Rules(participle.Rule("A").Seq(participle.Token("Ident"))))
+	require.EqualError(t, err, `Rules() requires a Parser[RuleNode] but got Parser[participle_test.grammar]`)
+}
+
+func TestRulesRejectLeftRecursion(t *testing.T) {
+	expr := participle.Rule("Expr")
+	expr.Alt(expr, participle.Literal("+"), participle.Token("Int")).Alt(participle.Token("Int"))
+	_, err := participle.Build[participle.RuleNode](participle.Rules(expr))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "left recursive rules are not supported")
+
+	// Indirect left recursion through another rule.
+	term := participle.Rule("Term")
+	sum := participle.Rule("Sum")
+	term.Alt(sum, participle.Literal("*")).Alt(participle.Token("Int"))
+	sum.Alt(participle.Literal("("), sum, participle.Literal(")")).Alt(term)
+	_, err = participle.Build[participle.RuleNode](participle.Rules(sum))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "left recursive rules are not supported")
+}
@@ -87,6 +87,19 @@ func (s *structLexer) Peek() (*lexer.Token, error) {
 	}
 }
 
+// PeekN peeks "n" tokens past the next token, such that PeekN(0) is equivalent to Peek().
+func (s *structLexer) PeekN(n int) (*lexer.Token, error) {
+	clone := *s
+	lex := *s.lexer
+	clone.lexer = &lex
+	for ; n > 0; n-- {
+		if _, err := clone.Next(); err != nil {
+			return nil, err
+		}
+	}
+	return clone.Peek()
+}
+
 func (s *structLexer) Next() (*lexer.Token, error) {
 	token := s.lexer.Next()
 	if !token.EOF() {
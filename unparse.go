@@ -0,0 +1,46 @@
+package participle
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// Unparse writes the source text of the AST node "node" to "w", reconstructed
+// from its `Tokens []lexer.Token` field.
+//
+// As Tokens include elided tokens such as whitespace and comments, the output
+// is identical to the input that the node was parsed from, aside from any
+// changes made to the tokens. The Tokens of the root node cover the entire
+// input, whereas those of other nodes include the elided tokens preceding the
+// node but not those following it.
+func Unparse(w io.Writer, node any) error {
+	tokens, err := nodeTokens(node)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if token.EOF() {
+			continue
+		}
+		if _, err := io.WriteString(w, token.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the Tokens field of "node", a struct or pointer to a struct.
+func nodeTokens(node any) ([]lexer.Token, error) {
+	v := reflect.Indirect(reflect.ValueOf(node))
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a struct or pointer to a struct but got %T", node)
+	}
+	field, ok := v.Type().FieldByName("Tokens")
+	if !ok || field.Type != tokensType {
+		return nil, fmt.Errorf("%s has no Tokens []lexer.Token field", v.Type())
+	}
+	return v.FieldByIndex(field.Index).Interface().([]lexer.Token), nil
+}
@@ -0,0 +1,61 @@
+package participle_test
+
+import (
+	"strings"
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+type unparseAssignment struct {
+	Tokens []lexer.Token
+
+	Name  string `@Ident "="`
+	Value string `@Ident ";"`
+}
+
+type unparseProgram struct {
+	Tokens []lexer.Token
+
+	Assignments []*unparseAssignment `@@*`
+}
+
+func newUnparseParser(t *testing.T) *participle.Parser[unparseProgram] {
+	t.Helper()
+	return mustTestParser[unparseProgram](t,
+		participle.Elide("Whitespace", "Comment"),
+		participle.Lexer(lexer.MustSimple([]lexer.SimpleRule{
+			{"Comment", `//[^\n]*`},
+			{"Ident", `\w+`},
+			{"Punct", `[=;]`},
+			{"Whitespace", `\s+`},
+		})))
+}
+
+func unparse(t *testing.T, node any) string {
+	t.Helper()
+	w := &strings.Builder{}
+	require.NoError(t, participle.Unparse(w, node))
+	return w.String()
+}
+
+func TestUnparse(t *testing.T) {
+	p := newUnparseParser(t)
+	source := "  // Leading comment.\na = b;\n\nc=d; // Trailing comment.\n"
+	ast, err := p.ParseString("", source)
+	require.NoError(t, err)
+	require.Equal(t, source, unparse(t, ast))
+	require.Equal(t, "\n\nc=d;", unparse(t, ast.Assignments[1]))
+
+	for i, token := range ast.Tokens {
+		if token.Value == "d" {
+			ast.Tokens[i].Value = "e"
+		}
+	}
+	require.Equal(t, "  // Leading comment.\na = b;\n\nc=e; // Trailing comment.\n", unparse(t, ast))
+
+	err = participle.Unparse(&strings.Builder{}, struct{ Name string }{})
+	require.EqualError(t, err, "struct { Name string } has no Tokens []lexer.Token field")
+}
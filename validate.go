@@ -7,53 +7,166 @@ import (
 
 // Perform some post-construction validation. This currently does:
 //
-// Checks for left recursion.
+// Detects left recursion, marking left recursive structs to be parsed by
+// growing a seed match, and rejecting left recursive rules.
+//
+// Computes the maximum width of lookbehind assertions, rejecting those that are unbounded.
 func validate(n node) error {
 	checked := map[*strct]bool{}
-	seen := map[node]bool{}
+	checkedRules := map[*rule]bool{}
 
 	return visit(n, func(n node, next func() error) error {
+		if n, ok := n.(*rule); ok {
+			if checkedRules[n] {
+				return nil
+			}
+			checkedRules[n] = true
+			// "ok" is false only if a left recursive alternative follows another alternative.
+			if recurses, ok := leftRecurses(n, n.expr, map[node]bool{}); recurses || !ok {
+				return fmt.Errorf("left recursive rules are not supported in\n\n%s", indent(n.String()))
+			}
+		}
+		if n, ok := n.(*lookaheadGroup); ok && n.behind {
+			width, bounded := maxTokenWidth(n.expr, map[node]bool{})
+			if !bounded {
+				return fmt.Errorf("lookbehind must match a bounded number of tokens in\n\n%s", indent(n.String()))
+			}
+			n.maxWidth = width
+		}
 		if n, ok := n.(*strct); ok {
-			if !checked[n] && isLeftRecursive(n) {
-				return fmt.Errorf("left recursion detected on\n\n%s", indent(n.String()))
+			if checked[n] {
+				return nil
 			}
 			checked[n] = true
-			if seen[n] {
-				return nil
+			recurses, ok := leftRecurses(n, n.expr, map[node]bool{})
+			if !ok {
+				return fmt.Errorf("left recursive alternatives must precede other alternatives in\n\n%s", indent(n.String()))
 			}
+			n.leftRecursive = recurses
 		}
-		seen[n] = true
 		return next()
 	})
 }
 
-func isLeftRecursive(root *strct) (found bool) {
-	defer func() { _ = recover() }()
-	seen := map[node]bool{}
-	_ = visit(root.expr, func(n node, next func() error) error {
-		if found {
-			return nil
-		}
-		switch n := n.(type) {
-		case *strct:
-			if root.typ == n.typ {
-				found = true
-			}
-
-		case *sequence:
-			if !n.head {
-				panic("done")
-			}
+// Reports whether n may parse root, a *strct or *rule, before consuming any input.
+//
+// As alternatives are tried in order, a left recursive alternative following
+// one that is not could never grow the seed match, so "ok" is false if that
+// is the case.
+func leftRecurses(root node, n node, memo map[node]bool) (recurses, ok bool) {
+	if recurses, seen := memo[n]; seen {
+		return recurses, true
+	}
+	memo[n] = false
+	switch n := n.(type) {
+	case *strct:
+		if root, isStrct := root.(*strct); isStrct && n.typ == root.typ {
+			recurses, ok = true, true
+		} else {
+			recurses, ok = leftRecurses(root, n.expr, memo)
 		}
-		if seen[n] {
-			return nil
+	case *rule:
+		if n == root {
+			recurses, ok = true, true
+		} else {
+			recurses, ok = leftRecurses(root, n.expr, memo)
 		}
-		seen[n] = true
-		return next()
-	})
-	return
+	case *disjunction:
+		recurses, ok = leftRecursesAlternatives(root, n.nodes, memo)
+	case *union:
+		recurses, ok = leftRecursesAlternatives(root, n.disjunction.nodes, memo)
+	case *expression:
+		recurses, ok = leftRecurses(root, n.operandNode, memo)
+	case *sequence:
+		recurses, ok = leftRecurses(root, n.node, memo)
+	case *capture:
+		recurses, ok = leftRecurses(root, n.node, memo)
+	case *group:
+		recurses, ok = leftRecurses(root, n.expr, memo)
+	case *negation:
+		recurses, ok = leftRecurses(root, n.node, memo)
+	case *adjacent:
+		recurses, ok = leftRecurses(root, n.node, memo)
+	default:
+		ok = true
+	}
+	memo[n] = recurses
+	return recurses, ok
+}
+
+func leftRecursesAlternatives(root node, alternatives []node, memo map[node]bool) (recurses, ok bool) {
+	plain := false
+	for _, alternative := range alternatives {
+		r, ok := leftRecurses(root, alternative, memo)
+		if !ok || (r && plain) {
+			return false, false
+		}
+		plain = plain || !r
+		recurses = recurses || r
+	}
+	return recurses, true
 }
 
 func indent(s string) string {
 	return "  " + strings.Join(strings.Split(s, "\n"), "\n  ")
 }
+
+// Returns the maximum number of tokens that n can match, if bounded.
+func maxTokenWidth(n node, visiting map[node]bool) (width int, bounded bool) {
+	if visiting[n] {
+		return 0, false // Recursive.
+	}
+	visiting[n] = true
+	defer delete(visiting, n)
+	switch n := n.(type) {
+	case *literal, *reference, *negation:
+		return 1, true
+	case *cut, *recoverDirective, *lookaheadGroup:
+		return 0, true
+	case *strct:
+		return maxTokenWidth(n.expr, visiting)
+	case *rule:
+		return maxTokenWidth(n.expr, visiting)
+	case *capture:
+		return maxTokenWidth(n.node, visiting)
+	case *adjacent:
+		return maxTokenWidth(n.node, visiting)
+	case *union:
+		return maxTokenWidthAlternatives(n.disjunction.nodes, visiting)
+	case *disjunction:
+		return maxTokenWidthAlternatives(n.nodes, visiting)
+	case *sequence:
+		for ; n != nil; n = n.next {
+			w, ok := maxTokenWidth(n.node, visiting)
+			if !ok {
+				return 0, false
+			}
+			width += w
+		}
+		return width, true
+	case *group:
+		w, ok := maxTokenWidth(n.expr, visiting)
+		switch {
+		case !ok:
+			return 0, false
+		case n.mode == groupMatchOnce || n.mode == groupMatchZeroOrOne || n.mode == groupMatchNonEmpty:
+			return w, true
+		case n.mode == groupMatchRange && n.max >= 0:
+			return w * n.max, true
+		}
+		return 0, false
+	}
+	// Custom, Parseable and operator precedence nodes may match any number of tokens.
+	return 0, false
+}
+
+func maxTokenWidthAlternatives(alternatives []node, visiting map[node]bool) (width int, bounded bool) {
+	for _, alternative := range alternatives {
+		w, ok := maxTokenWidth(alternative, visiting)
+		if !ok {
+			return 0, false
+		}
+		width = maxInt(width, w)
+	}
+	return width, true
+}
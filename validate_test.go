@@ -15,7 +15,7 @@ type leftRecursionSimple struct {
 func TestValidateLeftRecursion(t *testing.T) {
 	_, err := participle.Build[leftRecursionSimple]()
 	require.Error(t, err)
-	require.Equal(t, err.Error(), `left recursion detected on
+	require.Equal(t, err.Error(), `left recursive alternatives must precede other alternatives in
 
   LeftRecursionSimple = <ident> | (LeftRecursionSimple "more") .`)
 }
@@ -33,8 +33,109 @@ type leftRecursionNested struct {
 func TestValidateLeftRecursionNested(t *testing.T) {
 	_, err := participle.Build[leftRecursionNested]()
 	require.Error(t, err)
-	require.Equal(t, err.Error(), `left recursion detected on
+	require.Equal(t, err.Error(), `left recursive alternatives must precede other alternatives in
 
   LeftRecursionNested = <ident> | (LeftRecursionNestedInner "more") .
   LeftRecursionNestedInner = <ident> | LeftRecursionNested .`)
 }
+
+type leftRecursionExpr struct {
+	Left  *leftRecursionExpr `(  @@`
+	Op    string             `   @("+" | "-")`
+	Right *leftRecursionTerm `   @@ )`
+	Term  *leftRecursionTerm `| @@`
+}
+
+type leftRecursionTerm struct {
+	Left  *leftRecursionTerm `(  @@`
+	Op    string             `   @("*" | "/")`
+	Right int                `   @Int )`
+	Value int                `| @Int`
+}
+
+func TestLeftRecursion(t *testing.T) {
+	p := mustTestParser[leftRecursionExpr](t)
+	actual, err := p.ParseString("", "1 - 2 * 3 - 4")
+	require.NoError(t, err)
+	expected := &leftRecursionExpr{
+		Left: &leftRecursionExpr{
+			Left: &leftRecursionExpr{Term: &leftRecursionTerm{Value: 1}},
+			Op:   "-",
+			Right: &leftRecursionTerm{
+				Left:  &leftRecursionTerm{Value: 2},
+				Op:    "*",
+				Right: 3,
+			},
+		},
+		Op:    "-",
+		Right: &leftRecursionTerm{Value: 4},
+	}
+	require.Equal(t, expected, actual)
+
+	actual, err = p.ParseString("", "1")
+	require.NoError(t, err)
+	require.Equal(t, &leftRecursionExpr{Term: &leftRecursionTerm{Value: 1}}, actual)
+
+	_, err = p.ParseString("", "1 + 2 *")
+	require.EqualError(t, err, `1:8: unexpected token "<EOF>" (expected <int>)`)
+}
+
+type leftRecursionIndirectCall struct {
+	Callee *leftRecursionIndirect `@@ "(" ")"`
+}
+
+type leftRecursionIndirect struct {
+	Call  *leftRecursionIndirectCall `  @@`
+	Ident string                     `| @Ident`
+}
+
+func TestLeftRecursionIndirect(t *testing.T) {
+	p := mustTestParser[leftRecursionIndirect](t)
+	actual, err := p.ParseString("", "f()()")
+	require.NoError(t, err)
+	expected := &leftRecursionIndirect{Call: &leftRecursionIndirectCall{
+		Callee: &leftRecursionIndirect{Call: &leftRecursionIndirectCall{
+			Callee: &leftRecursionIndirect{Ident: "f"},
+		}},
+	}}
+	require.Equal(t, expected, actual)
+}
+
+type leftRecursionUnion interface{ leftRecursionUnion() }
+
+type leftRecursionBinary struct {
+	Left  leftRecursionUnion   `@@`
+	Op    string               `@("+" | "-")`
+	Right leftRecursionLiteral `@@`
+}
+
+func (leftRecursionBinary) leftRecursionUnion() {}
+
+type leftRecursionLiteral struct {
+	Value int `@Int`
+}
+
+func (leftRecursionLiteral) leftRecursionUnion() {}
+
+func TestLeftRecursionUnion(t *testing.T) {
+	p := mustTestParser[leftRecursionUnion](t, participle.Union[leftRecursionUnion](leftRecursionBinary{}, leftRecursionLiteral{}))
+	actual, err := p.ParseString("", "1 + 2 - 3")
+	require.NoError(t, err)
+	var expected leftRecursionUnion = leftRecursionBinary{
+		Left: leftRecursionBinary{
+			Left:  leftRecursionLiteral{1},
+			Op:    "+",
+			Right: leftRecursionLiteral{2},
+		},
+		Op:    "-",
+		Right: leftRecursionLiteral{3},
+	}
+	require.Equal(t, &expected, actual)
+
+	_, err = participle.Build[leftRecursionUnion](participle.Union[leftRecursionUnion](leftRecursionLiteral{}, leftRecursionBinary{}))
+	require.EqualError(t, err, `left recursive alternatives must precede other alternatives in
+
+  LeftRecursionBinary = LeftRecursionUnion ("+" | "-") LeftRecursionLiteral .
+  LeftRecursionUnion = LeftRecursionLiteral | LeftRecursionBinary .
+  LeftRecursionLiteral = <int> .`)
+}
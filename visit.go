@@ -17,8 +17,12 @@ func visit(n node, visitor func(n node, next func() error) error) error {
 			return nil
 		case *strct:
 			return visit(n.expr, visitor)
+		case *rule:
+			return visit(n.expr, visitor)
 		case *custom:
 			return nil
+		case *expression:
+			return visit(n.operandNode, visitor)
 		case *union:
 			for _, member := range n.disjunction.nodes {
 				if err := visit(member, visitor); err != nil {
@@ -42,8 +46,12 @@ func visit(n node, visitor func(n node, next func() error) error) error {
 			return nil
 		case *negation:
 			return visit(n.node, visitor)
+		case *adjacent:
+			return visit(n.node, visitor)
 		case *literal:
 			return nil
+		case *cut, *recoverDirective:
+			return nil
 		case *group:
 			return visit(n.expr, visitor)
 		case *lookaheadGroup:
@@ -0,0 +1,145 @@
+package participle
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// The `@@` fields of the struct types of every grammar built, for Walk.
+var walkFieldsRegistry sync.Map // map[reflect.Type][][]int
+
+// Walk traverses the AST rooted at "node" in depth-first order.
+//
+// "fn" is called for each AST node, ie. "node" itself and each struct captured
+// by an `@@` field of its parent in the grammar, directly or via a pointer,
+// union interface or slice. Nodes are passed as pointers, along with the field
+// of "parent" that holds them. For "node" itself, "field" is the zero value and
+// "parent" is nil. Tokens, spans and types implementing Capture or
+// encoding.TextUnmarshaler are not nodes.
+//
+// If "fn" returns false, the children of "node" are not traversed.
+//
+// The fields to traverse are those of the grammars built so far, so "node"
+// must be (part of) an AST of a grammar that has been built with Build.
+func Walk(node any, fn func(node any, field reflect.StructField, parent any) bool) {
+	walk(reflect.ValueOf(node), reflect.StructField{}, nil, fn)
+}
+
+func walk(v reflect.Value, field reflect.StructField, parent any, fn func(node any, field reflect.StructField, parent any) bool) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			walk(v.Elem(), field, parent, fn)
+		}
+		return
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walk(v.Index(i), field, parent, fn)
+		}
+		return
+	case reflect.Ptr:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct {
+			return
+		}
+	case reflect.Struct:
+		if !v.CanAddr() {
+			// Only the root can be unaddressable, so copy it to be able to pass a pointer.
+			ptr := reflect.New(v.Type())
+			ptr.Elem().Set(v)
+			v = ptr
+		} else {
+			v = v.Addr()
+		}
+	default:
+		return
+	}
+	if !isWalkNode(v.Elem().Type()) {
+		return
+	}
+	node := v.Interface()
+	if !fn(node, field, parent) {
+		return
+	}
+	strct := v.Elem()
+	for _, index := range registeredWalkFields(strct.Type()) {
+		f := strct.Type().FieldByIndex(index)
+		fv, err := strct.FieldByIndexErr(index)
+		if err != nil { // Nil embedded pointer.
+			continue
+		}
+		walk(fv, f, node, fn)
+	}
+}
+
+// Whether values of the struct type "t" are AST nodes rather than captured values.
+func isWalkNode(t reflect.Type) bool {
+	return t != tokenType && t != spanType && !implements(t, captureType) && !implements(t, textUnmarshalerType)
+}
+
+// Register the `@@` fields of the struct types of a grammar for Walk.
+func registerWalkFields(fields map[reflect.Type][][]int) {
+	for t, indexes := range fields {
+		walkFieldsRegistry.Store(t, indexes)
+	}
+}
+
+func registeredWalkFields(t reflect.Type) [][]int {
+	if indexes, ok := walkFieldsRegistry.Load(t); ok {
+		return indexes.([][]int)
+	}
+	return nil
+}
+
+// Collect the indexes of the fields of each struct in the grammar that are
+// bound to `@@` captures of other nodes, in field order.
+func collectWalkFields(typeNodes map[reflect.Type]node) map[reflect.Type][][]int {
+	out := map[reflect.Type][][]int{}
+	for _, n := range typeNodes {
+		s, ok := n.(*strct)
+		if !ok {
+			continue
+		}
+		if _, ok := out[s.typ]; ok {
+			continue
+		}
+		indexes := [][]int{}
+		_ = visit(s.expr, func(n node, next func() error) error {
+			switch n := n.(type) {
+			case *capture:
+				switch n.node.(type) {
+				case *strct, *union, *expression:
+					if !containsIndex(indexes, n.field.Index) {
+						indexes = append(indexes, n.field.Index)
+					}
+				}
+				return nil
+			case *strct, *union, *expression, *rule:
+				// Fields of other nodes are collected separately.
+				return nil
+			}
+			return next()
+		})
+		sort.Slice(indexes, func(i, j int) bool { return lessIndex(indexes[i], indexes[j]) })
+		out[s.typ] = indexes
+	}
+	return out
+}
+
+func containsIndex(indexes [][]int, index []int) bool {
+	for _, candidate := range indexes {
+		if reflect.DeepEqual(candidate, index) {
+			return true
+		}
+	}
+	return false
+}
+
+func lessIndex(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,80 @@
+package participle_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	require "github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+type walkStatement interface{ walkStatement() }
+
+type walkAssign struct {
+	Name  string      `@Ident`
+	Op    lexer.Token `@"="`
+	Value *walkValue  `@@ ";"`
+}
+
+func (*walkAssign) walkStatement() {}
+
+type walkCall struct {
+	Name string       `@Ident`
+	Open lexer.Span   `@"("`
+	Args []*walkValue `(@@ ("," @@)*)? ")" ";"`
+}
+
+func (*walkCall) walkStatement() {}
+
+type walkBool struct{ Value bool }
+
+func (b *walkBool) Capture(values []string) error {
+	b.Value = values[0] == "true"
+	return nil
+}
+
+type walkValue struct {
+	Number *int      `  @Int`
+	Bool   *walkBool `| @("true" | "false")`
+	Ident  string    `| @Ident`
+}
+
+type walkProgram struct {
+	Statements []walkStatement `@@*`
+}
+
+func TestWalk(t *testing.T) {
+	p := mustTestParser[walkProgram](t, participle.Union[walkStatement](&walkCall{}, &walkAssign{}))
+	ast, err := p.ParseString("", `a = 1; f(a, true);`)
+	require.NoError(t, err)
+
+	var visited []string
+	participle.Walk(ast, func(node any, field reflect.StructField, parent any) bool {
+		visited = append(visited, fmt.Sprintf("%T %s %T", node, field.Name, parent))
+		return true
+	})
+	require.Equal(t, []string{
+		"*participle_test.walkProgram  <nil>",
+		"*participle_test.walkAssign Statements *participle_test.walkProgram",
+		"*participle_test.walkValue Value *participle_test.walkAssign",
+		"*participle_test.walkCall Statements *participle_test.walkProgram",
+		"*participle_test.walkValue Args *participle_test.walkCall",
+		"*participle_test.walkValue Args *participle_test.walkCall",
+	}, visited)
+
+	// Returning false skips the children of a node.
+	visited = nil
+	participle.Walk(ast, func(node any, field reflect.StructField, parent any) bool {
+		visited = append(visited, fmt.Sprintf("%T", node))
+		_, isCall := node.(*walkCall)
+		return !isCall
+	})
+	require.Equal(t, []string{
+		"*participle_test.walkProgram",
+		"*participle_test.walkAssign",
+		"*participle_test.walkValue",
+		"*participle_test.walkCall",
+	}, visited)
+}